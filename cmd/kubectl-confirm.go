@@ -17,15 +17,15 @@ limitations under the License.
 package main
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/brianpursley/kubectl-confirm/pkg/cmd"
 )
 
 func main() {
 	cmd := cmd.NewConfirmCommand()
-	err := cmd.Execute()
-	if err != nil {
-		_ = fmt.Errorf("confirm failed: %s", err)
+	// Cobra prints the error
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
 	}
 }
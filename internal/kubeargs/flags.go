@@ -0,0 +1,227 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeargs
+
+import (
+	"strings"
+)
+
+type valueType int
+
+const (
+	// The flag never takes a value, unless it is specified using =
+	noValue valueType = iota
+	// The flag takes a value, either using = or as the next arg
+	requiredValue
+	// The flag takes a value only if it is specified using =, like --dry-run
+	optionalValue
+)
+
+type flagSpec struct {
+	name      string
+	shorthand string
+	value     valueType
+	global    bool
+}
+
+// Flags that kubectl accepts for every command
+var globalFlagSpecs = []flagSpec{
+	{name: "as", value: requiredValue, global: true},
+	{name: "as-group", value: requiredValue, global: true},
+	{name: "as-uid", value: requiredValue, global: true},
+	{name: "cache-dir", value: requiredValue, global: true},
+	{name: "certificate-authority", value: requiredValue, global: true},
+	{name: "client-certificate", value: requiredValue, global: true},
+	{name: "client-key", value: requiredValue, global: true},
+	{name: "cluster", value: requiredValue, global: true},
+	{name: "context", value: requiredValue, global: true},
+	{name: "disable-compression", value: noValue, global: true},
+	{name: "insecure-skip-tls-verify", value: noValue, global: true},
+	{name: "kubeconfig", value: requiredValue, global: true},
+	{name: "log-flush-frequency", value: requiredValue, global: true},
+	{name: "match-server-version", value: noValue, global: true},
+	{name: "namespace", shorthand: "n", value: requiredValue, global: true},
+	{name: "password", value: requiredValue, global: true},
+	{name: "profile-output", value: requiredValue, global: true},
+	{name: "request-timeout", value: requiredValue, global: true},
+	{name: "server", shorthand: "s", value: requiredValue, global: true},
+	{name: "tls-server-name", value: requiredValue, global: true},
+	{name: "token", value: requiredValue, global: true},
+	{name: "user", value: requiredValue, global: true},
+	{name: "username", value: requiredValue, global: true},
+	{name: "v", shorthand: "v", value: requiredValue, global: true},
+	{name: "vmodule", value: requiredValue, global: true},
+	{name: "warnings-as-errors", value: noValue, global: true},
+}
+
+// Flags that are shared by many kubectl commands. Flags that are not listed here are assumed not to take a value
+// unless it is specified using =.
+var commonFlagSpecs = []flagSpec{
+	{name: "address", value: requiredValue},
+	{name: "all-namespaces", shorthand: "A", value: noValue},
+	{name: "annotation", value: requiredValue},
+	{name: "annotations", value: requiredValue},
+	{name: "cascade", value: optionalValue},
+	{name: "cert", value: requiredValue},
+	{name: "chunk-size", value: requiredValue},
+	{name: "cluster-ip", value: requiredValue},
+	{name: "clusterrole", value: requiredValue},
+	{name: "container", shorthand: "c", value: requiredValue},
+	{name: "copy-to", value: requiredValue},
+	{name: "cpu-percent", value: requiredValue},
+	{name: "current-replicas", value: requiredValue},
+	{name: "custom", value: requiredValue},
+	{name: "docker-email", value: requiredValue},
+	{name: "docker-password", value: requiredValue},
+	{name: "docker-server", value: requiredValue},
+	{name: "docker-username", value: requiredValue},
+	{name: "dry-run", value: optionalValue},
+	{name: "env", shorthand: "e", value: requiredValue},
+	{name: "external-ip", value: requiredValue},
+	{name: "field-manager", value: requiredValue},
+	{name: "field-selector", value: requiredValue},
+	{name: "filename", shorthand: "f", value: requiredValue},
+	{name: "for", value: requiredValue},
+	{name: "from", value: requiredValue},
+	{name: "from-env-file", value: requiredValue},
+	{name: "from-file", value: requiredValue},
+	{name: "from-literal", value: requiredValue},
+	{name: "grace-period", value: requiredValue},
+	{name: "group", value: requiredValue},
+	{name: "hard", value: requiredValue},
+	{name: "help", shorthand: "h", value: noValue},
+	{name: "image", value: requiredValue},
+	{name: "image-pull-policy", value: requiredValue},
+	{name: "key", value: requiredValue},
+	{name: "kustomize", shorthand: "k", value: requiredValue},
+	{name: "label-columns", shorthand: "L", value: requiredValue},
+	{name: "labels", value: requiredValue},
+	{name: "limits", value: requiredValue},
+	{name: "max", value: requiredValue},
+	{name: "min", value: requiredValue},
+	{name: "name", value: requiredValue},
+	{name: "output", shorthand: "o", value: requiredValue},
+	{name: "overrides", value: requiredValue},
+	{name: "patch-file", value: requiredValue},
+	{name: "pod-running-timeout", value: requiredValue},
+	{name: "pod-selector", value: requiredValue},
+	{name: "port", value: requiredValue},
+	{name: "profile", value: requiredValue},
+	{name: "protocol", value: requiredValue},
+	{name: "prune-allowlist", value: requiredValue},
+	{name: "quiet", shorthand: "q", value: noValue},
+	{name: "raw", value: requiredValue},
+	{name: "recursive", shorthand: "R", value: noValue},
+	{name: "replicas", shorthand: "r", value: requiredValue},
+	{name: "requests", value: requiredValue},
+	{name: "resource", value: requiredValue},
+	{name: "resource-name", value: requiredValue},
+	{name: "resource-version", value: requiredValue},
+	{name: "restart", value: requiredValue},
+	{name: "retries", value: requiredValue},
+	{name: "revision", value: requiredValue},
+	{name: "role", value: requiredValue},
+	{name: "rule", value: requiredValue},
+	{name: "schedule", value: requiredValue},
+	{name: "selector", shorthand: "l", value: requiredValue},
+	{name: "serviceaccount", value: requiredValue},
+	{name: "session-affinity", value: requiredValue},
+	{name: "set-image", value: requiredValue},
+	{name: "since", value: requiredValue},
+	{name: "since-time", value: requiredValue},
+	{name: "skip-wait-for-delete-timeout", value: requiredValue},
+	{name: "sort-by", value: requiredValue},
+	{name: "stdin", shorthand: "i", value: noValue},
+	{name: "subresource", value: requiredValue},
+	{name: "tail", value: requiredValue},
+	{name: "target", value: requiredValue},
+	{name: "target-port", value: requiredValue},
+	{name: "tcp", value: requiredValue},
+	{name: "template", value: requiredValue},
+	{name: "timeout", value: requiredValue},
+	{name: "to-revision", value: requiredValue},
+	{name: "tty", shorthand: "t", value: noValue},
+	{name: "type", value: requiredValue},
+	{name: "validate", value: optionalValue},
+	{name: "verb", value: requiredValue},
+	{name: "watch", shorthand: "w", value: noValue},
+}
+
+// Flags whose meaning differs between kubectl commands, which take precedence over the global and common flags. They
+// are keyed by verb, or by verb and subcommand, like create rolebinding, which take precedence over those of the verb.
+var verbFlagSpecs = map[string][]flagSpec{
+	"create clusterrolebinding": subjectFlagSpecs,
+	"create rolebinding":        subjectFlagSpecs,
+	"exec": {
+		{name: "pod", shorthand: "p", value: requiredValue},
+	},
+	"logs": {
+		{name: "follow", shorthand: "f", value: noValue},
+		{name: "previous", shorthand: "p", value: noValue},
+	},
+	"patch": {
+		{name: "patch", shorthand: "p", value: requiredValue},
+	},
+	"set subject": subjectFlagSpecs,
+}
+
+// Flags of the commands that bind a role to subjects, where --user is the name of a subject, not the kubeconfig user
+var subjectFlagSpecs = []flagSpec{
+	{name: "group", value: requiredValue},
+	{name: "user", value: requiredValue},
+}
+
+// Flags of kubectl confirm itself, which are removed before kubectl is run
+var confirmFlagSpecs = []flagSpec{
+	{name: "confirm-namespace-selector", value: requiredValue},
+	{name: "confirm-namespaces", value: requiredValue},
+	{name: "confirm-verify", value: noValue},
+	{name: "confirm-verify-timeout", value: requiredValue},
+	{name: "contexts", value: requiredValue},
+	{name: "continue-on-error", value: noValue},
+}
+
+func lookupLong(command, name string) flagSpec {
+	for _, specs := range flagSpecTables(command) {
+		for _, spec := range specs {
+			if spec.name == name {
+				return spec
+			}
+		}
+	}
+	return flagSpec{name: name, value: noValue}
+}
+
+func lookupShort(command, shorthand string) flagSpec {
+	for _, specs := range flagSpecTables(command) {
+		for _, spec := range specs {
+			if spec.shorthand == shorthand {
+				return spec
+			}
+		}
+	}
+	return flagSpec{name: shorthand, shorthand: shorthand, value: noValue}
+}
+
+// flagSpecTables returns the tables of flags that apply to a command, like create rolebinding, in order of precedence
+func flagSpecTables(command string) [][]flagSpec {
+	tables := [][]flagSpec{verbFlagSpecs[command]}
+	if verb, _, found := strings.Cut(command, " "); found {
+		tables = append(tables, verbFlagSpecs[verb])
+	}
+	return append(tables, globalFlagSpecs, commonFlagSpecs, confirmFlagSpecs)
+}
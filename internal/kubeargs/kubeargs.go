@@ -0,0 +1,332 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubeargs parses kubectl command lines the same way kubectl does, so that the command being confirmed can be
+// inspected and rewritten without changing its meaning.
+package kubeargs
+
+import (
+	"strings"
+)
+
+// Flag is a flag found in a kubectl command line
+type Flag struct {
+	// Name is the long name of the flag, without dashes. Unknown short flags are named by their shorthand.
+	Name string
+	// Value is the value of the flag, or an empty string if it has no value
+	Value string
+	// HasValue is true if a value was specified for the flag
+	HasValue bool
+	// Global is true if the flag is one of the global kubectl flags, like --context
+	Global bool
+
+	// The index of the arg that the flag is in, its shorthand if it was specified that way, and whether its value is in
+	// the next arg
+	index          int
+	shorthand      string
+	valueInNextArg bool
+}
+
+// Args is a parsed kubectl command line
+type Args struct {
+	raw        []string
+	flags      []Flag
+	positional []int
+	dashIndex  int
+}
+
+// Parse parses a kubectl command line, not including the kubectl executable itself
+func Parse(argv []string) *Args {
+	a := &Args{raw: argv, dashIndex: -1}
+	// The verb, followed by the subcommand if it has flags of its own, like create rolebinding
+	command := ""
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+		switch {
+		case arg == "--":
+			a.dashIndex = i
+			return a
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			spec := lookupLong(command, name)
+			f := Flag{Name: spec.name, Value: value, HasValue: hasValue, Global: spec.global, index: i}
+			if !hasValue && spec.value == requiredValue && i+1 < len(argv) {
+				i++
+				f.Value, f.HasValue, f.valueInNextArg = argv[i], true, true
+			}
+			a.flags = append(a.flags, f)
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			i += a.parseShortFlags(command, argv, i)
+		default:
+			switch len(a.positional) {
+			case 0:
+				command = arg
+			case 1:
+				if _, found := verbFlagSpecs[command+" "+arg]; found {
+					command += " " + arg
+				}
+			}
+			a.positional = append(a.positional, i)
+		}
+	}
+	return a
+}
+
+// parseShortFlags parses a group of short flags, like -it or -oyaml, and returns the number of additional args that
+// were consumed as a value
+func (a *Args) parseShortFlags(command string, argv []string, i int) int {
+	shorthands := argv[i][1:]
+	for j := 0; j < len(shorthands); j++ {
+		spec := lookupShort(command, shorthands[j:j+1])
+		f := Flag{Name: spec.name, Global: spec.global, index: i, shorthand: shorthands[j : j+1]}
+		rest := shorthands[j+1:]
+		if strings.HasPrefix(rest, "=") {
+			f.Value, f.HasValue = rest[1:], true
+			a.flags = append(a.flags, f)
+			return 0
+		}
+		if spec.value == requiredValue {
+			if len(rest) > 0 {
+				f.Value, f.HasValue = rest, true
+				a.flags = append(a.flags, f)
+				return 0
+			}
+			if i+1 < len(argv) {
+				f.Value, f.HasValue, f.valueInNextArg = argv[i+1], true, true
+				a.flags = append(a.flags, f)
+				return 1
+			}
+		}
+		a.flags = append(a.flags, f)
+	}
+	return 0
+}
+
+// Raw returns the original command line
+func (a *Args) Raw() []string {
+	return a.raw
+}
+
+// Verb returns the kubectl command, which is the first positional arg, or an empty string if there is none
+func (a *Args) Verb() string {
+	if len(a.positional) == 0 {
+		return ""
+	}
+	return a.raw[a.positional[0]]
+}
+
+// Operands returns the positional args that follow the verb, up to --
+func (a *Args) Operands() []string {
+	var operands []string
+	for _, i := range a.positional[min(1, len(a.positional)):] {
+		operands = append(operands, a.raw[i])
+	}
+	return operands
+}
+
+// AfterDash returns the args that follow --, which are passed to a command that runs in a container
+func (a *Args) AfterDash() []string {
+	if a.dashIndex < 0 {
+		return nil
+	}
+	return a.raw[a.dashIndex+1:]
+}
+
+// Flags returns all the flags that were found
+func (a *Args) Flags() []Flag {
+	return a.flags
+}
+
+// Has returns true if a flag with the specified long name was found
+func (a *Args) Has(name string) bool {
+	for _, f := range a.flags {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the value of the last occurrence of a flag with the specified long name, or an empty string
+func (a *Args) Value(name string) string {
+	values := a.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// GlobalValue returns the value of the last occurrence of a global flag with the specified long name, ignoring a flag
+// of the command with the same name, like --user of create rolebinding, or an empty string
+func (a *Args) GlobalValue(name string) string {
+	value := ""
+	for _, f := range a.flags {
+		if f.Name == name && f.Global && f.HasValue {
+			value = f.Value
+		}
+	}
+	return value
+}
+
+// Values returns the values of all occurrences of a flag with the specified long name
+func (a *Args) Values(name string) []string {
+	var values []string
+	for _, f := range a.flags {
+		if f.Name == name && f.HasValue {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// FlagArgs returns the flags for which include returns true, normalized to the --name=value form
+func (a *Args) FlagArgs(include func(f Flag) bool) []string {
+	var args []string
+	for _, f := range a.flags {
+		if !include(f) {
+			continue
+		}
+		if f.HasValue {
+			args = append(args, "--"+f.Name+"="+f.Value)
+		} else {
+			args = append(args, "--"+f.Name)
+		}
+	}
+	return args
+}
+
+// GlobalFlagArgs returns the global flags, except for the specified ones, normalized to the --name=value form. They
+// can be used to run other kubectl commands against the same cluster.
+func (a *Args) GlobalFlagArgs(except ...string) []string {
+	return a.FlagArgs(func(f Flag) bool {
+		return f.Global && !contains(except, f.Name)
+	})
+}
+
+// Without returns the original command line with all occurrences of the flags with the specified long names removed
+func (a *Args) Without(names ...string) []string {
+	var result []string
+	for i := 0; i < len(a.raw); i++ {
+		if a.dashIndex >= 0 && i >= a.dashIndex {
+			return append(result, a.raw[i:]...)
+		}
+		flags := a.flagsAt(i)
+		if len(flags) == 0 {
+			result = append(result, a.raw[i])
+			continue
+		}
+		removed := false
+		for _, f := range flags {
+			removed = removed || contains(names, f.Name)
+		}
+		last := flags[len(flags)-1]
+		if !removed {
+			result = append(result, a.raw[i])
+			if last.valueInNextArg {
+				result = append(result, a.raw[i+1])
+			}
+		} else if !strings.HasPrefix(a.raw[i], "--") {
+			// Keep the other flags of a group of short flags
+			result = append(result, a.rebuildShortFlags(flags, names)...)
+		}
+		if last.valueInNextArg {
+			i++
+		}
+	}
+	return result
+}
+
+// With returns the original command line with the specified args added to it. They are added before --, if present,
+// so that they are not passed through to the command that runs in a container.
+func (a *Args) With(args ...string) []string {
+	result := make([]string, 0, len(a.raw)+len(args))
+	if a.dashIndex < 0 {
+		return append(append(result, a.raw...), args...)
+	}
+	result = append(append(result, a.raw[:a.dashIndex]...), args...)
+	return append(result, a.raw[a.dashIndex:]...)
+}
+
+// ReplaceValues returns the original command line with the values of flags replaced. For each flag with a value,
+// replace returns the new value and true, or false to keep the value.
+func (a *Args) ReplaceValues(replace func(f Flag) (string, bool)) []string {
+	result := append([]string{}, a.raw...)
+	for _, f := range a.flags {
+		if !f.HasValue {
+			continue
+		}
+		value, replaced := replace(f)
+		if !replaced {
+			continue
+		}
+		if f.valueInNextArg {
+			result[f.index+1] = value
+		} else {
+			// The value is the rest of the arg, like in --token=abc or -pabc
+			arg := a.raw[f.index]
+			result[f.index] = arg[:len(arg)-len(f.Value)] + value
+		}
+	}
+	return result
+}
+
+func (a *Args) flagsAt(i int) []Flag {
+	var flags []Flag
+	for _, f := range a.flags {
+		if f.index == i {
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
+
+func (a *Args) rebuildShortFlags(flags []Flag, without []string) []string {
+	shorthands := ""
+	var value []string
+	for _, f := range flags {
+		if contains(without, f.Name) {
+			continue
+		}
+		shorthands += f.shorthand
+		if f.HasValue {
+			if f.valueInNextArg {
+				value = []string{f.Value}
+			} else {
+				shorthands += "=" + f.Value
+			}
+		}
+	}
+	if shorthands == "" {
+		return nil
+	}
+	return append([]string{"-" + shorthands}, value...)
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
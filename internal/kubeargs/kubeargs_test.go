@@ -0,0 +1,391 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeargs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name              string
+		argv              []string
+		expectedVerb      string
+		expectedOperands  []string
+		expectedAfterDash []string
+		expectedValues    map[string]string
+		expectedHas       []string
+		expectedNotHas    []string
+		expectedGlobal    []string
+		expectedNotGlobal []string
+	}{
+		{
+			name:             "flags before the verb",
+			argv:             []string{"-n", "foo", "delete", "pod", "x"},
+			expectedVerb:     "delete",
+			expectedOperands: []string{"pod", "x"},
+			expectedValues:   map[string]string{"namespace": "foo"},
+		},
+		{
+			name:             "long flags with and without equals",
+			argv:             []string{"--context=ctx", "apply", "--filename", "foo.yaml", "--namespace", "bar"},
+			expectedVerb:     "apply",
+			expectedOperands: nil,
+			expectedValues:   map[string]string{"context": "ctx", "filename": "foo.yaml", "namespace": "bar"},
+		},
+		{
+			name:             "confirm flags",
+			argv:             []string{"--contexts", "prod-*", "--continue-on-error", "apply", "-f", "foo.yaml"},
+			expectedVerb:     "apply",
+			expectedOperands: nil,
+			expectedValues:   map[string]string{"contexts": "prod-*", "filename": "foo.yaml"},
+			expectedHas:      []string{"continue-on-error"},
+		},
+		{
+			name:             "values of TLS secret flags in the next arg",
+			argv:             []string{"create", "secret", "tls", "x", "--cert", "tls.crt", "--key", "tls.key"},
+			expectedVerb:     "create",
+			expectedOperands: []string{"secret", "tls", "x"},
+			expectedValues:   map[string]string{"cert": "tls.crt", "key": "tls.key"},
+		},
+		{
+			name:             "values of docker registry flags in the next arg",
+			argv:             []string{"create", "secret", "docker-registry", "x", "--docker-server", "registry.example.com", "--docker-username", "foo"},
+			expectedVerb:     "create",
+			expectedOperands: []string{"secret", "docker-registry", "x"},
+			expectedValues:   map[string]string{"docker-server": "registry.example.com", "docker-username": "foo"},
+		},
+		{
+			name:             "prune allowlist",
+			argv:             []string{"apply", "--prune", "--prune-allowlist", "core/v1/ConfigMap", "-f", "foo.yaml"},
+			expectedVerb:     "apply",
+			expectedOperands: nil,
+			expectedValues:   map[string]string{"prune-allowlist": "core/v1/ConfigMap", "filename": "foo.yaml"},
+			expectedHas:      []string{"prune"},
+		},
+		{
+			name:             "output is not confused with other flags starting with o",
+			argv:             []string{"annotate", "pod", "x", "a=b", "--overwrite"},
+			expectedVerb:     "annotate",
+			expectedOperands: []string{"pod", "x", "a=b"},
+			expectedHas:      []string{"overwrite"},
+			expectedNotHas:   []string{"output"},
+		},
+		{
+			name:             "short flag with attached value",
+			argv:             []string{"version", "-oyaml"},
+			expectedVerb:     "version",
+			expectedOperands: nil,
+			expectedValues:   map[string]string{"output": "yaml"},
+		},
+		{
+			name:              "short flag bundle and dash separator",
+			argv:              []string{"exec", "-it", "foo", "-c", "bar", "--", "sh", "-c", "ls"},
+			expectedVerb:      "exec",
+			expectedOperands:  []string{"foo"},
+			expectedAfterDash: []string{"sh", "-c", "ls"},
+			expectedValues:    map[string]string{"container": "bar"},
+			expectedHas:       []string{"stdin", "tty"},
+		},
+		{
+			name:             "short flag bundle ending with a value flag",
+			argv:             []string{"exec", "-itc", "bar", "foo"},
+			expectedVerb:     "exec",
+			expectedOperands: []string{"foo"},
+			expectedValues:   map[string]string{"container": "bar"},
+			expectedHas:      []string{"stdin", "tty"},
+		},
+		{
+			name:             "optional value flags do not consume the next arg",
+			argv:             []string{"delete", "--dry-run", "pod", "x"},
+			expectedVerb:     "delete",
+			expectedOperands: []string{"pod", "x"},
+			expectedHas:      []string{"dry-run"},
+		},
+		{
+			name:             "verb specific short flags",
+			argv:             []string{"logs", "-f", "foo", "-p"},
+			expectedVerb:     "logs",
+			expectedOperands: []string{"foo"},
+			expectedHas:      []string{"follow", "previous"},
+			expectedNotHas:   []string{"filename"},
+		},
+		{
+			name:             "patch short flag",
+			argv:             []string{"patch", "deploy", "foo", "-p", `{"spec":{}}`},
+			expectedVerb:     "patch",
+			expectedOperands: []string{"deploy", "foo"},
+			expectedValues:   map[string]string{"patch": `{"spec":{}}`},
+		},
+		{
+			name:             "patch file",
+			argv:             []string{"patch", "deploy", "foo", "--patch-file", "patch.yaml"},
+			expectedVerb:     "patch",
+			expectedOperands: []string{"deploy", "foo"},
+			expectedValues:   map[string]string{"patch-file": "patch.yaml"},
+		},
+		{
+			name:             "ports of create service",
+			argv:             []string{"create", "service", "clusterip", "foo", "--tcp", "80:8080"},
+			expectedVerb:     "create",
+			expectedOperands: []string{"service", "clusterip", "foo"},
+			expectedValues:   map[string]string{"tcp": "80:8080"},
+		},
+		{
+			name:             "rules of create ingress",
+			argv:             []string{"create", "ingress", "foo", "--rule", "example.com/=svc:80"},
+			expectedVerb:     "create",
+			expectedOperands: []string{"ingress", "foo"},
+			expectedValues:   map[string]string{"rule": "example.com/=svc:80"},
+		},
+		{
+			name:             "limits of create quota",
+			argv:             []string{"create", "quota", "foo", "--hard", "pods=10"},
+			expectedVerb:     "create",
+			expectedOperands: []string{"quota", "foo"},
+			expectedValues:   map[string]string{"hard": "pods=10"},
+		},
+		{
+			name:             "annotations of run",
+			argv:             []string{"run", "foo", "--image=nginx", "--annotations", "a=b"},
+			expectedVerb:     "run",
+			expectedOperands: []string{"foo"},
+			expectedValues:   map[string]string{"image": "nginx", "annotations": "a=b"},
+		},
+		{
+			name:             "skip wait for delete timeout of drain",
+			argv:             []string{"drain", "node-1", "--skip-wait-for-delete-timeout", "60"},
+			expectedVerb:     "drain",
+			expectedOperands: []string{"node-1"},
+			expectedValues:   map[string]string{"skip-wait-for-delete-timeout": "60"},
+		},
+		{
+			name:             "user is the kubeconfig user",
+			argv:             []string{"get", "pods", "--user", "admin"},
+			expectedVerb:     "get",
+			expectedOperands: []string{"pods"},
+			expectedValues:   map[string]string{"user": "admin"},
+			expectedGlobal:   []string{"user"},
+		},
+		{
+			name:              "user and group of create rolebinding are subjects",
+			argv:              []string{"--user=admin", "create", "rolebinding", "foo", "--role=view", "--user", "bob", "--group", "devs"},
+			expectedVerb:      "create",
+			expectedOperands:  []string{"rolebinding", "foo"},
+			expectedValues:    map[string]string{"role": "view", "group": "devs"},
+			expectedGlobal:    []string{"user"},
+			expectedNotGlobal: []string{"user", "group"},
+		},
+		{
+			name:              "user of create clusterrolebinding is a subject",
+			argv:              []string{"create", "clusterrolebinding", "foo", "--clusterrole=view", "--user", "bob"},
+			expectedVerb:      "create",
+			expectedOperands:  []string{"clusterrolebinding", "foo"},
+			expectedValues:    map[string]string{"clusterrole": "view", "user": "bob"},
+			expectedNotGlobal: []string{"user"},
+		},
+		{
+			name:              "user of set subject is a subject",
+			argv:              []string{"set", "subject", "rolebinding", "foo", "--user", "bob"},
+			expectedVerb:      "set",
+			expectedOperands:  []string{"subject", "rolebinding", "foo"},
+			expectedValues:    map[string]string{"user": "bob"},
+			expectedNotGlobal: []string{"user"},
+		},
+		{
+			name:             "subject flags only apply to their subcommand",
+			argv:             []string{"set", "image", "deploy/foo", "--user", "admin", "app=nginx"},
+			expectedVerb:     "set",
+			expectedOperands: []string{"image", "deploy/foo", "app=nginx"},
+			expectedValues:   map[string]string{"user": "admin"},
+			expectedGlobal:   []string{"user"},
+		},
+		{
+			name:             "stdin filename",
+			argv:             []string{"apply", "-f", "-"},
+			expectedVerb:     "apply",
+			expectedOperands: nil,
+			expectedValues:   map[string]string{"filename": "-"},
+		},
+		{
+			name:         "no verb",
+			argv:         []string{"--help"},
+			expectedVerb: "",
+			expectedHas:  []string{"help"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := Parse(tc.argv)
+			if a.Verb() != tc.expectedVerb {
+				t.Fatalf("wrong verb. expected: %q, got: %q", tc.expectedVerb, a.Verb())
+			}
+			if !reflect.DeepEqual(a.Operands(), tc.expectedOperands) {
+				t.Fatalf("wrong operands. expected: %v, got: %v", tc.expectedOperands, a.Operands())
+			}
+			if !reflect.DeepEqual(a.AfterDash(), tc.expectedAfterDash) {
+				t.Fatalf("wrong args after dash. expected: %v, got: %v", tc.expectedAfterDash, a.AfterDash())
+			}
+			for name, value := range tc.expectedValues {
+				if a.Value(name) != value {
+					t.Fatalf("wrong value for %s. expected: %q, got: %q", name, value, a.Value(name))
+				}
+			}
+			for _, name := range tc.expectedHas {
+				if !a.Has(name) {
+					t.Fatalf("expected flag %s to be found", name)
+				}
+			}
+			for _, name := range tc.expectedNotHas {
+				if a.Has(name) {
+					t.Fatalf("expected flag %s not to be found", name)
+				}
+			}
+			for _, name := range tc.expectedGlobal {
+				if !hasFlag(a, name, true) {
+					t.Fatalf("expected global flag %s to be found", name)
+				}
+			}
+			for _, name := range tc.expectedNotGlobal {
+				if !hasFlag(a, name, false) {
+					t.Fatalf("expected flag %s that is not global to be found", name)
+				}
+			}
+		})
+	}
+}
+
+// hasFlag returns true if a has the flag, and it is global or not as specified
+func hasFlag(a *Args, name string, global bool) bool {
+	for _, f := range a.Flags() {
+		if f.Name == name && f.Global == global {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValues(t *testing.T) {
+	a := Parse([]string{"apply", "-f", "a.yaml", "--filename=b.yaml", "-fc.yaml"})
+	expected := []string{"a.yaml", "b.yaml", "c.yaml"}
+	if !reflect.DeepEqual(a.Values("filename"), expected) {
+		t.Fatalf("wrong values. expected: %v, got: %v", expected, a.Values("filename"))
+	}
+}
+
+func TestGlobalFlagArgs(t *testing.T) {
+	a := Parse([]string{"--kubeconfig", "/tmp/config", "-n", "foo", "apply", "-f", "x.yaml", "--as=admin", "--insecure-skip-tls-verify"})
+	expected := []string{"--kubeconfig=/tmp/config", "--as=admin", "--insecure-skip-tls-verify"}
+	if actual := a.GlobalFlagArgs("namespace"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("wrong global flags. expected: %v, got: %v", expected, actual)
+	}
+}
+
+func TestGlobalValue(t *testing.T) {
+	a := Parse([]string{"--user=admin", "create", "rolebinding", "foo", "--role=view", "--user", "bob"})
+	if actual := a.GlobalValue("user"); actual != "admin" {
+		t.Fatalf("wrong global value. expected: %q, got: %q", "admin", actual)
+	}
+	if actual := a.GlobalValue("role"); actual != "" {
+		t.Fatalf("expected no global value, got: %q", actual)
+	}
+}
+
+func TestWithout(t *testing.T) {
+	testCases := []struct {
+		name     string
+		argv     []string
+		without  []string
+		expected []string
+	}{
+		{
+			name:     "long flags",
+			argv:     []string{"--context", "ctx", "apply", "--dry-run=server", "-f", "x.yaml"},
+			without:  []string{"context", "dry-run"},
+			expected: []string{"apply", "-f", "x.yaml"},
+		},
+		{
+			name:     "short flag bundle",
+			argv:     []string{"exec", "-itn", "foo", "bar", "--", "sh", "-n"},
+			without:  []string{"namespace"},
+			expected: []string{"exec", "-it", "bar", "--", "sh", "-n"},
+		},
+		{
+			name:     "short flag with attached value",
+			argv:     []string{"get", "-oyaml", "-n=foo", "pods"},
+			without:  []string{"namespace"},
+			expected: []string{"get", "-oyaml", "pods"},
+		},
+		{
+			name:     "nothing removed",
+			argv:     []string{"get", "-o", "yaml", "pods"},
+			without:  []string{"namespace"},
+			expected: []string{"get", "-o", "yaml", "pods"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := Parse(tc.argv).Without(tc.without...); !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("wrong args. expected: %v, got: %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWith(t *testing.T) {
+	testCases := []struct {
+		name     string
+		argv     []string
+		expected []string
+	}{
+		{
+			name:     "no dash",
+			argv:     []string{"apply", "-f", "x.yaml"},
+			expected: []string{"apply", "-f", "x.yaml", "--dry-run=server"},
+		},
+		{
+			name:     "before dash",
+			argv:     []string{"run", "foo", "--image=busybox", "--", "sleep", "10"},
+			expected: []string{"run", "foo", "--image=busybox", "--dry-run=server", "--", "sleep", "10"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := Parse(tc.argv).With("--dry-run=server"); !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("wrong args. expected: %v, got: %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReplaceValues(t *testing.T) {
+	a := Parse([]string{"--token", "abc", "create", "secret", "generic", "x", "--from-literal=k=v", "-n", "foo", "--", "--token=def"})
+	actual := a.ReplaceValues(func(f Flag) (string, bool) {
+		return "***", f.Name == "token" || f.Name == "from-literal"
+	})
+	expected := []string{"--token", "***", "create", "secret", "generic", "x", "--from-literal=***", "-n", "foo", "--", "--token=def"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("wrong args. expected: %v, got: %v", expected, actual)
+	}
+	if a.Value("token") != "abc" {
+		t.Fatalf("expected the original args to be unchanged, got %v", a.Raw())
+	}
+}
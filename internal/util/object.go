@@ -0,0 +1,109 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// NestedField returns the value found by following fields into obj, or nil if any of them does not exist
+func NestedField(obj interface{}, fields ...string) interface{} {
+	value := obj
+	for _, field := range fields {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[field]
+	}
+	return value
+}
+
+// NestedMap returns the map found by following fields into obj, or nil if it does not exist
+func NestedMap(obj interface{}, fields ...string) map[string]interface{} {
+	m, _ := NestedField(obj, fields...).(map[string]interface{})
+	return m
+}
+
+// NestedSlice returns the slice found by following fields into obj, or nil if it does not exist
+func NestedSlice(obj interface{}, fields ...string) []interface{} {
+	s, _ := NestedField(obj, fields...).([]interface{})
+	return s
+}
+
+// NestedString returns the string found by following fields into obj, or an empty string if it does not exist
+func NestedString(obj interface{}, fields ...string) string {
+	s, _ := NestedField(obj, fields...).(string)
+	return s
+}
+
+// NestedInt64 returns the number found by following fields into obj, and whether it was found
+func NestedInt64(obj interface{}, fields ...string) (int64, bool) {
+	switch v := NestedField(obj, fields...).(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return int64(f), true
+		}
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// ObjectItems returns the items of a List object, or the object itself if it is not a List
+func ObjectItems(obj map[string]interface{}) []map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+	if !strings.HasSuffix(NestedString(obj, "kind"), "List") {
+		return []map[string]interface{}{obj}
+	}
+	var items []map[string]interface{}
+	for _, item := range NestedSlice(obj, "items") {
+		if m, ok := item.(map[string]interface{}); ok {
+			items = append(items, m)
+		}
+	}
+	return items
+}
+
+// ObjectGroup returns the API group of obj, or an empty string for the core group
+func ObjectGroup(obj map[string]interface{}) string {
+	apiVersion := NestedString(obj, "apiVersion")
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+	return ""
+}
+
+// ObjectName returns the name of obj in the same form kubectl prints it, for example deployment.apps/foo
+func ObjectName(obj map[string]interface{}) string {
+	resource := strings.ToLower(NestedString(obj, "kind"))
+	if group := ObjectGroup(obj); group != "" {
+		resource += "." + group
+	}
+	return fmt.Sprintf("%s/%s", resource, NestedString(obj, "metadata", "name"))
+}
@@ -18,8 +18,11 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"reflect"
+	"sync"
 
 	"github.com/spf13/cobra"
 )
@@ -27,6 +30,7 @@ import (
 // NewTestCommand creates a new cobra command for testing, with the specified stdin, stdout, and stderr
 func NewTestCommand() (*cobra.Command, *bytes.Buffer, *bytes.Buffer, *bytes.Buffer) {
 	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
 	stdin := &bytes.Buffer{}
 	cmd.SetIn(stdin)
 	stdout := &bytes.Buffer{}
@@ -36,8 +40,9 @@ func NewTestCommand() (*cobra.Command, *bytes.Buffer, *bytes.Buffer, *bytes.Buff
 	return cmd, stdin, stdout, stderr
 }
 
-// FakeExecRunner is used to mock external program execution
+// FakeExecRunner is used to mock external program execution. It is safe to use from multiple goroutines.
 type FakeExecRunner struct {
+	mu           sync.Mutex
 	fakeExecRuns []fakeExecRun
 	RunNames     []string
 	RunArgs      [][]string
@@ -47,6 +52,9 @@ type fakeExecRun struct {
 	Stdout string
 	Stderr string
 	Error  error
+	Action func(args []string) error
+	// Match selects the runs this fake run is used for, or any run if it is nil
+	Match func(args []string) bool
 }
 
 // NewFakeExecRunner creates a new instance of FakeExecRunner
@@ -65,30 +73,81 @@ func (f *FakeExecRunner) SetupRun(stdout, stderr string, err error) {
 	})
 }
 
+// SetupRunMatching enqueues a new mocked run that is only used for a run whose args match, which is needed when runs
+// happen concurrently and their order is not known
+func (f *FakeExecRunner) SetupRunMatching(match func(args []string) bool, stdout, stderr string, err error) {
+	f.fakeExecRuns = append(f.fakeExecRuns, fakeExecRun{
+		Stdout: stdout,
+		Stderr: stderr,
+		Error:  err,
+		Match:  match,
+	})
+}
+
+// ArgsContain returns a matcher for SetupRunMatching that matches runs whose args contain arg
+func ArgsContain(arg string) func(args []string) bool {
+	return func(args []string) bool {
+		for _, a := range args {
+			if a == arg {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SetupRunWithAction enqueues a new mocked run of an executable that calls action with the args it was run with,
+// which can be used to simulate side effects such as an editor modifying a file
+func (f *FakeExecRunner) SetupRunWithAction(action func(args []string) error) {
+	f.fakeExecRuns = append(f.fakeExecRuns, fakeExecRun{
+		Action: action,
+	})
+}
+
 // LastRunName returns the name of the last execRun
 func (f *FakeExecRunner) LastRunName() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	return f.RunNames[len(f.RunNames)-1]
 }
 
 // LastRunArgs returns the args of the last execRun
 func (f *FakeExecRunner) LastRunArgs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	return f.RunArgs[len(f.RunArgs)-1]
 }
 
+// HasRunArgs returns true if an execRun was called with args, regardless of the order of the runs
+func (f *FakeExecRunner) HasRunArgs(args []string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, runArgs := range f.RunArgs {
+		if reflect.DeepEqual(runArgs, args) {
+			return true
+		}
+	}
+	return false
+}
+
 // RunCount returns the number of times execRun was called
 func (f *FakeExecRunner) RunCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	return len(f.RunNames)
 }
 
-func (f *FakeExecRunner) execRun(name string, args []string, _ io.Reader, stdout, stderr io.Writer) error {
-	f.RunNames = append(f.RunNames, name)
-	f.RunArgs = append(f.RunArgs, args)
+func (f *FakeExecRunner) execRun(_ context.Context, name string, args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	thisRun, err := f.nextRun(name, args)
+	if err != nil {
+		return err
+	}
 
-	if len(f.fakeExecRuns) == 0 {
-		return fmt.Errorf("there are no more fake exec runs")
+	if thisRun.Action != nil {
+		if err := thisRun.Action(args); err != nil {
+			return err
+		}
 	}
-	thisRun := f.fakeExecRuns[0]
-	f.fakeExecRuns = f.fakeExecRuns[1:]
 
 	if thisRun.Stdout != "" {
 		if _, err := stdout.Write(bytes.NewBufferString(thisRun.Stdout).Bytes()); err != nil {
@@ -102,3 +161,19 @@ func (f *FakeExecRunner) execRun(name string, args []string, _ io.Reader, stdout
 	}
 	return thisRun.Error
 }
+
+// nextRun records a run and returns the first fake run that matches it
+func (f *FakeExecRunner) nextRun(name string, args []string) (fakeExecRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.RunNames = append(f.RunNames, name)
+	f.RunArgs = append(f.RunArgs, args)
+
+	for i, run := range f.fakeExecRuns {
+		if run.Match == nil || run.Match(args) {
+			f.fakeExecRuns = append(f.fakeExecRuns[:i], f.fakeExecRuns[i+1:]...)
+			return run, nil
+		}
+	}
+	return fakeExecRun{}, fmt.Errorf("there are no more fake exec runs for %v", args)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Number of unchanged lines shown around each change in a unified diff
+const diffContextLines = 3
+
+type diffLine struct {
+	op   byte
+	text string
+	a, b int
+}
+
+// UnifiedDiff returns a unified diff of two texts, labeled with fromName and toName, or an empty string if the texts
+// are identical.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+	for start := 0; start < len(lines); {
+		// Find the next change
+		for start < len(lines) && lines[start].op == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+		// Extend the hunk until there is a long enough run of unchanged lines
+		end := start
+		for i := start; i < len(lines); i++ {
+			if lines[i].op != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContextLines {
+				break
+			}
+		}
+		hunkStart := start - diffContextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := end + diffContextLines
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+		writeHunk(&sb, lines[hunkStart:hunkEnd])
+		start = hunkEnd
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, lines []diffLine) {
+	aStart, bStart, aCount, bCount := -1, -1, 0, 0
+	for _, l := range lines {
+		if l.op != '+' {
+			if aStart < 0 {
+				aStart = l.a
+			}
+			aCount++
+		}
+		if l.op != '-' {
+			if bStart < 0 {
+				bStart = l.b
+			}
+			bCount++
+		}
+	}
+	sb.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aStart, aCount, lines[0].a), hunkRange(bStart, bCount, lines[0].b)))
+	for _, l := range lines {
+		sb.WriteByte(l.op)
+		sb.WriteString(l.text)
+		sb.WriteByte('\n')
+	}
+}
+
+func hunkRange(start, count, fallback int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", fallback)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the longest common subsequence of a and b and returns the resulting edit script
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{op: ' ', text: a[i], a: i, b: j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{op: '-', text: a[i], a: i, b: j})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', text: b[j], a: i, b: j})
+			j++
+		}
+	}
+	return lines
+}
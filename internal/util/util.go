@@ -17,9 +17,14 @@ limitations under the License.
 package util
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
+	"runtime"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -39,25 +44,96 @@ func GetKubectlPath() string {
 	return "kubectl"
 }
 
-// HasOutputFlag returns try if osArgs contains -o or --output
-func HasOutputFlag() bool {
-	for _, a := range os.Args {
-		if strings.HasPrefix(a, "-o") || strings.HasPrefix(a, "--output") {
-			return true
+// GetEditor returns the command that should be used to edit files. It is taken from the KUBE_EDITOR or EDITOR
+// environment variables, in that order, and falls back to vi (or notepad on Windows) if neither is set.
+func GetEditor() []string {
+	for _, name := range []string{"KUBE_EDITOR", "EDITOR"} {
+		if editor := strings.Fields(os.Getenv(name)); len(editor) > 0 {
+			return editor
 		}
 	}
-	return false
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
 }
 
-// ExecRun runs the specified executable with args and the specified stdin, stdout, and stderr
-var ExecRun = func(name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
-	cmd := exec.Command(name, args...)
+// ExecRunner runs an executable with args and the specified stdin, stdout, and stderr, like ExecRun. Tools that embed
+// kubectl confirm can pass their own, to control how kubectl is run.
+type ExecRunner func(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+// ExecRun runs the specified executable with args and the specified stdin, stdout, and stderr. The process is killed
+// if ctx is done before it exits.
+var ExecRun = func(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	return cmd.Run()
 }
 
+// ExecKubectlJSON runs kubectl with run and the specified args, and decodes its stdout as JSON into v. If kubectl
+// prints nothing, like when --ignore-not-found is used and nothing is found, v is left unchanged.
+func ExecKubectlJSON(ctx context.Context, run ExecRunner, args []string, stdin io.Reader, v interface{}) error {
+	_, err := ExecKubectlJSONWithWarnings(ctx, run, args, stdin, v)
+	return err
+}
+
+// ExecKubectlJSONWithWarnings is like ExecKubectlJSON, but also returns the warnings kubectl printed to stderr, like
+// API deprecation warnings and admission webhook warnings
+func ExecKubectlJSONWithWarnings(ctx context.Context, run ExecRunner, args []string, stdin io.Reader, v interface{}) ([]string, error) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	if err := run(ctx, GetKubectlPath(), args, stdin, &stdout, &stderr); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	warnings := ParseWarnings(stderr.String())
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return warnings, nil
+	}
+	return warnings, UnmarshalJSON(stdout.Bytes(), v)
+}
+
+// UnmarshalJSON decodes JSON like json.Unmarshal, but keeps numbers as json.Number, so that large integers, like
+// 12345678901234567890, keep all of their digits when objects are printed, saved, or edited
+func UnmarshalJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// ParseWarnings returns the warnings in the stderr of kubectl, which are the lines that start with "Warning: ", without
+// that prefix
+func ParseWarnings(stderr string) []string {
+	var warnings []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Warning: ") {
+			warnings = append(warnings, strings.TrimPrefix(line, "Warning: "))
+		}
+	}
+	return warnings
+}
+
+// IsTerminal returns true if w is a terminal
+var IsTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
 // IsNonRegularFile returns true if the file is not a regular file
 var IsNonRegularFile = func(name string) bool {
 	fi, err := os.Stat(name)
@@ -17,7 +17,10 @@ limitations under the License.
 package util
 
 import (
+	"context"
+	"io"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -32,3 +35,53 @@ func TestGetKubectlPath(t *testing.T) {
 		t.Fatalf("expected getKubectlPath to return \"foo\", but it was %q", path)
 	}
 }
+
+func TestGetEditor(t *testing.T) {
+	_ = os.Unsetenv("KUBE_EDITOR")
+	_ = os.Unsetenv("EDITOR")
+	if editor := GetEditor(); !reflect.DeepEqual(editor, []string{"vi"}) {
+		t.Fatalf("expected GetEditor to return [vi], but it was %v", editor)
+	}
+
+	_ = os.Setenv("EDITOR", "nano")
+	defer os.Unsetenv("EDITOR")
+	if editor := GetEditor(); !reflect.DeepEqual(editor, []string{"nano"}) {
+		t.Fatalf("expected GetEditor to return [nano], but it was %v", editor)
+	}
+
+	_ = os.Setenv("KUBE_EDITOR", "code --wait")
+	defer os.Unsetenv("KUBE_EDITOR")
+	if editor := GetEditor(); !reflect.DeepEqual(editor, []string{"code", "--wait"}) {
+		t.Fatalf("expected GetEditor to return [code --wait], but it was %v", editor)
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	stderr := "Warning: apps/v1beta1 Deployment is deprecated in v1.9+, unavailable in v1.16+\nsome other output\n  Warning: policy-webhook: image tag latest is discouraged\n"
+	expected := []string{
+		"apps/v1beta1 Deployment is deprecated in v1.9+, unavailable in v1.16+",
+		"policy-webhook: image tag latest is discouraged",
+	}
+	if actual := ParseWarnings(stderr); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("wrong warnings.\nexpected: %q\ngot: %q", expected, actual)
+	}
+	if actual := ParseWarnings(""); actual != nil {
+		t.Fatalf("expected no warnings, got %q", actual)
+	}
+}
+
+func TestExecKubectlJSON(t *testing.T) {
+	var actualArgs []string
+	run := func(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		actualArgs = append([]string{name}, args...)
+		_, err := io.WriteString(stdout, `{"kind": "Pod"}`)
+		return err
+	}
+	var result map[string]interface{}
+	if err := ExecKubectlJSON(context.Background(), run, []string{"get", "pod", "foo", "-o", "json"}, nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actualArgs, []string{"kubectl", "get", "pod", "foo", "-o", "json"}) || result["kind"] != "Pod" {
+		t.Fatalf("expected the runner to be used, got %v, %v", actualArgs, result)
+	}
+}
@@ -0,0 +1,370 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yaml
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Header identifies an object in a manifest
+type Header struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+}
+
+// ReadHeaders returns the header of each object in a manifest, which is a stream of YAML documents, like the output of
+// kubectl kustomize or helm template, or a JSON object. Only the apiVersion, kind, and metadata of each document are
+// read, so the rest of the document can be anything. Documents without a kind, like empty ones, are skipped. The items
+// of a List are returned instead of the List itself. Metadata and items can be flow mappings, like {name: foo}, if
+// they are written on one line.
+func ReadHeaders(data []byte) []Header {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(trimmed), &obj); err == nil {
+			return jsonHeaders(obj)
+		}
+	}
+
+	var headers []Header
+	var document []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "---" || strings.HasPrefix(line, "--- ") || line == "..." {
+			headers = append(headers, documentHeaders(document)...)
+			document = nil
+			continue
+		}
+		document = append(document, line)
+	}
+	return append(headers, documentHeaders(document)...)
+}
+
+// documentHeaders returns the header of the object in the lines of a YAML document, or the headers of its items if it
+// is a List
+func documentHeaders(lines []string) []Header {
+	var h Header
+	topLevelKey := ""
+	metadataIndent := -1
+	var items []string
+	for _, line := range lines {
+		content := strings.TrimLeft(line, " ")
+		if len(content) == 0 || strings.HasPrefix(content, "#") {
+			continue
+		}
+		indent := len(line) - len(content)
+		key, value, isKey := splitKey(content)
+		// The items of a List may be written without an indent
+		if indent == 0 && !strings.HasPrefix(content, "-") {
+			topLevelKey = ""
+			if !isKey {
+				continue
+			}
+			topLevelKey = key
+			switch key {
+			case "apiVersion":
+				h.APIVersion = value
+			case "kind":
+				h.Kind = value
+			case "items":
+				items = []string{}
+			case "metadata":
+				if metadata, ok := parseFlowMapping(value); ok {
+					h.Name = stringField(metadata, "name")
+					h.Namespace = stringField(metadata, "namespace")
+				}
+			}
+			continue
+		}
+		if topLevelKey == "items" {
+			items = append(items, line)
+			continue
+		}
+		if topLevelKey != "metadata" {
+			continue
+		}
+		// The fields of metadata are the lines with the same indent as its first field
+		if metadataIndent < 0 {
+			metadataIndent = indent
+		}
+		if indent != metadataIndent || !isKey {
+			continue
+		}
+		switch key {
+		case "name":
+			h.Name = value
+		case "namespace":
+			h.Namespace = value
+		}
+	}
+	if strings.HasSuffix(h.Kind, "List") && items != nil {
+		return itemHeaders(items)
+	}
+	if len(h.Kind) == 0 {
+		return nil
+	}
+	return []Header{h}
+}
+
+// itemHeaders returns the headers of the objects in the lines of the items of a List, which is a block sequence of
+// mappings
+func itemHeaders(lines []string) []Header {
+	var headers []Header
+	var item []string
+	itemIndent := -1
+	flush := func() {
+		headers = append(headers, documentHeaders(item)...)
+		item = nil
+	}
+	for _, line := range lines {
+		content := strings.TrimLeft(line, " ")
+		if len(content) == 0 || strings.HasPrefix(content, "#") {
+			continue
+		}
+		indent := len(line) - len(content)
+		if itemIndent < 0 {
+			itemIndent = indent
+		}
+		if indent == itemIndent && (strings.HasPrefix(content, "- ") || content == "-") {
+			flush()
+			rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+			if obj, ok := parseFlowMapping(scalarValue(rest)); ok {
+				headers = append(headers, jsonHeaders(obj)...)
+				continue
+			}
+			indent = len(line) - len(rest)
+			line = strings.Repeat(" ", indent) + rest
+		}
+		// The fields of an item are indented by two more spaces than its dash, at least
+		if indent > itemIndent+2 {
+			indent = itemIndent + 2
+		}
+		item = append(item, line[indent:])
+	}
+	flush()
+	return headers
+}
+
+func jsonHeaders(obj map[string]interface{}) []Header {
+	if items, found := obj["items"].([]interface{}); found && strings.HasSuffix(stringField(obj, "kind"), "List") {
+		var headers []Header
+		for _, item := range items {
+			if itemObj, ok := item.(map[string]interface{}); ok {
+				headers = append(headers, jsonHeaders(itemObj)...)
+			}
+		}
+		return headers
+	}
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	h := Header{
+		APIVersion: stringField(obj, "apiVersion"),
+		Kind:       stringField(obj, "kind"),
+		Name:       stringField(metadata, "name"),
+		Namespace:  stringField(metadata, "namespace"),
+	}
+	if len(h.Kind) == 0 {
+		return nil
+	}
+	return []Header{h}
+}
+
+func stringField(obj map[string]interface{}, name string) string {
+	s, _ := obj[name].(string)
+	return s
+}
+
+// splitKey splits a line of a block mapping into its key and scalar value. It returns false if the line is not a
+// key, like an item of a list.
+func splitKey(content string) (string, string, bool) {
+	if strings.HasPrefix(content, "- ") || content == "-" {
+		return "", "", false
+	}
+	var key, rest string
+	if content[0] == '"' || content[0] == '\'' {
+		end := strings.IndexByte(content[1:], content[0]) + 1
+		if end == 0 || !strings.HasPrefix(content[end+1:], ":") {
+			return "", "", false
+		}
+		rest = content[end+2:]
+		if len(rest) > 0 && rest[0] != ' ' {
+			return "", "", false
+		}
+		key = unquote(content[:end+1])
+	} else {
+		i := strings.Index(content, ": ")
+		switch {
+		case i >= 0:
+			key, rest = content[:i], content[i+2:]
+		case strings.HasSuffix(content, ":"):
+			key = strings.TrimSuffix(content, ":")
+		default:
+			return "", "", false
+		}
+	}
+	return key, scalarValue(strings.TrimSpace(rest)), true
+}
+
+// scalarValue returns the value of a plain or quoted scalar, without a trailing comment
+func scalarValue(s string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		if end := strings.LastIndexByte(s, s[0]); end > 0 {
+			return unquote(s[:end+1])
+		}
+		return s
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
+
+// parseFlowMapping parses a flow mapping written on one line, like {name: foo, labels: {app: bar}}, into a map whose
+// values are strings, maps, and slices. It returns false if s is not a flow mapping.
+func parseFlowMapping(s string) (map[string]interface{}, bool) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, false
+	}
+	p := &flowParser{s: s}
+	m, ok := p.value().(map[string]interface{})
+	if !ok || p.err || strings.TrimSpace(p.s[p.i:]) != "" {
+		return nil, false
+	}
+	return m, true
+}
+
+// flowParser parses flow collections, and the scalars in them
+type flowParser struct {
+	s   string
+	i   int
+	err bool
+}
+
+func (p *flowParser) skipSpaces() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+// value parses a flow mapping, flow sequence, or scalar
+func (p *flowParser) value() interface{} {
+	p.skipSpaces()
+	if p.i >= len(p.s) {
+		p.err = true
+		return nil
+	}
+	switch p.s[p.i] {
+	case '{':
+		m := map[string]interface{}{}
+		p.collection('}', func() {
+			key, _ := p.scalar(true).(string)
+			p.skipSpaces()
+			if p.i < len(p.s) && p.s[p.i] == ':' {
+				p.i++
+				m[key] = p.value()
+			} else {
+				m[key] = nil
+			}
+		})
+		return m
+	case '[':
+		var items []interface{}
+		p.collection(']', func() {
+			items = append(items, p.value())
+		})
+		return items
+	default:
+		return p.scalar(false)
+	}
+}
+
+// collection parses the comma separated entries of a flow collection up to its closing bracket
+func (p *flowParser) collection(closing byte, entry func()) {
+	p.i++
+	for !p.err {
+		p.skipSpaces()
+		if p.i >= len(p.s) {
+			p.err = true
+			return
+		}
+		if p.s[p.i] == closing {
+			p.i++
+			return
+		}
+		entry()
+		p.skipSpaces()
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			p.i++
+		} else if p.i >= len(p.s) || p.s[p.i] != closing {
+			p.err = true
+		}
+	}
+}
+
+// scalar parses a plain or quoted scalar. The plain scalar of a key ends at a colon that is followed by a space or the
+// end of the entry.
+func (p *flowParser) scalar(key bool) interface{} {
+	p.skipSpaces()
+	if p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+		quote := p.s[p.i]
+		end := p.i + 1
+		for end < len(p.s) {
+			if p.s[end] == '\\' && quote == '"' {
+				end += 2
+				continue
+			}
+			if p.s[end] == quote {
+				if quote == '\'' && end+1 < len(p.s) && p.s[end+1] == '\'' {
+					end += 2
+					continue
+				}
+				break
+			}
+			end++
+		}
+		if end >= len(p.s) {
+			p.err = true
+			return nil
+		}
+		s := unquote(p.s[p.i : end+1])
+		p.i = end + 1
+		return s
+	}
+	start := p.i
+	for p.i < len(p.s) && !strings.ContainsRune(",}]", rune(p.s[p.i])) {
+		if key && p.s[p.i] == ':' && (p.i+1 == len(p.s) || strings.ContainsRune(" ,}]", rune(p.s[p.i+1]))) {
+			break
+		}
+		p.i++
+	}
+	return strings.TrimSpace(p.s[start:p.i])
+}
+
+func unquote(s string) string {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s[1 : len(s)-1]
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadHeaders(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected []Header
+	}{
+		{
+			name: "documents",
+			data: `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    name: not-the-name
+  name: app
+  namespace: "prod" # quoted
+spec:
+  template:
+    metadata:
+      namespace: not-the-namespace
+---
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  script: |
+    kind: NotAKind
+metadata:
+    'name': 'app''s config'
+...
+`,
+			expected: []Header{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", Namespace: "prod"},
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "app's config"},
+			},
+		},
+		{
+			name: "json list",
+			data: `{"apiVersion": "v1", "kind": "List", "items": [{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "a", "namespace": "b"}}]}`,
+			expected: []Header{
+				{APIVersion: "v1", Kind: "Service", Name: "a", Namespace: "b"},
+			},
+		},
+		{
+			name: "yaml list",
+			data: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: a
+    namespace: b
+  spec:
+    selector:
+      name: not-the-name
+- kind: ConfigMap
+  apiVersion: v1
+  metadata: {name: c}
+- {apiVersion: apps/v1, kind: Deployment, metadata: {name: d, namespace: e, labels: {app: d}}}
+metadata:
+  resourceVersion: ""
+---
+apiVersion: v1
+kind: ServiceList
+items:
+  # indented items
+  - apiVersion: v1
+    kind: Service
+    metadata:
+      name: f
+`,
+			expected: []Header{
+				{APIVersion: "v1", Kind: "Service", Name: "a", Namespace: "b"},
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "c"},
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "d", Namespace: "e"},
+				{APIVersion: "v1", Kind: "Service", Name: "f"},
+			},
+		},
+		{
+			name: "empty list",
+			data: "apiVersion: v1\nkind: List\nitems: []\n",
+		},
+		{
+			name: "flow metadata",
+			data: `apiVersion: v1
+kind: ConfigMap
+metadata: {name: "a, b", 'namespace': c, annotations: {example.com/url: "http://x"}} # comment
+---
+apiVersion: v1
+kind: Secret
+metadata: {}
+`,
+			expected: []Header{
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "a, b", Namespace: "c"},
+				{APIVersion: "v1", Kind: "Secret"},
+			},
+		},
+		{
+			name: "empty",
+			data: "---\n# nothing\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := ReadHeaders([]byte(tc.data))
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("wrong headers.\nexpected: %+v\ngot: %+v", tc.expected, actual)
+			}
+		})
+	}
+}
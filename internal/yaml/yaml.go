@@ -0,0 +1,207 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package yaml converts decoded JSON values to YAML, formatted the same way kubectl formats YAML output, and reads the
+// headers of the objects in YAML manifests
+package yaml
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Marshal returns the YAML representation of v, which must be a value decoded from JSON, like a
+// map[string]interface{}. Map keys are sorted.
+func Marshal(v interface{}) string {
+	sb := strings.Builder{}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			return "{}\n"
+		}
+		writeMap(&sb, value, 0)
+	case []interface{}:
+		if len(value) == 0 {
+			return "[]\n"
+		}
+		writeSlice(&sb, value, 0)
+	default:
+		sb.WriteString(scalar(value, 0))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func writeMap(sb *strings.Builder, m map[string]interface{}, indent int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sb.WriteString(strings.Repeat(" ", indent))
+		sb.WriteString(quote(k))
+		sb.WriteString(":")
+		writeValue(sb, m[k], indent, indent+2)
+	}
+}
+
+func writeSlice(sb *strings.Builder, s []interface{}, indent int) {
+	for _, item := range s {
+		sb.WriteString(strings.Repeat(" ", indent))
+		sb.WriteString("-")
+		// The first line of a map or list in a list goes on the same line as the dash
+		sub := strings.Builder{}
+		if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+			writeMap(&sub, m, indent+2)
+		} else if s, ok := item.([]interface{}); ok && len(s) > 0 {
+			writeSlice(&sub, s, indent+2)
+		}
+		if sub.Len() > 0 {
+			sb.WriteString(" ")
+			sb.WriteString(sub.String()[indent+2:])
+			continue
+		}
+		writeValue(sb, item, indent, indent+2)
+	}
+}
+
+// writeValue writes a value that follows a key or a dash. Lists in maps are not indented further than their key, which
+// is how kubectl formats them.
+func writeValue(sb *strings.Builder, v interface{}, indent, childIndent int) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			sb.WriteString(" {}\n")
+			return
+		}
+		sb.WriteString("\n")
+		writeMap(sb, value, childIndent)
+	case []interface{}:
+		if len(value) == 0 {
+			sb.WriteString(" []\n")
+			return
+		}
+		sb.WriteString("\n")
+		writeSlice(sb, value, indent)
+	default:
+		sb.WriteString(" ")
+		sb.WriteString(scalar(value, childIndent))
+		sb.WriteString("\n")
+	}
+}
+
+func scalar(v interface{}, indent int) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case json.Number:
+		return value.String()
+	case string:
+		if strings.Contains(value, "\n") && !hasControlCharacters(value) {
+			return literal(value, indent)
+		}
+		return quote(value)
+	default:
+		return quote(fmt.Sprint(value))
+	}
+}
+
+// literal returns a multi-line string as a literal block
+func literal(s string, indent int) string {
+	header := "|"
+	if !strings.HasSuffix(s, "\n") {
+		header = "|-"
+	} else {
+		s = strings.TrimSuffix(s, "\n")
+		if strings.HasSuffix(s, "\n") {
+			header = "|+"
+		}
+	}
+	if strings.HasPrefix(s, " ") {
+		header += "2"
+	}
+	sb := strings.Builder{}
+	sb.WriteString(header)
+	for _, line := range strings.Split(s, "\n") {
+		sb.WriteString("\n")
+		if line != "" {
+			sb.WriteString(strings.Repeat(" ", indent))
+			sb.WriteString(line)
+		}
+	}
+	return sb.String()
+}
+
+// quote returns s as it must be written in YAML to be read back as the same string
+func quote(s string) string {
+	if needsQuotes(s) {
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+	return s
+}
+
+func needsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "~", "null", "true", "false", "yes", "no", "y", "n", "on", "off", ".inf", "-.inf", ".nan":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") && !(s[0] == '-' && len(s) > 1 && s[1] != ' ' && !isNumberStart(s[1])) {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// hasControlCharacters returns true if s has control characters other than newlines and tabs, which cannot be written
+// in a literal block. Carriage returns would be read back as line breaks, and other control characters are not allowed
+// in YAML unless they are escaped in a double-quoted string.
+func hasControlCharacters(s string) bool {
+	for _, r := range s {
+		if (r < ' ' && r != '\n' && r != '\t') || r == 0x7f || r == '\u0085' || r == '\u2028' || r == '\u2029' || r == '\ufeff' {
+			return true
+		}
+	}
+	return false
+}
+
+func isNumberStart(c byte) bool {
+	return c == '.' || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package yaml
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	testCases := []struct {
+		name     string
+		json     string
+		expected string
+	}{
+		{
+			name: "object",
+			json: `{"kind": "Deployment", "apiVersion": "apps/v1", "metadata": {"name": "foo", "labels": {}}, "spec": {"replicas": 3, "paused": false}}`,
+			expected: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels: {}
+  name: foo
+spec:
+  paused: false
+  replicas: 3
+`,
+		},
+		{
+			name: "lists",
+			json: `{"spec": {"containers": [{"name": "foo", "args": ["a", "b"], "ports": []}, {"name": "bar"}], "matrix": [[1, 2], []]}}`,
+			expected: `spec:
+  containers:
+  - args:
+    - a
+    - b
+    name: foo
+    ports: []
+  - name: bar
+  matrix:
+  - - 1
+    - 2
+  - []
+`,
+		},
+		{
+			name: "strings that need quotes",
+			json: `{"a": "true", "b": "123", "c": "", "d": "a: b", "e": " x", "f": "*", "g": "0x1F", "h": "null", "i": "-foo", "j": "-", "k": "1.5", "l": "on"}`,
+			expected: `a: "true"
+b: "123"
+c: ""
+d: "a: b"
+e: " x"
+f: "*"
+g: "0x1F"
+h: "null"
+i: -foo
+j: "-"
+k: "1.5"
+l: "on"
+`,
+		},
+		{
+			name: "multi-line strings",
+			json: `{"data": {"a": "line 1\nline 2\n", "b": "line 1\n\nline 3"}}`,
+			expected: `data:
+  a: |
+    line 1
+    line 2
+  b: |-
+    line 1
+
+    line 3
+`,
+		},
+		{
+			name:     "multi-line strings with control characters",
+			json:     `{"data": {"a": "line 1\r\nline 2\r\n", "b": "a\u0000\nb", "c": "a\tb\nc"}}`,
+			expected: "data:\n  a: \"line 1\\r\\nline 2\\r\\n\"\n  b: \"a\\u0000\\nb\"\n  c: |-\n    a\tb\n    c\n",
+		},
+		{
+			name:     "null and numbers",
+			json:     `{"a": null, "b": 1.5, "c": 10000000, "d": 12345678901234567890, "e": 1e-7}`,
+			expected: "a: null\nb: 1.5\nc: 10000000\nd: 12345678901234567890\ne: 1e-7\n",
+		},
+		{
+			name:     "empty object",
+			json:     `{}`,
+			expected: "{}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Numbers are decoded the same way as the objects kubectl returns, so that they keep all of their digits
+			decoder := json.NewDecoder(strings.NewReader(tc.json))
+			decoder.UseNumber()
+			var v interface{}
+			if err := decoder.Decode(&v); err != nil {
+				t.Fatalf("invalid test json: %v", err)
+			}
+			if actual := Marshal(v); actual != tc.expected {
+				t.Fatalf("wrong yaml\nexpected:\n%s\ngot:\n%s\n", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// apiDeprecation is an API version of a kind that is deprecated, and removed in a later Kubernetes version. Versions
+// are minor versions of Kubernetes 1.x.
+type apiDeprecation struct {
+	apiVersion   string
+	kinds        []string
+	deprecatedIn int
+	removedIn    int
+	replacement  string
+}
+
+// The deprecated API versions, from https://kubernetes.io/docs/reference/using-api/deprecation-guide/
+var apiDeprecations = []apiDeprecation{
+	{apiVersion: "extensions/v1beta1", kinds: []string{"DaemonSet", "Deployment", "ReplicaSet"}, deprecatedIn: 9, removedIn: 16, replacement: "apps/v1"},
+	{apiVersion: "extensions/v1beta1", kinds: []string{"NetworkPolicy"}, deprecatedIn: 9, removedIn: 16, replacement: "networking.k8s.io/v1"},
+	{apiVersion: "extensions/v1beta1", kinds: []string{"PodSecurityPolicy"}, deprecatedIn: 11, removedIn: 16, replacement: "policy/v1beta1"},
+	{apiVersion: "extensions/v1beta1", kinds: []string{"Ingress"}, deprecatedIn: 14, removedIn: 22, replacement: "networking.k8s.io/v1"},
+	{apiVersion: "apps/v1beta1", deprecatedIn: 9, removedIn: 16, replacement: "apps/v1"},
+	{apiVersion: "apps/v1beta2", deprecatedIn: 9, removedIn: 16, replacement: "apps/v1"},
+	{apiVersion: "admissionregistration.k8s.io/v1beta1", deprecatedIn: 16, removedIn: 22, replacement: "admissionregistration.k8s.io/v1"},
+	{apiVersion: "apiextensions.k8s.io/v1beta1", deprecatedIn: 16, removedIn: 22, replacement: "apiextensions.k8s.io/v1"},
+	{apiVersion: "apiregistration.k8s.io/v1beta1", deprecatedIn: 19, removedIn: 22, replacement: "apiregistration.k8s.io/v1"},
+	{apiVersion: "authentication.k8s.io/v1beta1", deprecatedIn: 19, removedIn: 22, replacement: "authentication.k8s.io/v1"},
+	{apiVersion: "authorization.k8s.io/v1beta1", deprecatedIn: 19, removedIn: 22, replacement: "authorization.k8s.io/v1"},
+	{apiVersion: "certificates.k8s.io/v1beta1", deprecatedIn: 19, removedIn: 22, replacement: "certificates.k8s.io/v1"},
+	{apiVersion: "coordination.k8s.io/v1beta1", deprecatedIn: 19, removedIn: 22, replacement: "coordination.k8s.io/v1"},
+	{apiVersion: "networking.k8s.io/v1beta1", kinds: []string{"Ingress", "IngressClass"}, deprecatedIn: 19, removedIn: 22, replacement: "networking.k8s.io/v1"},
+	{apiVersion: "rbac.authorization.k8s.io/v1beta1", deprecatedIn: 17, removedIn: 22, replacement: "rbac.authorization.k8s.io/v1"},
+	{apiVersion: "scheduling.k8s.io/v1beta1", deprecatedIn: 14, removedIn: 22, replacement: "scheduling.k8s.io/v1"},
+	{apiVersion: "storage.k8s.io/v1beta1", kinds: []string{"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"}, deprecatedIn: 19, removedIn: 22, replacement: "storage.k8s.io/v1"},
+	{apiVersion: "batch/v1beta1", kinds: []string{"CronJob"}, deprecatedIn: 21, removedIn: 25, replacement: "batch/v1"},
+	{apiVersion: "discovery.k8s.io/v1beta1", kinds: []string{"EndpointSlice"}, deprecatedIn: 21, removedIn: 25, replacement: "discovery.k8s.io/v1"},
+	{apiVersion: "events.k8s.io/v1beta1", kinds: []string{"Event"}, deprecatedIn: 19, removedIn: 25, replacement: "events.k8s.io/v1"},
+	{apiVersion: "autoscaling/v2beta1", kinds: []string{"HorizontalPodAutoscaler"}, deprecatedIn: 22, removedIn: 25, replacement: "autoscaling/v2"},
+	{apiVersion: "policy/v1beta1", kinds: []string{"PodDisruptionBudget"}, deprecatedIn: 21, removedIn: 25, replacement: "policy/v1"},
+	{apiVersion: "policy/v1beta1", kinds: []string{"PodSecurityPolicy"}, deprecatedIn: 21, removedIn: 25, replacement: "Pod Security Admission"},
+	{apiVersion: "node.k8s.io/v1beta1", kinds: []string{"RuntimeClass"}, deprecatedIn: 20, removedIn: 25, replacement: "node.k8s.io/v1"},
+	{apiVersion: "autoscaling/v2beta2", kinds: []string{"HorizontalPodAutoscaler"}, deprecatedIn: 23, removedIn: 26, replacement: "autoscaling/v2"},
+	{apiVersion: "flowcontrol.apiserver.k8s.io/v1beta1", deprecatedIn: 23, removedIn: 26, replacement: "flowcontrol.apiserver.k8s.io/v1"},
+	{apiVersion: "storage.k8s.io/v1beta1", kinds: []string{"CSIStorageCapacity"}, deprecatedIn: 24, removedIn: 27, replacement: "storage.k8s.io/v1"},
+	{apiVersion: "flowcontrol.apiserver.k8s.io/v1beta2", deprecatedIn: 26, removedIn: 29, replacement: "flowcontrol.apiserver.k8s.io/v1"},
+	{apiVersion: "flowcontrol.apiserver.k8s.io/v1beta3", deprecatedIn: 29, removedIn: 32, replacement: "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// findAPIDeprecation returns the deprecation of the API version of obj, or nil if it is not deprecated
+func findAPIDeprecation(obj manifestObject) *apiDeprecation {
+	for i, d := range apiDeprecations {
+		if d.apiVersion == obj.APIVersion && (len(d.kinds) == 0 || containsString(d.kinds, obj.Kind)) {
+			return &apiDeprecations[i]
+		}
+	}
+	return nil
+}
+
+// getServerMinorVersion returns the minor version of the Kubernetes server of the target context, like 27 for 1.27,
+// along with the full version that is shown
+func (o *confirmOptions) getServerMinorVersion(cmd *cobra.Command) (int, string, error) {
+	var version map[string]interface{}
+	if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), append([]string{"version", "-o", "json"}, o.globalFlags()...), cmd.InOrStdin(), &version); err != nil {
+		return 0, "", err
+	}
+	gitVersion := util.NestedString(version, "serverVersion", "gitVersion")
+	minor, err := strconv.Atoi(strings.TrimRight(util.NestedString(version, "serverVersion", "minor"), "+"))
+	if err != nil || util.NestedString(version, "serverVersion", "major") != "1" {
+		return 0, "", fmt.Errorf("unknown server version %q", gitVersion)
+	}
+	return minor, gitVersion, nil
+}
+
+// printAPIVersions flags the objects whose API versions are deprecated or removed in the server version of the target
+// context. If the server version cannot be determined, every deprecated API version is flagged. Nothing is printed if
+// none of the objects use a deprecated API version.
+func (o *confirmOptions) printAPIVersions(cmd *cobra.Command, objects []manifestObject) {
+	type finding struct {
+		obj         manifestObject
+		deprecation *apiDeprecation
+	}
+	var findings []finding
+	for _, obj := range objects {
+		if d := findAPIDeprecation(obj); d != nil {
+			findings = append(findings, finding{obj: obj, deprecation: d})
+		}
+	}
+	if len(findings) == 0 {
+		return
+	}
+
+	minor, serverVersion, err := o.getServerMinorVersion(cmd)
+	var lines []string
+	for _, f := range findings {
+		d := f.deprecation
+		name := fmt.Sprintf("%s %s %s (%s)", f.obj.APIVersion, f.obj.Kind, f.obj.Name, f.obj.source)
+		switch {
+		case err == nil && minor >= d.removedIn:
+			lines = append(lines, fmt.Sprintf("REMOVED: %s was removed in 1.%d, use %s", name, d.removedIn, d.replacement))
+		case err == nil && minor < d.deprecatedIn:
+			// Not deprecated yet in the server version
+		default:
+			lines = append(lines, fmt.Sprintf("DEPRECATED: %s is deprecated since 1.%d and removed in 1.%d, use %s", name, d.deprecatedIn, d.removedIn, d.replacement))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	util.PrintSectionTitle(cmd, "API Versions")
+	defer cmd.Println()
+	if err != nil {
+		reason, _, _ := strings.Cut(strings.TrimSpace(err.Error()), "\n")
+		cmd.Printf("%-11s unknown (%s)\n", "Server:", reason)
+	} else {
+		cmd.Printf("%-11s %s\n", "Server:", serverVersion)
+	}
+	for _, line := range lines {
+		cmd.Println(line)
+	}
+}
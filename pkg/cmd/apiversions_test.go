@@ -0,0 +1,96 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+func TestPrintAPIVersions(t *testing.T) {
+	objects := []manifestObject{
+		{Header: yaml.Header{APIVersion: "extensions/v1beta1", Kind: "Ingress", Name: "web"}, source: "a.yaml"},
+		{Header: yaml.Header{APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler", Name: "api"}, source: "a.yaml"},
+		{Header: yaml.Header{APIVersion: "flowcontrol.apiserver.k8s.io/v1beta3", Kind: "FlowSchema", Name: "fs"}, source: "b.yaml"},
+		{Header: yaml.Header{APIVersion: "apps/v1", Kind: "Deployment", Name: "api"}, source: "b.yaml"},
+	}
+	testCases := []struct {
+		name           string
+		versionStdout  string
+		versionStderr  string
+		versionError   error
+		objects        []manifestObject
+		expectedStdout string
+	}{
+		{
+			name:          "server version",
+			versionStdout: `{"clientVersion": {"major": "1", "minor": "27"}, "serverVersion": {"major": "1", "minor": "25+", "gitVersion": "v1.25.16-eks-1"}}`,
+			objects:       objects,
+			expectedStdout: `========== API Versions =====
+Server:     v1.25.16-eks-1
+REMOVED: extensions/v1beta1 Ingress web (a.yaml) was removed in 1.22, use networking.k8s.io/v1
+DEPRECATED: autoscaling/v2beta2 HorizontalPodAutoscaler api (a.yaml) is deprecated since 1.23 and removed in 1.26, use autoscaling/v2
+
+`,
+		},
+		{
+			name:          "unknown server version",
+			versionStderr: "The connection to the server localhost:8080 was refused\nmore details",
+			versionError:  errors.New("exit status 1"),
+			objects:       objects[1:],
+			expectedStdout: `========== API Versions =====
+Server:     unknown (The connection to the server localhost:8080 was refused)
+DEPRECATED: autoscaling/v2beta2 HorizontalPodAutoscaler api (a.yaml) is deprecated since 1.23 and removed in 1.26, use autoscaling/v2
+DEPRECATED: flowcontrol.apiserver.k8s.io/v1beta3 FlowSchema fs (b.yaml) is deprecated since 1.29 and removed in 1.32, use flowcontrol.apiserver.k8s.io/v1
+
+`,
+		},
+		{
+			name:          "not deprecated yet",
+			versionStdout: `{"serverVersion": {"major": "1", "minor": "21", "gitVersion": "v1.21.0"}}`,
+			objects:       objects[1:],
+		},
+		{
+			name:    "no deprecated api versions",
+			objects: objects[3:],
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun(tc.versionStdout, tc.versionStderr, tc.versionError)
+
+			o := confirmOptions{args: kubeargs.Parse([]string{"apply", "-f", "a.yaml", "--context=ctx"})}
+			cmd, _, stdout, _ := util.NewTestCommand()
+			o.printAPIVersions(cmd, tc.objects)
+			if stdout.String() != tc.expectedStdout {
+				t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", tc.expectedStdout, stdout.String())
+			}
+			if len(tc.versionStdout) > 0 && !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), []string{"version", "-o", "json", "--context=ctx"}) {
+				t.Fatalf("wrong version args: %v", fakeExecRunner.LastRunArgs())
+			}
+			if tc.versionStdout == "" && tc.versionError == nil && fakeExecRunner.RunCount() > 0 {
+				t.Fatalf("expected the server version not to be requested")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// Exit codes used when the command is not executed
+const (
+	// The user did not confirm the command
+	abortedExitCode = 1
+	// kubectl confirm was interrupted, which is the exit code shells use for a process killed by SIGINT
+	interruptedExitCode = 130
+)
+
+// The signals that interrupt kubectl confirm
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+var errInterrupted = errors.New("interrupted")
+
+// notifyContext is signal.NotifyContext, which can be replaced to simulate a signal in tests
+var notifyContext = signal.NotifyContext
+
+// signals returns the signals that interrupt the command, which are SIGINT and SIGTERM, unless it is embedded in another
+// tool. An embedded command only handles the signals passed by that tool, so that no process-wide signal handlers are
+// installed behind its back.
+func (o *confirmOptions) signals() []os.Signal {
+	if o.embedded {
+		return o.embeddedSignals
+	}
+	return interruptSignals
+}
+
+// runInterruptible runs f with a context that is cancelled when the process receives one of the signals, which kills
+// the kubectl processes started with that context. It returns errInterrupted if a signal was received. If there are no
+// signals, f is only cancelled by the context of cmd.
+func runInterruptible(cmd *cobra.Command, signals []os.Signal, f func(ctx context.Context) error) error {
+	if len(signals) == 0 {
+		return f(cmd.Context())
+	}
+	ctx, stop := notifyContext(cmd.Context(), signals...)
+	defer stop()
+	err := f(ctx)
+	if ctx.Err() != nil && cmd.Context().Err() == nil {
+		return errInterrupted
+	}
+	return err
+}
+
+// createTempFile creates a temp file in a private directory that only the current user can access, because the file
+// may contain Secrets. The directory and everything in it is removed by cleanup.
+func (o *confirmOptions) createTempFile(pattern string) (*os.File, error) {
+	if len(o.tempDir) == 0 {
+		// The directory is created with mode 0700, and files in it with mode 0600
+		dir, err := os.MkdirTemp("", "kubectl-confirm-*")
+		if err != nil {
+			return nil, err
+		}
+		o.tempDir = dir
+	}
+	return os.CreateTemp(o.tempDir, pattern)
+}
+
+// cleanup removes the temp files created by createTempFile
+func (o *confirmOptions) cleanup() {
+	if len(o.tempDir) > 0 {
+		_ = os.RemoveAll(o.tempDir)
+		o.tempDir = ""
+	}
+}
+
+// abort exits without executing the command. Exit does not run deferred functions, so temp files are removed first.
+func (o *confirmOptions) abort(cmd *cobra.Command, code int) {
+	cmd.PrintErr("Command aborted.\n")
+	o.cleanup()
+	util.Exit(code)
+}
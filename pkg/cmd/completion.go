@@ -0,0 +1,76 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// The name of the helper that kubectl (v1.26 and later) runs to complete the arguments of the confirm plugin
+const completionHelperName = "kubectl_complete-confirm"
+
+const completionScript = `#!/usr/bin/env sh
+
+# Shell completion for kubectl confirm.
+# Save this file as ` + completionHelperName + ` in a directory in your PATH and make it executable.
+kubectl-confirm __complete "$@"
+`
+
+// newCompleteCommand returns the hidden command that shells use to request completions. The wrapped kubectl command is
+// completed by kubectl itself, so completions are the same as they would be without kubectl confirm.
+func newCompleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:                cobra.ShellCompRequestCmd,
+		Aliases:            []string{cobra.ShellCompNoDescRequestCmd},
+		Hidden:             true,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return complete(cmd, args)
+		},
+	}
+}
+
+func complete(cmd *cobra.Command, args []string) error {
+	// The last arg is the partial word being completed, which may be empty, so it must be passed through as is
+	toComplete := ""
+	if len(args) > 0 {
+		toComplete = args[len(args)-1]
+		args = args[:len(args)-1]
+	}
+	kubectlArgs := append([]string{cmd.CalledAs()}, kubeargs.Parse(args).Without(confirmOnlyFlags...)...)
+	kubectlArgs = append(kubectlArgs, toComplete)
+	return util.ExecRun(cmd.Context(), util.GetKubectlPath(), kubectlArgs, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+}
+
+// newCompletionScriptCommand returns the command that prints the completion helper script
+func newCompletionScriptCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion-script",
+		Short: "Print the " + completionHelperName + " script, which enables shell completion in kubectl",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			// The script is redirected to a file, so it is printed to stdout instead of stderr, where cmd.Print would
+			// print it when the output of the command is not set
+			fmt.Fprint(cmd.OutOrStdout(), completionScript)
+		},
+	}
+}
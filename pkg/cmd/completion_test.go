@@ -0,0 +1,94 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestComplete(t *testing.T) {
+	testCases := []struct {
+		name                string
+		args                []string
+		expectedKubectlArgs []string
+	}{
+		{
+			name:                "complete command",
+			args:                []string{"__complete", ""},
+			expectedKubectlArgs: []string{"__complete", ""},
+		},
+		{
+			name:                "complete resource name",
+			args:                []string{"__complete", "-n", "foo", "delete", "pod", "ba"},
+			expectedKubectlArgs: []string{"__complete", "-n", "foo", "delete", "pod", "ba"},
+		},
+		{
+			name:                "complete flag without descriptions",
+			args:                []string{"__completeNoDesc", "apply", "--fi"},
+			expectedKubectlArgs: []string{"__completeNoDesc", "apply", "--fi"},
+		},
+		{
+			name:                "confirm flags are not passed to kubectl",
+			args:                []string{"__complete", "--contexts", "prod-*", "--continue-on-error", "delete", "pod", "ba"},
+			expectedKubectlArgs: []string{"__complete", "delete", "pod", "ba"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun("pod-a\npod-b\n:4\n", "", nil)
+
+			stdout := &bytes.Buffer{}
+			cmd := NewConfirmCommand()
+			cmd.SetArgs(tc.args)
+			cmd.SetOut(stdout)
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("complete failed: %v", err)
+			}
+
+			if fakeExecRunner.LastRunName() != "kubectl" {
+				t.Fatalf("expected kubectl to be run, but it was %q", fakeExecRunner.LastRunName())
+			}
+			if !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), tc.expectedKubectlArgs) {
+				t.Fatalf("wrong kubectl args.\nexpected: %v\ngot: %v\n", tc.expectedKubectlArgs, fakeExecRunner.LastRunArgs())
+			}
+			if stdout.String() != "pod-a\npod-b\n:4\n" {
+				t.Fatalf("expected kubectl completions to be passed through, got:\n%s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestCompletionScript(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := NewConfirmCommand()
+	cmd.SetArgs([]string{"completion-script"})
+	cmd.SetOut(stdout)
+	cmd.SetErr(stderr)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("completion-script failed: %v", err)
+	}
+	if stdout.String() != completionScript || stderr.Len() > 0 {
+		t.Fatalf("wrong script\nexpected:\n%s\ngot:\n%s\nstderr:\n%s", completionScript, stdout.String(), stderr.String())
+	}
+}
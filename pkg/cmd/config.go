@@ -31,7 +31,11 @@ func (o *confirmOptions) printConfig(cmd *cobra.Command) error {
 
 	// Get the effective config
 	stdout := bytes.Buffer{}
-	err := util.ExecRun(util.GetKubectlPath(), []string{"config", "view", "-o=json"}, cmd.InOrStdin(), &stdout, cmd.ErrOrStderr())
+	configArgs := []string{"config", "view", "-o=json"}
+	if len(o.kubeconfig) > 0 {
+		configArgs = append(configArgs, "--kubeconfig="+o.kubeconfig)
+	}
+	err := o.runKubectl(cmd.Context(), configArgs, cmd.InOrStdin(), &stdout, cmd.ErrOrStderr())
 	if err != nil {
 		return err
 	}
@@ -70,6 +74,11 @@ func (o *confirmOptions) printConfig(cmd *cobra.Command) error {
 	}
 	cmd.Printf("%-11s %s\n", "Namespace:", namespace)
 
+	o.resolvedContext = context
+	o.resolvedCluster = cluster
+	o.resolvedUser = user
+	o.resolvedNamespace = namespace
+
 	return nil
 }
 
@@ -17,13 +17,19 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
 	"github.com/brianpursley/kubectl-confirm/internal/util"
 	"github.com/brianpursley/kubectl-confirm/internal/version"
 )
@@ -64,16 +70,98 @@ var diffCommands = map[string]bool{
 	"taint":     true,
 }
 
+// Flags that are handled by kubectl confirm itself and must not be passed to kubectl
+var confirmOnlyFlags = []string{"confirm-namespace-selector", "confirm-namespaces", "confirm-verify", "confirm-verify-timeout", "contexts", "continue-on-error"}
+
 type confirmOptions struct {
-	cluster   string
-	context   string
-	namespace string
-	user      string
+	// The kubectl command being confirmed
+	args *kubeargs.Args
+
+	cluster    string
+	context    string
+	namespace  string
+	user       string
+	kubeconfig string
 
 	filenames []string
 	kustomize string
 
+	// The contexts and namespaces to run the command in, from --contexts, --confirm-namespaces, and
+	// --confirm-namespace-selector, and whether to continue with the rest of them if the command fails in one of them
+	contexts          string
+	namespaces        string
+	namespaceSelector string
+	continueOnError   bool
+
+	// Whether to verify the result of the command after it is executed, from --confirm-verify, and how long to wait
+	// for workloads to roll out, from --confirm-verify-timeout
+	verify            bool
+	verifyTimeoutFlag string
+	verifyTimeout     time.Duration
+
 	hasAnyNonRegularFiles bool
+
+	// The manifest read from stdin, when -f - is used
+	stdinManifest []byte
+
+	// The effective config, as resolved and shown by printConfig
+	resolvedContext   string
+	resolvedCluster   string
+	resolvedUser      string
+	resolvedNamespace string
+
+	// The objects affected by the command, from the server dry run shared by the dry run and diff sections
+	preview []previewObject
+
+	// The objects in the manifests of the command, as read by the config preview
+	manifests []manifestObject
+	// Reads the manifests once for the preview steps that need them
+	manifestReader *manifestReader
+
+	policy    *policy
+	targetPod map[string]interface{}
+
+	// The objects affected by rollout, from the rollout preview
+	rolloutObjects []map[string]interface{}
+
+	// The objects deleted by delete, as they are before it is executed
+	deletedObjects []map[string]interface{}
+
+	// failedSteps are the preview steps that failed, when the policy allows confirming the command anyway
+	failedSteps []stepFailure
+
+	// warnings are the warnings returned by the server dry run
+	warnings []string
+
+	// policyChallenges are the messages of the policy rules that require a stronger confirmation of the command
+	policyChallenges []string
+
+	// id is the ID of the change made by the command in the history
+	id string
+
+	// rollbackOf is the ID of the change that the command rolls back, from kubectl confirm rollback
+	rollbackOf string
+
+	// editedFile is the temp file with the objects edited by edit, which is saved with the record of the change,
+	// because temp files are removed
+	editedFile string
+
+	// report is a copy of what was printed before the prompt, which is saved in the history, and reportOut is the
+	// output that is restored when reporting stops
+	report    *bytes.Buffer
+	reportOut io.Writer
+	reporting bool
+
+	// tempDir is the private directory of the temp files created by createTempFile
+	tempDir string
+
+	// embedded is true when the command is confirmed by another tool using the confirm package, so kubectl confirm
+	// must not exit when it is interrupted
+	embedded bool
+	// execRunner runs kubectl instead of util.ExecRun, if it is set by the tool that embeds the command
+	execRunner util.ExecRunner
+	// embeddedSignals are the signals that interrupt an embedded command, which are passed by the tool that embeds it
+	embeddedSignals []os.Signal
 }
 
 const shortHelpText string = `
@@ -86,10 +174,22 @@ The plugin will show the following information:
   * Configuration (context, cluster, user, and namespace)
   * Dry run output (if available for the kubectl command)
   * Diff output (if available for the kubectl command)
+  * Rollout preview (for rollout undo, restart, pause, and resume)
+  * Target summary (for exec, cp, port-forward, and debug)
+
+For the edit command, your editor is opened first, and then a dry run of your edited copy is shown along with its diff
+with the live object. The edited copy is only applied if you confirm.
 
 After the information is displayed, you will be asked to confirm whether to proceed.
 
-Upon confirmation, the Kubectl command will be executed. 
+To run the command in several contexts, use --contexts with a comma separated list of contexts or glob patterns, like
+--contexts=prod-us,prod-eu or --contexts='prod-*'. To run it in several namespaces, use --confirm-namespaces with a
+comma separated list of namespaces, or --confirm-namespace-selector with a label selector of namespaces, like
+--confirm-namespace-selector=tenant. Execution stops at the first context or namespace the command fails in, unless
+--continue-on-error is specified.
+
+Upon confirmation, the Kubectl command will be executed. The objects it affects are saved before, so that the change
+can be rolled back with: kubectl confirm rollback <id>
 
 All arguments and flags will be passed through to Kubectl.
 `
@@ -109,49 +209,77 @@ func NewConfirmCommand() *cobra.Command {
 		Short:        shortHelpText,
 		Long:         longHelpText,
 		Use:          usage,
-		FParseErrWhitelist: cobra.FParseErrWhitelist{
-			UnknownFlags: true,
-		},
+		// All flags belong to the kubectl command, so they are parsed by kubeargs instead of cobra
+		DisableFlagParsing: true,
+		// Any kubectl command can be confirmed, not just the subcommands below
+		Args: cobra.ArbitraryArgs,
+		// The completion command would shadow kubectl completion, and completion is delegated to kubectl anyway
+		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return options.run(cmd, args)
 		},
 	}
 
-	cmd.Flags().StringVar(&options.cluster, "cluster", "", "")
-	_ = cmd.Flags().MarkHidden("cluster")
-	cmd.Flags().StringVar(&options.context, "context", "", "")
-	_ = cmd.Flags().MarkHidden("context")
-	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "")
-	_ = cmd.Flags().MarkHidden("namespace")
-	cmd.Flags().StringVar(&options.user, "user", "", "")
-	_ = cmd.Flags().MarkHidden("user")
-
-	cmd.Flags().StringArrayVarP(&options.filenames, "filename", "f", []string{}, "")
-	_ = cmd.Flags().MarkHidden("filename")
-	cmd.Flags().StringVarP(&options.kustomize, "kustomize", "k", "", "")
-	_ = cmd.Flags().MarkHidden("kustomize")
+	cmd.AddCommand(newCompleteCommand())
+	cmd.AddCommand(newCompletionScriptCommand())
+	cmd.AddCommand(newHistoryCommand())
+	cmd.AddCommand(newShowCommand())
 
 	return &cmd
 }
 
 func (o *confirmOptions) run(cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("expected at least one argument")
-	}
-
-	commandName := args[0]
+	o.parseArgs(args)
+	defer o.cleanup()
 
 	// Help
-	if commandName == "help" {
+	commandName := o.args.Verb()
+	if commandName == "help" || o.args.Has("help") {
 		return cmd.Help()
 	}
 
+	if len(commandName) == 0 {
+		return fmt.Errorf("expected at least one argument")
+	}
+
 	// Version
 	if commandName == "version" {
-		if !util.HasOutputFlag() {
+		if !o.args.Has("output") {
 			cmd.Printf("Kubectl Confirm Plugin Version: %s\n\n", version.String())
 		}
-		return util.ExecRun(util.GetKubectlPath(), os.Args[1:], cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+		return o.runKubectl(cmd.Context(), o.args.Raw(), cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+	}
+
+	// Rollback, which is confirmed the same way as applying the snapshot of the change
+	if commandName == "rollback" {
+		rollback, record, err := rollbackArgs(args)
+		if err != nil {
+			return err
+		}
+		printCreatedObjects(cmd, record)
+		o.parseArgs(rollback)
+		o.rollbackOf = record.ID
+		commandName = o.args.Verb()
+	}
+
+	// Policy
+	p, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	o.policy = p
+	if err := o.parseVerifyTimeout(); err != nil {
+		return err
+	}
+
+	// Multiple contexts or namespaces
+	if len(o.contexts) > 0 || len(o.namespaces) > 0 || len(o.namespaceSelector) > 0 {
+		return o.runFanOut(cmd, commandName)
+	}
+
+	// Edit
+	if commandName == "edit" {
+		return o.edit(cmd)
 	}
 
 	// Check for non-regular files (ie. process substitution). In this case, dry run and diff cannot be performed, or
@@ -159,41 +287,255 @@ func (o *confirmOptions) run(cmd *cobra.Command, args []string) error {
 	// indicating that one or more non-regular files were detected.
 	o.checkForNonRegularFiles()
 
-	// Config
-	if err := o.printConfig(cmd); err != nil {
-		return err
-	}
-
-	// Dry Run
-	if dryRunCommands[commandName] {
-		err := o.dryRun(cmd)
+	// A manifest piped to stdin is read before the preview, so that it can be used more than once
+	if containsString(o.filenames, "-") {
+		closeTerminal, err := o.readStdinManifest(cmd)
 		if err != nil {
 			return err
 		}
+		defer closeTerminal()
 	}
 
-	// Diff
-	if diffCommands[commandName] {
-		if err := o.diff(cmd); err != nil {
-			return err
-		}
+	if err := o.previewCommand(cmd, commandName); errors.Is(err, errInterrupted) {
+		o.abort(cmd, interruptedExitCode)
+		return nil
+	} else if err != nil {
+		return err
 	}
 
 	// Prompt
+	if !o.confirm(cmd, o.args.Raw()) {
+		return nil
+	}
+
+	// Execute the real command
+	return o.executeAndRecord(cmd, commandName, o.args.Raw())
+}
+
+// previewCommand shows the preview of the command and checks the policy, so that the command is ready to be confirmed.
+// What is shown is kept as the report of the change.
+func (o *confirmOptions) previewCommand(cmd *cobra.Command, commandName string) error {
+	o.startReport(cmd)
+	if err := o.runSteps(cmd, o.previewSteps(commandName)); err != nil {
+		return err
+	}
+
+	// GitOps and Warnings, now that the live objects and the result of the dry run are known
+	o.printGitOps(cmd)
+	o.printWarnings(cmd)
+
+	// Check the policy, now that the config and target are known
+	return o.checkPolicy(commandName)
+}
+
+// previewSteps returns the steps that preview the command. They are independent of each other, so they run
+// concurrently, but their sections are always shown in the same order: Config, Rendered, Namespace Check, API
+// Versions, Permissions, Dry Run, Diff, Rollout, and Target. The sections about the manifests are part of the config
+// step, because they use the namespace resolved by printConfig.
+func (o *confirmOptions) previewSteps(commandName string) []previewStep {
+	o.manifestReader = &manifestReader{}
+	steps := []previewStep{{name: "config", run: o.printConfig}}
+	if o.hasManifests() {
+		steps[0].run = func(cmd *cobra.Command) error {
+			if err := o.printConfig(cmd); err != nil {
+				return err
+			}
+			return o.printManifests(cmd)
+		}
+	}
+	if hasPermissionChecks(commandName, o.args.Operands()) {
+		steps = append(steps, previewStep{name: "permissions", run: func(cmd *cobra.Command) error {
+			return o.printPermissions(cmd, commandName)
+		}})
+	}
+	if dryRunCommands[commandName] || diffCommands[commandName] {
+		steps = append(steps, previewStep{name: "dry run", run: o.previewChanges})
+	}
+	if commandName == "rollout" {
+		steps = append(steps, previewStep{name: "rollout", run: o.rollout})
+	}
+	if targetCommands[commandName] {
+		steps = append(steps, previewStep{name: "target", run: func(cmd *cobra.Command) error {
+			return o.target(cmd, commandName)
+		}})
+	}
+	return steps
+}
+
+// parseArgs parses the kubectl command being confirmed and sets the options that are taken from its flags
+func (o *confirmOptions) parseArgs(args []string) {
+	parsed := kubeargs.Parse(args)
+	o.contexts = parsed.Value("contexts")
+	o.namespaces = parsed.Value("confirm-namespaces")
+	o.namespaceSelector = parsed.Value("confirm-namespace-selector")
+	o.continueOnError = parsed.Has("continue-on-error")
+	o.verify = parsed.Has("confirm-verify") && parsed.Value("confirm-verify") != "false"
+	o.verifyTimeoutFlag = parsed.Value("confirm-verify-timeout")
+	o.args = kubeargs.Parse(parsed.Without(confirmOnlyFlags...))
+	o.cluster = o.args.Value("cluster")
+	o.context = o.args.Value("context")
+	o.namespace = o.args.Value("namespace")
+	o.user = o.args.GlobalValue("user")
+	o.kubeconfig = o.args.Value("kubeconfig")
+	o.filenames = o.args.Values("filename")
+	o.kustomize = o.args.Value("kustomize")
+}
+
+// The response required to confirm a command whose preview is incomplete, when the context is not known
+const incompletePreviewResponse = "yes, without preview"
+
+// confirm prompts the user to confirm the command, and aborts if the user does not confirm it or the prompt is
+// interrupted, in which case the command is recorded in the history as aborted. It returns true if the user confirmed.
+func (o *confirmOptions) confirm(cmd *cobra.Command, kubectlArgs []string) bool {
+	confirmed, err := o.prompt(cmd, kubectlArgs)
+	o.stopReport(cmd)
+	if err != nil || !confirmed {
+		o.recordAborted(cmd, o.args.Verb(), kubectlArgs)
+	}
+	if err != nil {
+		o.abort(cmd, interruptedExitCode)
+		return false
+	}
+	if !confirmed {
+		o.abort(cmd, abortedExitCode)
+		return false
+	}
+	return true
+}
+
+// prompt shows the kubectl command that will be executed and asks the user to confirm it. It returns true if the
+// user confirmed. If any preview steps failed, or a policy rule requires it, the user must enter the name of the
+// context instead of yes. The prompt can be interrupted by SIGINT or SIGTERM, in which case errInterrupted is returned.
+func (o *confirmOptions) prompt(cmd *cobra.Command, kubectlArgs []string) (bool, error) {
 	util.PrintSectionTitle(cmd, "Confirm")
-	cmd.Printf("The following command will be executed:\n%s %s\n\n", util.GetKubectlPath(), strings.Join(os.Args[1:], " "))
-	cmd.Printf("Enter 'yes' to continue: ")
+	cmd.Printf("The following command will be executed:\n%s %s\n\n", util.GetKubectlPath(), strings.Join(redactArgs(kubectlArgs), " "))
+	if len(o.failedSteps) > 0 {
+		cmd.Printf("WARNING: The preview is incomplete. The following steps failed:\n")
+		for _, f := range o.failedSteps {
+			cmd.Printf("  %s: %s\n", f.name, strings.TrimSpace(f.err.Error()))
+		}
+		cmd.Println()
+	}
+	if len(o.policyChallenges) > 0 {
+		cmd.Printf("The policy requires additional confirmation:\n")
+		for _, message := range o.policyChallenges {
+			cmd.Printf("  %s\n", message)
+		}
+		cmd.Println()
+	}
+	expected := o.expectedResponse()
+	cmd.Printf("Enter '%s' to continue: ", expected)
+	response, err := readResponse(cmd, o.signals())
+	if err != nil {
+		return false, err
+	}
+	return response == expected, nil
+}
+
+// expectedResponse returns the response that confirms the command, which is yes, or the name of the context if any
+// preview steps failed or a policy rule requires it
+func (o *confirmOptions) expectedResponse() string {
+	if len(o.policyChallenges) > 0 || (len(o.failedSteps) > 0 && len(o.resolvedContext) > 0) {
+		return o.resolvedContext
+	}
+	if len(o.failedSteps) > 0 {
+		return incompletePreviewResponse
+	}
+	return "yes"
+}
+
+// readResponse reads the response to a prompt, without surrounding whitespace. Reading can be interrupted by one of
+// the signals, in which case errInterrupted is returned.
+func readResponse(cmd *cobra.Command, signals []os.Signal) (string, error) {
 	var response string
-	_, _ = fmt.Fscanln(cmd.InOrStdin(), &response)
+	err := runInterruptible(cmd, signals, func(ctx context.Context) error {
+		responses := make(chan string, 1)
+		go func() {
+			responses <- readLine(cmd.InOrStdin())
+		}()
+		select {
+		case response = <-responses:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
 	cmd.Println()
-	if response != "yes" {
-		cmd.PrintErr("Command aborted.\n")
-		util.Exit(1)
+	return strings.TrimSpace(response), err
+}
+
+// execute runs the confirmed kubectl command. If it is interrupted by SIGINT or SIGTERM, or by the signals passed to
+// NewPreview, kubectl is killed, and kubectl confirm exits after removing its temp files, unless it is embedded in
+// another tool.
+func (o *confirmOptions) execute(cmd *cobra.Command, kubectlArgs []string) error {
+	err := runInterruptible(cmd, o.signals(), func(ctx context.Context) error {
+		return o.runKubectl(ctx, kubectlArgs, o.manifestInput(cmd), cmd.OutOrStdout(), cmd.ErrOrStderr())
+	})
+	if errors.Is(err, errInterrupted) && !o.embedded {
+		o.cleanup()
+		util.Exit(interruptedExitCode)
 		return nil
 	}
+	return err
+}
 
-	// Execute the real command
-	return util.ExecRun(util.GetKubectlPath(), os.Args[1:], cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+// executeAndRecord saves a snapshot of the objects affected by the confirmed command, executes it, verifies its result
+// if --confirm-verify is specified, and records it in the history. An error is returned if the command fails, or if
+// the verification fails.
+func (o *confirmOptions) executeAndRecord(cmd *cobra.Command, verb string, kubectlArgs []string) error {
+	snapshot, unsavedSecrets := o.saveSnapshot(cmd)
+	err := o.execute(cmd, kubectlArgs)
+	record := o.newChangeRecord(verb, kubectlArgs, err)
+	record.Snapshot = snapshot
+	record.UnsavedSecrets = unsavedSecrets
+	if o.verify {
+		record.Verification = o.verifyChanges(cmd)
+	}
+	o.recordChange(cmd, record)
+	if err == nil && record.Verification != nil && !record.Verification.Succeeded {
+		return fmt.Errorf("the command was executed, but its verification failed")
+	}
+	return err
+}
+
+// readLine reads a line one byte at a time, so that nothing after it is consumed from r
+func readLine(r io.Reader) string {
+	var sb strings.Builder
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			sb.WriteByte(b[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// runner returns the runner of kubectl, which is util.ExecRun unless the embedding tool passed its own
+func (o *confirmOptions) runner() util.ExecRunner {
+	if o.execRunner != nil {
+		return o.execRunner
+	}
+	return util.ExecRun
+}
+
+// runKubectl runs kubectl with args, using the runner of the command
+func (o *confirmOptions) runKubectl(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return o.runner()(ctx, util.GetKubectlPath(), args, stdin, stdout, stderr)
+}
+
+// globalFlags returns the kubectl flags needed to target the same cluster as the command being confirmed
+func (o *confirmOptions) globalFlags() []string {
+	if o.args == nil {
+		return nil
+	}
+	return o.args.GlobalFlagArgs("namespace")
 }
 
 func (o *confirmOptions) checkForNonRegularFiles() {
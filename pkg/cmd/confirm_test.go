@@ -18,15 +18,34 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
 	"github.com/brianpursley/kubectl-confirm/internal/util"
 	"github.com/brianpursley/kubectl-confirm/internal/version"
 )
 
+// TestMain records the changes made by the tests in a temp dir instead of the history of the user
+func TestMain(m *testing.M) {
+	historyDir, err := os.MkdirTemp("", "kubectl-confirm-history")
+	if err != nil {
+		panic(err)
+	}
+	_ = os.Setenv("KUBECTL_CONFIRM_HISTORY", historyDir)
+	code := m.Run()
+	_ = os.RemoveAll(historyDir)
+	os.Exit(code)
+}
+
 func TestCheckForNonRegularFiles(t *testing.T) {
 	util.IsNonRegularFile = func(name string) bool {
 		return name == "63"
@@ -73,24 +92,27 @@ func TestCheckForNonRegularFiles(t *testing.T) {
 }
 
 func TestRun(t *testing.T) {
+	_ = os.Setenv("KUBECTL_CONFIRM_POLICY", filepath.Join(t.TempDir(), "missing.json"))
+	defer os.Unsetenv("KUBECTL_CONFIRM_POLICY")
+
 	testCases := []struct {
 		name                string
 		options             confirmOptions
 		kubectlPath         string
 		fakeOsArgs          []string
-		fakeArgs            []string
 		response            string
 		expectedStdout      string
 		unexpectedStdout    string
 		expectedStderr      string
 		expectKubectl       bool
 		expectedKubectlArgs []string
-		expectedExitCode    int
+		// Args of a kubectl run that must not happen, like the real command when it is aborted
+		unexpectedKubectlArgs []string
+		expectedExitCode      int
 	}{
 		{
 			name:             "help should show help and exit",
 			options:          confirmOptions{},
-			fakeArgs:         []string{"help"},
 			fakeOsArgs:       []string{"confirm", "help"},
 			expectKubectl:    false,
 			expectedExitCode: 0,
@@ -98,7 +120,6 @@ func TestRun(t *testing.T) {
 		{
 			name:                "version should show version",
 			options:             confirmOptions{},
-			fakeArgs:            []string{"version"},
 			fakeOsArgs:          []string{"confirm", "version"},
 			expectKubectl:       true,
 			expectedStdout:      version.String(),
@@ -108,7 +129,6 @@ func TestRun(t *testing.T) {
 		{
 			name:                "version should not show plugin version if output flag is specified",
 			options:             confirmOptions{},
-			fakeArgs:            []string{"version"},
 			fakeOsArgs:          []string{"confirm", "version", "-o", "yaml"},
 			expectKubectl:       true,
 			unexpectedStdout:    "Kubectl Confirm Plugin Version: ",
@@ -120,7 +140,6 @@ func TestRun(t *testing.T) {
 		{
 			name:          "should show diff when command is diff-able",
 			options:       confirmOptions{},
-			fakeArgs:      []string{"apply"},
 			fakeOsArgs:    []string{"confirm", "apply", "-f", "foo.yaml"},
 			response:      "yes\n",
 			expectKubectl: true,
@@ -132,11 +151,20 @@ Enter 'yes' to continue: `,
 			expectedKubectlArgs: []string{"apply", "-f", "foo.yaml"},
 			expectedExitCode:    0,
 		},
+		{
+			name:                "should derive dry run from the server dry run shared with diff",
+			options:             confirmOptions{},
+			fakeOsArgs:          []string{"confirm", "apply", "-f", "foo.yaml"},
+			response:            "yes\n",
+			expectKubectl:       true,
+			expectedStdout:      "========== Dry Run ==========\n" + derivedDryRunNote + "\nconfigmap/foo created (server dry run)\n",
+			expectedKubectlArgs: []string{"apply", "-f", "foo.yaml"},
+			expectedExitCode:    0,
+		},
 		{
 			name:          "should use KUBECTL_PATH environment variable",
 			options:       confirmOptions{},
 			kubectlPath:   "override-kubectl-path",
-			fakeArgs:      []string{"apply"},
 			fakeOsArgs:    []string{"confirm", "apply", "-f", "foo.yaml"},
 			response:      "yes\n",
 			expectKubectl: true,
@@ -151,7 +179,6 @@ Enter 'yes' to continue: `,
 		{
 			name:          "should skip diff when command is not not diff-able",
 			options:       confirmOptions{},
-			fakeArgs:      []string{"delete"},
 			fakeOsArgs:    []string{"confirm", "delete", "-f", "foo.yaml"},
 			response:      "yes\n",
 			expectKubectl: true,
@@ -164,10 +191,25 @@ Enter 'yes' to continue: `,
 			expectedKubectlArgs: []string{"delete", "-f", "foo.yaml"},
 			expectedExitCode:    0,
 		},
+		{
+			name:          "should find the command when flags come first",
+			options:       confirmOptions{},
+			fakeOsArgs:    []string{"confirm", "-n", "foo", "delete", "pod", "x"},
+			response:      "yes\n",
+			expectKubectl: true,
+			expectedStdout: `========== Permissions ======
+OBJECT  NAMESPACE  DELETE
+pod/x   foo        yes
+
+========== Dry Run ==========
+fake dry run output
+`,
+			expectedKubectlArgs: []string{"-n", "foo", "delete", "pod", "x"},
+			expectedExitCode:    0,
+		},
 		{
 			name:          "should abort if response is not yes",
 			options:       confirmOptions{},
-			fakeArgs:      []string{"delete"},
 			fakeOsArgs:    []string{"confirm", "delete", "-f", "foo.yaml"},
 			response:      "no\n",
 			expectKubectl: true,
@@ -176,9 +218,10 @@ The following command will be executed:
 kubectl delete -f foo.yaml
 
 Enter 'yes' to continue: `,
-			expectedStderr:      "Command aborted.",
-			expectedKubectlArgs: []string{"delete", "-f", "foo.yaml", "--dry-run=server"},
-			expectedExitCode:    1,
+			expectedStderr:        "Command aborted.",
+			expectedKubectlArgs:   []string{"delete", "-f", "foo.yaml", "--dry-run=server"},
+			unexpectedKubectlArgs: []string{"delete", "-f", "foo.yaml"},
+			expectedExitCode:      1,
 		},
 	}
 
@@ -192,29 +235,35 @@ Enter 'yes' to continue: `,
 				actualExitCode = code
 			}
 
-			commandName := tc.fakeArgs[0]
+			commandName := kubeargs.Parse(tc.fakeOsArgs[1:]).Verb()
 
 			fakeExecRunner := util.NewFakeExecRunner()
-			fakeExecRunner.SetupRun(`{"current-context": "foo", "contexts": [{"name": "foo", "context": {}}]}`, "", nil)
-			if dryRunCommands[commandName] {
-				fakeExecRunner.SetupRun("fake dry run output", "", nil)
-			}
+			// The preview steps run concurrently, so their fake runs are matched by args
+			fakeExecRunner.SetupRunMatching(util.ArgsContain("config"), `{"current-context": "foo", "contexts": [{"name": "foo", "context": {}}]}`, "", nil)
 			if diffCommands[commandName] {
-				fakeExecRunner.SetupRun("fake diff dry run output", "", nil)
-				fakeExecRunner.SetupRun("fake diff output", "", nil)
+				// The dry run and diff share one server dry run, followed by getting the live objects
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "bar"}}`, "", nil)
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), "", "", nil)
+			} else if dryRunCommands[commandName] {
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), "fake dry run output", "", nil)
 			}
-			if tc.response == "yes\n" {
+			if commandName == "delete" {
+				// The objects that are deleted are saved before the command is executed
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), `{"kind": "List", "items": []}`, "", nil)
+			}
+			if hasPermissionChecks(commandName, kubeargs.Parse(tc.fakeOsArgs[1:]).Operands()) {
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("can-i"), "yes\n", "", nil)
+			}
+			if tc.response == "yes\n" || commandName == "version" {
 				fakeExecRunner.SetupRun("fake real command output", "", nil)
 			}
 
-			os.Args = tc.fakeOsArgs
-
 			if len(tc.kubectlPath) > 0 {
 				_ = os.Setenv("KUBECTL_PATH", tc.kubectlPath)
 				defer os.Unsetenv("KUBECTL_PATH")
 			}
 
-			err := tc.options.run(cmd, tc.fakeArgs)
+			err := tc.options.run(cmd, tc.fakeOsArgs[1:])
 			if err != nil {
 				t.Fatalf("Run failed: %v", err)
 			}
@@ -228,9 +277,16 @@ Enter 'yes' to continue: `,
 					t.Fatalf("expected %q to be run, but it was %q", expectedLastRunName, fakeExecRunner.LastRunName())
 				}
 
-				if !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), tc.expectedKubectlArgs) {
+				// The preview steps run concurrently, so only the real command is guaranteed to be the last run
+				if !fakeExecRunner.HasRunArgs(tc.expectedKubectlArgs) {
+					t.Fatalf("expected kubectl to be run with args %v, but got: %v", tc.expectedKubectlArgs, fakeExecRunner.RunArgs)
+				}
+				if tc.unexpectedKubectlArgs == nil && !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), tc.expectedKubectlArgs) {
 					t.Fatalf("wrong kubectl args.\nexpected: %v\ngot: %v\n", tc.expectedKubectlArgs, fakeExecRunner.LastRunArgs())
 				}
+				if tc.unexpectedKubectlArgs != nil && fakeExecRunner.HasRunArgs(tc.unexpectedKubectlArgs) {
+					t.Fatalf("expected kubectl not to be run with args %v", tc.unexpectedKubectlArgs)
+				}
 			} else {
 				if fakeExecRunner.RunCount() > 0 {
 					t.Fatalf("unexpected run %q with args = %v", fakeExecRunner.LastRunName(), fakeExecRunner.LastRunArgs())
@@ -255,3 +311,153 @@ Enter 'yes' to continue: `,
 		})
 	}
 }
+
+func TestPrompt(t *testing.T) {
+	failedSteps := []stepFailure{{name: "dry run", err: errors.New("dry run did not finish within 1m0s")}}
+	testCases := []struct {
+		name            string
+		options         confirmOptions
+		response        string
+		expectedStdout  string
+		expectConfirmed bool
+	}{
+		{
+			name:            "yes confirms",
+			response:        "yes\n",
+			expectedStdout:  "Enter 'yes' to continue: ",
+			expectConfirmed: true,
+		},
+		{
+			name:            "anything else aborts",
+			response:        "y\n",
+			expectConfirmed: false,
+		},
+		{
+			name:            "yes does not confirm an incomplete preview",
+			options:         confirmOptions{resolvedContext: "prod", failedSteps: failedSteps},
+			response:        "yes\n",
+			expectedStdout:  "WARNING: The preview is incomplete. The following steps failed:\n  dry run: dry run did not finish within 1m0s\n\nEnter 'prod' to continue: ",
+			expectConfirmed: false,
+		},
+		{
+			name:            "context name confirms an incomplete preview",
+			options:         confirmOptions{resolvedContext: "prod", failedSteps: failedSteps},
+			response:        "prod\n",
+			expectConfirmed: true,
+		},
+		{
+			name:            "phrase confirms an incomplete preview when the context is unknown",
+			options:         confirmOptions{failedSteps: failedSteps},
+			response:        incompletePreviewResponse + "\n",
+			expectedStdout:  "Enter '" + incompletePreviewResponse + "' to continue: ",
+			expectConfirmed: true,
+		},
+		{
+			name:            "yes does not confirm a command challenged by the policy",
+			options:         confirmOptions{resolvedContext: "prod", policyChallenges: []string{"changes to GitOps managed objects"}},
+			response:        "yes\n",
+			expectedStdout:  "The policy requires additional confirmation:\n  changes to GitOps managed objects\n\nEnter 'prod' to continue: ",
+			expectConfirmed: false,
+		},
+		{
+			name:            "context name confirms a command challenged by the policy",
+			options:         confirmOptions{resolvedContext: "prod", policyChallenges: []string{"changes to GitOps managed objects"}},
+			response:        "prod\n",
+			expectConfirmed: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, stdin, stdout, _ := util.NewTestCommand()
+			stdin.WriteString(tc.response + "rest of stdin")
+			confirmed, err := tc.options.prompt(cmd, []string{"delete", "pod", "foo"})
+			if err != nil {
+				t.Fatalf("prompt failed: %v", err)
+			}
+			if confirmed != tc.expectConfirmed {
+				t.Fatalf("expected confirmed to be %v", tc.expectConfirmed)
+			}
+			if !strings.Contains(stdout.String(), tc.expectedStdout) {
+				t.Fatalf("expected stdout to contain:\n%s\ngot:\n%s", tc.expectedStdout, stdout.String())
+			}
+			if stdin.String() != "rest of stdin" {
+				t.Fatalf("expected only the response to be read, %q is left", stdin.String())
+			}
+		})
+	}
+}
+
+func TestPromptInterrupted(t *testing.T) {
+	defer func() {
+		notifyContext = signal.NotifyContext
+	}()
+	notifyContext = fakeSignal
+
+	// The prompt must not wait for a response that never comes
+	cmd, _, _, _ := util.NewTestCommand()
+	r, w := io.Pipe()
+	defer w.Close()
+	cmd.SetIn(r)
+	o := &confirmOptions{}
+	if _, err := o.prompt(cmd, []string{"delete", "pod", "foo"}); !errors.Is(err, errInterrupted) {
+		t.Fatalf("expected the prompt to be interrupted, got %v", err)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	_ = os.Setenv("KUBECTL_CONFIRM_POLICY", filepath.Join(t.TempDir(), "missing.json"))
+	defer os.Unsetenv("KUBECTL_CONFIRM_POLICY")
+	defer func() {
+		notifyContext = signal.NotifyContext
+	}()
+	notifyContext = fakeSignal
+	exitCode := 0
+	util.Exit = func(code int) {
+		exitCode = code
+	}
+	fakeExecRunner := util.NewFakeExecRunner()
+
+	cmd, _, _, stderr := util.NewTestCommand()
+	o := &confirmOptions{}
+	if err := o.run(cmd, []string{"delete", "pod", "foo"}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if exitCode != interruptedExitCode {
+		t.Fatalf("expected exit code %d, got %d", interruptedExitCode, exitCode)
+	}
+	if stderr.String() != "Command aborted.\n" {
+		t.Fatalf("expected the command to be aborted, got %q", stderr.String())
+	}
+	if fakeExecRunner.HasRunArgs([]string{"delete", "pod", "foo"}) {
+		t.Fatalf("expected the command not to be executed")
+	}
+}
+
+func TestCreateTempFile(t *testing.T) {
+	o := &confirmOptions{}
+	f, err := o.createTempFile("test-*.yaml")
+	if err != nil {
+		t.Fatalf("createTempFile failed: %v", err)
+	}
+	_ = f.Close()
+	dir := filepath.Dir(f.Name())
+	if runtime.GOOS != "windows" {
+		if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0700 {
+			t.Fatalf("expected a private directory, got %v (%v)", fi.Mode(), err)
+		}
+		if fi, err := os.Stat(f.Name()); err != nil || fi.Mode().Perm() != 0600 {
+			t.Fatalf("expected a private file, got %v (%v)", fi.Mode(), err)
+		}
+	}
+	o.cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the temp directory to be removed, got %v", err)
+	}
+}
+
+// fakeSignal replaces signal.NotifyContext to simulate a signal that is received right away
+func fakeSignal(parent context.Context, _ ...os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	cancel()
+	return ctx, cancel
+}
@@ -17,10 +17,6 @@ limitations under the License.
 package cmd
 
 import (
-	"bytes"
-	"fmt"
-	"os"
-
 	"github.com/spf13/cobra"
 
 	"github.com/brianpursley/kubectl-confirm/internal/util"
@@ -35,26 +31,15 @@ func (o *confirmOptions) diff(cmd *cobra.Command) error {
 		return nil
 	}
 
-	stdout := bytes.Buffer{}
-	stderr := bytes.Buffer{}
-
-	err := util.ExecRun(util.GetKubectlPath(), append(os.Args[1:], "--dry-run=server", "--output=yaml"), cmd.InOrStdin(), &stdout, &stderr)
-	if err != nil {
-		return fmt.Errorf("%s", stderr.String())
-	}
-
-	f, err := os.CreateTemp("", "kubectl-confirm-")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(f.Name())
-	if _, err := f.Write(stdout.Bytes()); err != nil {
-		return err
+	r := o.policy.redactor()
+	changed := false
+	for _, p := range o.preview {
+		if diff := p.diff(r); len(diff) > 0 {
+			cmd.Print(diff)
+			changed = true
+		}
 	}
-
-	// Run kubectl diff
-	err = util.ExecRun(util.GetKubectlPath(), []string{"diff", "--filename", f.Name()}, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
-	if err == nil {
+	if !changed {
 		cmd.Println("no changes detected")
 	}
 	return nil
@@ -17,87 +17,116 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
-	"os"
-	"reflect"
+	"encoding/json"
 	"testing"
 
 	"github.com/brianpursley/kubectl-confirm/internal/util"
 )
 
 func TestDiff(t *testing.T) {
+	salt := redactionSalt
+	defer func() {
+		redactionSalt = salt
+	}()
+	redactionSalt = []byte("test")
+
+	configMapRule := redactionRule{Kinds: []string{"ConfigMap"}, Keys: "(?i)password"}
+	_ = configMapRule.compile()
+
 	testCases := []struct {
-		name                      string
-		options                   confirmOptions
-		osArgs                    []string
-		expectKubectlRun          bool
-		expectedKubectlDryRunArgs []string
-		fakeKubectlDiffStdout     string
-		expectedStdout            string
+		name           string
+		options        confirmOptions
+		live           []string
+		merged         []string
+		expectedStdout string
 	}{
 		{
 			name: "non regular files",
 			options: confirmOptions{
 				hasAnyNonRegularFiles: true,
 			},
-			expectKubectlRun: false,
 			expectedStdout: `========== Diff =============
 *** Skipped because one or more non-regular files were specified ***
 
 `,
 		},
 		{
-			name:                      "single file no changes",
-			osArgs:                    []string{"kubectl-confirm", "apply", "--filename", "foo.yaml"},
-			expectKubectlRun:          true,
-			expectedKubectlDryRunArgs: []string{"apply", "--filename", "foo.yaml", "--dry-run=server", "--output=yaml"},
-			fakeKubectlDiffStdout:     "",
+			name:   "no changes",
+			live:   []string{`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "bar"}, "data": {"a": "1"}}`},
+			merged: []string{`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "bar"}, "data": {"a": "1"}}`},
 			expectedStdout: `========== Diff =============
 no changes detected
 
 `,
 		},
 		{
-			name:                      "single file with changes",
-			osArgs:                    []string{"kubectl-confirm", "apply", "--filename", "foo.yaml"},
-			expectKubectlRun:          true,
-			expectedKubectlDryRunArgs: []string{"apply", "--filename", "foo.yaml", "--dry-run=server", "--output=yaml"},
-			fakeKubectlDiffStdout:     "fake diff output\n",
-			expectedStdout: `========== Diff =============
-fake diff output
-
-`,
-		},
-		{
-			name:                      "multiple files",
-			osArgs:                    []string{"kubectl-confirm", "apply", "--filename", "foo.yaml", "--filename", "bar.yaml"},
-			expectKubectlRun:          true,
-			expectedKubectlDryRunArgs: []string{"apply", "--filename", "foo.yaml", "--filename", "bar.yaml", "--dry-run=server", "--output=yaml"},
-			fakeKubectlDiffStdout:     "fake diff output\n",
+			name: "changed and created objects",
+			live: []string{
+				`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "bar", "managedFields": [{"manager": "kubectl"}]}, "data": {"a": "1"}}`,
+				``,
+			},
+			merged: []string{
+				`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "bar", "managedFields": [{"manager": "kubectl", "time": "now"}]}, "data": {"a": "2"}}`,
+				`{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": {"name": "baz"}}`,
+			},
 			expectedStdout: `========== Diff =============
-fake diff output
+--- live/v1.ConfigMap.bar.foo
++++ merged/v1.ConfigMap.bar.foo
+@@ -1,6 +1,6 @@
+ apiVersion: v1
+ data:
+-  a: "1"
++  a: "2"
+ kind: ConfigMap
+ metadata:
+   name: foo
+--- live/rbac.authorization.k8s.io.v1.ClusterRole.baz
++++ merged/rbac.authorization.k8s.io.v1.ClusterRole.baz
+@@ -0,0 +1,4 @@
++apiVersion: rbac.authorization.k8s.io/v1
++kind: ClusterRole
++metadata:
++  name: baz
 
 `,
 		},
 		{
-			name:                      "recursive",
-			osArgs:                    []string{"kubectl-confirm", "apply", "--filename", "foo/", "--recursive"},
-			expectKubectlRun:          true,
-			expectedKubectlDryRunArgs: []string{"apply", "--filename", "foo/", "--recursive", "--dry-run=server", "--output=yaml"},
-			fakeKubectlDiffStdout:     "fake diff output\n",
+			name:   "secret values are masked",
+			live:   []string{`{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "foo"}, "data": {"password": "b2xk", "user": "YWRtaW4="}}`},
+			merged: []string{`{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "foo"}, "data": {"password": "bmV3", "user": "YWRtaW4=", "token": "eHl6"}}`},
 			expectedStdout: `========== Diff =============
-fake diff output
+--- live/v1.Secret.foo
++++ merged/v1.Secret.foo
+@@ -1,6 +1,7 @@
+ apiVersion: v1
+ data:
+-  password: "*** (changed, hash a9f2f9d9bdf6)"
++  password: "*** (changed, hash 04ba5aa90ff9)"
++  token: "*** (changed, hash 0463f45f8f0d)"
+   user: "*** (unchanged, hash 2b01a0fdfe27)"
+ kind: Secret
+ metadata:
 
 `,
 		},
 		{
-			name:                      "kustomize",
-			osArgs:                    []string{"kubectl-confirm", "apply", "--kustomize", "foo/"},
-			expectKubectlRun:          true,
-			expectedKubectlDryRunArgs: []string{"apply", "--kustomize", "foo/", "--dry-run=server", "--output=yaml"},
-			fakeKubectlDiffStdout:     "fake diff output\n",
+			name:    "values are masked by redaction rules",
+			options: confirmOptions{policy: &policy{Redactions: []redactionRule{configMapRule}}},
+			live:    []string{`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo"}, "data": {"DB_PASSWORD": "old", "host": "db"}}`},
+			merged:  []string{`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo"}, "data": {"DB_PASSWORD": "new", "host": "db2"}}`},
 			expectedStdout: `========== Diff =============
-fake diff output
+--- live/v1.ConfigMap.foo
++++ merged/v1.ConfigMap.foo
+@@ -1,7 +1,7 @@
+ apiVersion: v1
+ data:
+-  DB_PASSWORD: "*** (changed, hash 55bbe9e2f4b2)"
+-  host: db
++  DB_PASSWORD: "*** (changed, hash 9e7a76dd6e80)"
++  host: db2
+ kind: ConfigMap
+ metadata:
+   name: foo
 
 `,
 		},
@@ -105,39 +134,20 @@ fake diff output
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			var fakeError error
-			if tc.fakeKubectlDiffStdout != "" {
-				fakeError = fmt.Errorf("exit status 1")
+			for i := range tc.merged {
+				p := previewObject{}
+				if len(tc.live[i]) > 0 {
+					_ = json.Unmarshal([]byte(tc.live[i]), &p.live)
+				}
+				_ = json.Unmarshal([]byte(tc.merged[i]), &p.merged)
+				tc.options.preview = append(tc.options.preview, p)
 			}
-			fakeExecRunner := util.NewFakeExecRunner()
-			fakeExecRunner.SetupRun("fake dry run output", "", nil)          // Dry run
-			fakeExecRunner.SetupRun(tc.fakeKubectlDiffStdout, "", fakeError) // Diff
 
 			cmd, _, stdout, stderr := util.NewTestCommand()
-
-			os.Args = tc.osArgs
-
-			err := tc.options.diff(cmd)
-			if err != nil {
+			if err := tc.options.diff(cmd); err != nil {
 				t.Fatalf("diff failed: %v", err)
 			}
 
-			if tc.expectKubectlRun {
-				if fakeExecRunner.RunNames[0] != "kubectl" {
-					t.Fatalf("expected kubectl to be run, but it was not")
-				}
-				if !reflect.DeepEqual(fakeExecRunner.RunArgs[0], tc.expectedKubectlDryRunArgs) {
-					t.Fatalf("wrong kubectl args.\nexpected: %v\ngot: %v\n", tc.expectedKubectlDryRunArgs, fakeExecRunner.RunArgs[0])
-				}
-
-				if fakeExecRunner.RunNames[1] != "kubectl" {
-					t.Fatalf("expected kubectl to be run, but it was not")
-				}
-				if fakeExecRunner.RunArgs[1][0] != "diff" {
-					t.Fatalf("expected kubectl diff to be called, but it was not")
-				}
-			}
-
 			if stdout.String() != tc.expectedStdout {
 				t.Fatalf("wrong stdout\nexpected:\n%s\ngot:\n%s\n", tc.expectedStdout, stdout.String())
 			}
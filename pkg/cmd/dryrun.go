@@ -18,13 +18,19 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+
 	"github.com/spf13/cobra"
-	"os"
 
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
 	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
 )
 
+// The note shown above the dry run summary of commands that have a diff, which is not what kubectl itself prints
+const derivedDryRunNote = "*** Derived from the objects returned by the server dry run, so kubectl may word it differently ***"
+
 func (o *confirmOptions) dryRun(cmd *cobra.Command) error {
 	util.PrintSectionTitle(cmd, "Dry Run")
 	defer cmd.Println()
@@ -34,14 +40,77 @@ func (o *confirmOptions) dryRun(cmd *cobra.Command) error {
 		return nil
 	}
 
+	// Commands that have a diff share its server dry run, so the summary is derived from the same result. It is labeled
+	// as such, because kubectl prints some commands differently, like "image updated" for set image.
+	if diffCommands[o.args.Verb()] {
+		if len(o.preview) > 0 {
+			cmd.Println(derivedDryRunNote)
+		}
+		for _, p := range o.preview {
+			cmd.Println(p.summary(o.args.Verb()))
+		}
+		return nil
+	}
+
+	// Objects printed by the command are redacted, so they are requested as JSON and printed in the requested format.
+	// Templates can print any value, so only the names of the objects are printed instead.
+	output := o.args.Value("output")
+	switch {
+	case output == "json" || output == "yaml":
+		return o.printRedactedDryRun(cmd, output)
+	case output != "" && output != "name" && output != "wide":
+		cmd.Printf("*** Showing names only, because -o %s could print sensitive values ***\n", output)
+		return o.printDryRun(cmd, kubeargs.Parse(o.args.Without("output")).With("--dry-run=server", "--output=name"))
+	}
+	return o.printDryRun(cmd, o.args.With("--dry-run=server"))
+}
+
+func (o *confirmOptions) printDryRun(cmd *cobra.Command, args []string) error {
 	stdout := bytes.Buffer{}
 	stderr := bytes.Buffer{}
-
-	err := util.ExecRun(util.GetKubectlPath(), append(os.Args[1:], "--dry-run=server"), cmd.InOrStdin(), &stdout, &stderr)
+	err := o.runKubectl(cmd.Context(), args, o.manifestInput(cmd), &stdout, &stderr)
 	if err != nil {
 		return fmt.Errorf("%s", stderr.String())
 	}
+	o.addWarnings(util.ParseWarnings(stderr.String()))
 
 	cmd.Print(stdout.String())
 	return nil
 }
+
+// printRedactedDryRun prints the objects returned by a server dry run in the output format, with their sensitive
+// values masked
+func (o *confirmOptions) printRedactedDryRun(cmd *cobra.Command, output string) error {
+	args := kubeargs.Parse(o.args.Without("output")).With("--dry-run=server", "--output=json")
+	var result map[string]interface{}
+	warnings, err := util.ExecKubectlJSONWithWarnings(cmd.Context(), o.runner(), args, o.manifestInput(cmd), &result)
+	if err != nil {
+		return err
+	}
+	o.addWarnings(warnings)
+	if result == nil {
+		return nil
+	}
+
+	r := o.policy.redactor()
+	if items, found := result["items"].([]interface{}); found {
+		for i, item := range items {
+			if obj, ok := item.(map[string]interface{}); ok {
+				items[i] = r.redact(obj)
+			}
+		}
+	} else {
+		result = r.redact(result)
+	}
+
+	if output == "yaml" {
+		cmd.Print(yaml.Marshal(result))
+		return nil
+	}
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return err
+	}
+	cmd.Println(string(data))
+	return nil
+}
@@ -18,7 +18,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"reflect"
 	"testing"
 
@@ -26,6 +25,12 @@ import (
 )
 
 func TestDryRun(t *testing.T) {
+	salt := redactionSalt
+	defer func() {
+		redactionSalt = salt
+	}()
+	redactionSalt = []byte("test")
+
 	testCases := []struct {
 		name                string
 		options             confirmOptions
@@ -60,6 +65,76 @@ func TestDryRun(t *testing.T) {
 			expectedStdout: `========== Dry Run ==========
 fake dry run output
 
+`,
+		},
+		{
+			name: "diff-able command uses the shared server dry run",
+			options: confirmOptions{
+				preview: []previewObject{{merged: map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "foo"}}}},
+			},
+			expectKubectl: false,
+			fakeOsArgs:    []string{"confirm", "apply", "-f", "foo.yaml"},
+			expectedStdout: `========== Dry Run ==========
+` + derivedDryRunNote + `
+configmap/foo created (server dry run)
+
+`,
+		},
+		{
+			name:                "yaml output is redacted",
+			options:             confirmOptions{},
+			expectKubectl:       true,
+			fakeOsArgs:          []string{"confirm", "foo", "secret", "bar", "-o", "yaml"},
+			expectedKubectlArgs: []string{"foo", "secret", "bar", "--dry-run=server", "--output=json"},
+			fakeKubectlStdout:   `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "foo"}, "data": {"password": "aHVudGVyMg=="}}`,
+			expectedStdout: `========== Dry Run ==========
+apiVersion: v1
+data:
+  password: "*** (hash 7129e07e3ffd)"
+kind: Secret
+metadata:
+  name: foo
+
+`,
+		},
+		{
+			name:                "json output is redacted",
+			options:             confirmOptions{},
+			expectKubectl:       true,
+			fakeOsArgs:          []string{"confirm", "foo", "-f", "foo.yaml", "--output=json"},
+			expectedKubectlArgs: []string{"foo", "-f", "foo.yaml", "--dry-run=server", "--output=json"},
+			fakeKubectlStdout:   `{"apiVersion": "v1", "kind": "List", "items": [{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "foo"}, "stringData": {"password": "hunter2"}}]}`,
+			expectedStdout: `========== Dry Run ==========
+{
+    "apiVersion": "v1",
+    "items": [
+        {
+            "apiVersion": "v1",
+            "kind": "Secret",
+            "metadata": {
+                "name": "foo"
+            },
+            "stringData": {
+                "password": "*** (hash 5fb1e13daf51)"
+            }
+        }
+    ],
+    "kind": "List"
+}
+
+`,
+		},
+		{
+			name:                "template output shows names only",
+			options:             confirmOptions{},
+			expectKubectl:       true,
+			fakeOsArgs:          []string{"confirm", "foo", "-f", "foo.yaml", "-o", "jsonpath={.data}"},
+			expectedKubectlArgs: []string{"foo", "-f", "foo.yaml", "--dry-run=server", "--output=name"},
+			fakeKubectlStdout:   "secret/foo\n",
+			expectedStdout: `========== Dry Run ==========
+*** Showing names only, because -o jsonpath={.data} could print sensitive values ***
+secret/foo
+
 `,
 		},
 		{
@@ -82,7 +157,7 @@ fake dry run output
 			fakeExecRunner := util.NewFakeExecRunner()
 			fakeExecRunner.SetupRun(tc.fakeKubectlStdout, tc.fakeKubectlStderr, tc.fakeKubectlError)
 
-			os.Args = tc.fakeOsArgs
+			tc.options.parseArgs(tc.fakeOsArgs[1:])
 			cmd, _, stdout, stderr := util.NewTestCommand()
 
 			err := tc.options.dryRun(cmd)
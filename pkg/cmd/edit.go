@@ -0,0 +1,175 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+// Edit flags that are not accepted by kubectl get, or that would change the output format
+var editOnlyFlags = []string{
+	"field-manager", "output", "output-patch", "record", "save-config", "validate", "windows-line-endings",
+}
+
+// The field manager that kubectl edit uses by default
+const defaultEditFieldManager = "kubectl-edit"
+
+// edit replaces kubectl edit with a confirmed flow: the objects are fetched and opened in an editor, and the edited
+// copy is previewed and then only applied using kubectl replace if the user confirms.
+func (o *confirmOptions) edit(cmd *cobra.Command) error {
+	getArgs := append([]string{"get"}, o.args.Operands()...)
+	getArgs = append(getArgs, o.args.FlagArgs(func(f kubeargs.Flag) bool {
+		return !containsString(editOnlyFlags, f.Name)
+	})...)
+	getArgs = append(getArgs, "-o", "json")
+
+	// Get the live objects. They are fetched as JSON, so that the diff can be redacted, and converted to YAML for editing.
+	var result map[string]interface{}
+	err := runInterruptible(cmd, o.signals(), func(ctx context.Context) error {
+		return util.ExecKubectlJSON(ctx, o.runner(), getArgs, cmd.InOrStdin(), &result)
+	})
+	if errors.Is(err, errInterrupted) {
+		o.abort(cmd, interruptedExitCode)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	liveObjects := map[string]map[string]interface{}{}
+	for _, obj := range util.ObjectItems(result) {
+		liveObjects[objectKey(obj)] = obj
+	}
+	live := yaml.Marshal(result)
+
+	f, err := o.createTempFile("edit-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer o.cleanup()
+	if _, err := f.WriteString(live); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// Let the user edit a copy of the live objects
+	// Ctrl-C is handled by the editor, so only SIGTERM interrupts it, the same as when git runs an editor. SIGINT is
+	// caught and dropped rather than ignored, because an ignored signal stays ignored in the editor and in every
+	// kubectl run afterwards.
+	editor := util.GetEditor()
+	editorInterrupts := make(chan os.Signal, 1)
+	signal.Notify(editorInterrupts, os.Interrupt)
+	err = runInterruptible(cmd, []os.Signal{syscall.SIGTERM}, func(ctx context.Context) error {
+		return util.ExecRun(ctx, editor[0], append(editor[1:], f.Name()), cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+	})
+	signal.Stop(editorInterrupts)
+	if errors.Is(err, errInterrupted) {
+		o.abort(cmd, interruptedExitCode)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("editor %q failed: %v", strings.Join(editor, " "), err)
+	}
+	editedBytes, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	edited := string(editedBytes)
+	if edited == live || strings.TrimSpace(edited) == "" {
+		cmd.PrintErr("Edit cancelled, no changes made.\n")
+		return nil
+	}
+
+	fieldManager := o.args.Value("field-manager")
+	if len(fieldManager) == 0 {
+		fieldManager = defaultEditFieldManager
+	}
+	o.editedFile = f.Name()
+	replaceArgs := append([]string{"replace", "--filename", f.Name(), "--field-manager=" + fieldManager}, o.globalFlags()...)
+	if len(o.namespace) > 0 {
+		replaceArgs = append(replaceArgs, "--namespace="+o.namespace)
+	}
+
+	// Config, Dry Run, and Diff
+	steps := []previewStep{
+		{name: "config", run: o.printConfig},
+		{name: "dry run", run: func(cmd *cobra.Command) error {
+			return o.editDryRun(cmd, replaceArgs, liveObjects)
+		}},
+	}
+	o.startReport(cmd)
+	if err := o.runSteps(cmd, steps); errors.Is(err, errInterrupted) {
+		o.abort(cmd, interruptedExitCode)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// GitOps and Warnings, now that the live objects and the result of the dry run are known
+	o.printGitOps(cmd)
+	o.printWarnings(cmd)
+
+	// Check the policy, now that the config is known
+	if err := o.checkPolicy("edit"); err != nil {
+		return err
+	}
+
+	// Prompt
+	if !o.confirm(cmd, replaceArgs) {
+		return nil
+	}
+
+	// Apply the edited objects
+	return o.executeAndRecord(cmd, "edit", replaceArgs)
+}
+
+// editDryRun sends the edited objects to the server with a dry run, and shows the result and its diff with the live
+// objects, the same way as for apply
+func (o *confirmOptions) editDryRun(cmd *cobra.Command, replaceArgs []string, liveObjects map[string]map[string]interface{}) error {
+	var result map[string]interface{}
+	warnings, err := util.ExecKubectlJSONWithWarnings(cmd.Context(), o.runner(), append(replaceArgs, "--dry-run=server", "--output=json"), cmd.InOrStdin(), &result)
+	if err != nil {
+		return err
+	}
+	o.addWarnings(warnings)
+	o.preview = nil
+	for _, obj := range util.ObjectItems(result) {
+		o.preview = append(o.preview, previewObject{live: liveObjects[objectKey(obj)], merged: obj})
+	}
+
+	util.PrintSectionTitle(cmd, "Dry Run")
+	if len(o.preview) > 0 {
+		cmd.Println(derivedDryRunNote)
+	}
+	for _, p := range o.preview {
+		cmd.Println(p.summary("replace"))
+	}
+	cmd.Println()
+
+	return o.diff(cmd)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestEdit(t *testing.T) {
+	liveJSON := `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "foo", "namespace": "bar"}, "spec": {"replicas": 1}}`
+	liveYaml := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: foo\n  namespace: bar\nspec:\n  replicas: 1\n"
+	editedYaml := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: foo\n  namespace: bar\nspec:\n  replicas: 3\n"
+	dryRunJSON := `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "foo", "namespace": "bar"}, "spec": {"replicas": 3}}`
+
+	testCases := []struct {
+		name                string
+		options             confirmOptions
+		fakeOsArgs          []string
+		editedYaml          string
+		response            string
+		expectedGetArgs     []string
+		expectedReplaceArgs []string
+		expectedRunCount    int
+		expectedStdout      []string
+		expectedStderr      string
+		expectedExitCode    int
+	}{
+		{
+			name:             "unchanged edit is cancelled",
+			fakeOsArgs:       []string{"confirm", "edit", "deploy/foo"},
+			editedYaml:       liveYaml,
+			expectedGetArgs:  []string{"get", "deploy/foo", "-o", "json"},
+			expectedRunCount: 2,
+			expectedStderr:   "Edit cancelled, no changes made.",
+		},
+		{
+			name:             "empty edit is cancelled",
+			fakeOsArgs:       []string{"confirm", "edit", "deploy/foo"},
+			editedYaml:       "\n",
+			expectedGetArgs:  []string{"get", "deploy/foo", "-o", "json"},
+			expectedRunCount: 2,
+			expectedStderr:   "Edit cancelled, no changes made.",
+		},
+		{
+			name:                "confirmed edit is replaced",
+			fakeOsArgs:          []string{"confirm", "edit", "deploy/foo", "--context=ctx", "-n", "bar", "--save-config", "--field-manager", "me"},
+			editedYaml:          editedYaml,
+			response:            "yes\n",
+			expectedGetArgs:     []string{"get", "deploy/foo", "--context=ctx", "--namespace=bar", "-o", "json"},
+			expectedReplaceArgs: []string{"replace", "--filename", "", "--field-manager=me", "--context=ctx", "--namespace=bar"},
+			expectedRunCount:    5,
+			expectedStdout: []string{
+				"========== Dry Run ==========\n" + derivedDryRunNote + "\ndeployment.apps/foo replaced (server dry run)\n",
+				"========== Diff =============\n--- live/apps.v1.Deployment.bar.foo\n+++ merged/apps.v1.Deployment.bar.foo\n@@ -4,4 +4,4 @@\n   name: foo\n   namespace: bar\n spec:\n-  replicas: 1\n+  replicas: 3\n",
+				"The following command will be executed:\nkubectl replace --filename ",
+			},
+		},
+		{
+			name:             "aborted edit is not replaced",
+			fakeOsArgs:       []string{"confirm", "edit", "deploy/foo"},
+			editedYaml:       editedYaml,
+			response:         "no\n",
+			expectedGetArgs:  []string{"get", "deploy/foo", "-o", "json"},
+			expectedRunCount: 4,
+			expectedStderr:   "Command aborted.",
+			expectedExitCode: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_ = os.Setenv("KUBE_EDITOR", "fake-editor --wait")
+			defer os.Unsetenv("KUBE_EDITOR")
+
+			var actualExitCode int
+			util.Exit = func(code int) {
+				actualExitCode = code
+			}
+
+			var editedFile string
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun(liveJSON, "", nil)
+			fakeExecRunner.SetupRunWithAction(func(args []string) error {
+				// The editor must not inherit SIGINT as ignored
+				if signal.Ignored(os.Interrupt) {
+					t.Errorf("expected SIGINT not to be ignored while the editor runs")
+				}
+				editedFile = args[len(args)-1]
+				return os.WriteFile(editedFile, []byte(tc.editedYaml), 0600)
+			})
+			fakeExecRunner.SetupRunMatching(util.ArgsContain("config"), `{"current-context": "ctx", "contexts": [{"name": "ctx", "context": {}}]}`, "", nil)
+			fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), dryRunJSON, "", nil)
+			fakeExecRunner.SetupRun("fake replace output\n", "", nil)
+
+			tc.options.parseArgs(tc.fakeOsArgs[1:])
+			cmd, stdin, stdout, stderr := util.NewTestCommand()
+			stdin.Write(bytes.NewBufferString(tc.response).Bytes())
+
+			if err := tc.options.edit(cmd); err != nil {
+				t.Fatalf("edit failed: %v", err)
+			}
+
+			if fakeExecRunner.RunCount() != tc.expectedRunCount {
+				t.Fatalf("wrong run count. expected: %d, got: %d", tc.expectedRunCount, fakeExecRunner.RunCount())
+			}
+			if !reflect.DeepEqual(fakeExecRunner.RunArgs[0], tc.expectedGetArgs) {
+				t.Fatalf("wrong get args.\nexpected: %v\ngot: %v\n", tc.expectedGetArgs, fakeExecRunner.RunArgs[0])
+			}
+			if fakeExecRunner.RunNames[1] != "fake-editor" || !reflect.DeepEqual(fakeExecRunner.RunArgs[1], []string{"--wait", editedFile}) {
+				t.Fatalf("wrong editor run: %s %v", fakeExecRunner.RunNames[1], fakeExecRunner.RunArgs[1])
+			}
+			if tc.expectedReplaceArgs != nil {
+				tc.expectedReplaceArgs[2] = editedFile
+				if !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), tc.expectedReplaceArgs) {
+					t.Fatalf("wrong replace args.\nexpected: %v\ngot: %v\n", tc.expectedReplaceArgs, fakeExecRunner.LastRunArgs())
+				}
+				expectedDryRunArgs := append(tc.expectedReplaceArgs, "--dry-run=server", "--output=json")
+				if !fakeExecRunner.HasRunArgs(expectedDryRunArgs) {
+					t.Fatalf("expected a dry run with args %v, but got: %v", expectedDryRunArgs, fakeExecRunner.RunArgs)
+				}
+
+				// The edited objects are saved with the record, because the temp file is removed
+				record, err := loadChangeRecord(getHistoryDir(), tc.options.changeID())
+				if err != nil {
+					t.Fatal(err)
+				}
+				saved := filepath.Join(getHistoryDir(), record.ID, changeEditedFile)
+				if record.Args[2] != saved {
+					t.Fatalf("expected the record to refer to %s, got %v", saved, record.Args)
+				}
+				if data, err := os.ReadFile(saved); err != nil || string(data) != tc.editedYaml {
+					t.Fatalf("expected the edited objects to be saved, got %q, %v", string(data), err)
+				}
+			}
+			for _, s := range tc.expectedStdout {
+				if !strings.Contains(stdout.String(), s) {
+					t.Fatalf("expected stdout to contain %q, but it did not\n%s", s, stdout.String())
+				}
+			}
+			if !strings.Contains(stderr.String(), tc.expectedStderr) {
+				t.Fatalf("expected stderr to contain %q, but it did not", tc.expectedStderr)
+			}
+			if signal.Ignored(os.Interrupt) {
+				t.Fatal("expected SIGINT not to be ignored after the editor exits")
+			}
+			if actualExitCode != tc.expectedExitCode {
+				t.Fatalf("wrong exit code. expected: %d, got %d", tc.expectedExitCode, actualExitCode)
+			}
+			if _, err := os.Stat(editedFile); !os.IsNotExist(err) {
+				t.Fatalf("expected edited file %s to be removed", editedFile)
+			}
+		})
+	}
+}
+
+func TestEditedCopy(t *testing.T) {
+	const edited = "# edited by hand\nkind: Secret\n"
+	const configMap = `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}, "data": {"password": "hunter2"}}`
+	const secret = `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "b"}, "data": {"password": "aHVudGVyMg=="}}`
+	mask := func(v interface{}) string {
+		return newRedactor(nil).mask(v, "")
+	}
+	configMapRule := redactionRule{Kinds: []string{"ConfigMap"}, Keys: "(?i)password"}
+	_ = configMapRule.compile()
+
+	testCases := []struct {
+		name     string
+		policy   *policy
+		merged   []string
+		expected string
+	}{
+		{
+			name:     "nothing is masked",
+			merged:   []string{configMap},
+			expected: edited,
+		},
+		{
+			name:   "secrets are masked",
+			merged: []string{configMap, secret},
+			expected: "apiVersion: v1\nitems:\n- apiVersion: v1\n  data:\n    password: hunter2\n  kind: ConfigMap\n  metadata:\n    name: a\n" +
+				"- apiVersion: v1\n  data:\n    password: \"" + mask("aHVudGVyMg==") + "\"\n  kind: Secret\n  metadata:\n    name: b\nkind: List\n",
+		},
+		{
+			name:   "redactions in the policy are masked",
+			policy: &policy{Redactions: []redactionRule{configMapRule}},
+			merged: []string{configMap},
+			expected: "apiVersion: v1\nitems:\n- apiVersion: v1\n  data:\n    password: \"" + mask("hunter2") + "\"\n  kind: ConfigMap\n  metadata:\n    name: a\n" +
+				"kind: List\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "edit.yaml")
+			if err := os.WriteFile(file, []byte(edited), 0600); err != nil {
+				t.Fatal(err)
+			}
+			o := &confirmOptions{policy: tc.policy, editedFile: file}
+			for _, m := range tc.merged {
+				o.preview = append(o.preview, previewObject{merged: decodeTestObject(t, m)})
+			}
+			actual, err := o.editedCopy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != tc.expected {
+				t.Fatalf("wrong edited copy.\nexpected:\n%s\ngot:\n%s", tc.expected, string(actual))
+			}
+		})
+	}
+}
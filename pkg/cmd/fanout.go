@@ -0,0 +1,442 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// Responses to the prompt for multiple contexts or namespaces
+const (
+	confirmAllResponse  = "all"
+	confirmEachResponse = "each"
+)
+
+// fanOutRun is the command in one of the contexts or namespaces it is run in. The context or namespace is empty if
+// the command is not run in several of them.
+type fanOutRun struct {
+	context   string
+	namespace string
+	options   *confirmOptions
+	result    string
+}
+
+// name identifies the context and namespace of the run, like prod-us, tenant-a, or prod-us/tenant-a
+func (r *fanOutRun) name() string {
+	if len(r.context) > 0 && len(r.namespace) > 0 {
+		return r.context + "/" + r.namespace
+	}
+	return r.context + r.namespace
+}
+
+// runFanOut previews the command in each of the contexts and namespaces specified by --contexts,
+// --confirm-namespaces, and --confirm-namespace-selector, shows a summary, and then executes it in each of them after
+// the user confirms all of them at once, or each of them separately. Execution stops at the first one the command
+// fails in, unless --continue-on-error is specified.
+func (o *confirmOptions) runFanOut(cmd *cobra.Command, commandName string) error {
+	if commandName == "edit" {
+		return fmt.Errorf("--contexts, --confirm-namespaces, and --confirm-namespace-selector cannot be used with edit")
+	}
+	if o.verify {
+		return fmt.Errorf("--confirm-verify cannot be used with --contexts, --confirm-namespaces, or --confirm-namespace-selector")
+	}
+	if len(o.contexts) > 0 && len(o.context) > 0 {
+		return fmt.Errorf("--contexts and --context cannot be used together")
+	}
+	if (len(o.namespaces) > 0 || len(o.namespaceSelector) > 0) && (len(o.namespace) > 0 || o.args.Has("all-namespaces")) {
+		return fmt.Errorf("--confirm-namespaces and --confirm-namespace-selector cannot be used with --namespace or --all-namespaces")
+	}
+	// Each run reads the files again, so they cannot be streams
+	o.checkForNonRegularFiles()
+	if o.hasAnyNonRegularFiles || containsString(o.filenames, "-") {
+		return fmt.Errorf("the command cannot be run in several contexts or namespaces with stdin or non-regular files, because they can only be read once")
+	}
+
+	runs, err := o.resolveFanOut(cmd)
+	if err != nil {
+		return err
+	}
+	o.startReport(cmd)
+
+	// Preview the command in each context and namespace
+	for _, r := range runs {
+		printFanOutTitle(cmd, r)
+		var targetArgs []string
+		if len(r.context) > 0 {
+			targetArgs = append(targetArgs, "--context="+r.context)
+		}
+		if len(r.namespace) > 0 {
+			targetArgs = append(targetArgs, "--namespace="+r.namespace)
+		}
+		r.options = o.forTarget(o.args.With(targetArgs...))
+		if err := r.options.runSteps(cmd, r.options.previewSteps(commandName)); errors.Is(err, errInterrupted) {
+			o.abort(cmd, interruptedExitCode)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %v", r.name(), err)
+		}
+		r.options.printGitOps(cmd)
+		r.options.printWarnings(cmd)
+		if err := r.options.checkPolicy(commandName); err != nil {
+			return fmt.Errorf("%s: %v", r.name(), err)
+		}
+	}
+	printFanOutSummary(cmd, commandName, runs)
+
+	// Prompt
+	each, err := o.promptFanOut(cmd, runs)
+	o.stopReport(cmd)
+	if err != nil {
+		for _, r := range runs {
+			r.options.recordAborted(cmd, commandName, r.options.args.Raw())
+		}
+	}
+	if errors.Is(err, errInterrupted) {
+		o.abort(cmd, interruptedExitCode)
+		return nil
+	} else if err != nil {
+		o.abort(cmd, abortedExitCode)
+		return nil
+	}
+
+	// Execute the command in each context and namespace
+	failed := 0
+	for _, r := range runs {
+		if failed > 0 && !o.continueOnError {
+			r.result = "not executed, because the command failed before"
+			continue
+		}
+		printFanOutTitle(cmd, r)
+		if each {
+			confirmed, err := r.options.prompt(cmd, r.options.args.Raw())
+			if errors.Is(err, errInterrupted) {
+				o.abort(cmd, interruptedExitCode)
+				return nil
+			}
+			if !confirmed {
+				r.options.recordAborted(cmd, commandName, r.options.args.Raw())
+				r.result = "skipped"
+				continue
+			}
+		}
+		// Stdin is not passed to kubectl, because it is used for the prompts
+		snapshot, unsavedSecrets := r.options.saveSnapshot(cmd)
+		err := runInterruptible(cmd, o.signals(), func(ctx context.Context) error {
+			return r.options.runKubectl(ctx, r.options.args.Raw(), nil, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		})
+		if errors.Is(err, errInterrupted) {
+			o.cleanup()
+			util.Exit(interruptedExitCode)
+			return nil
+		}
+		record := r.options.newChangeRecord(commandName, r.options.args.Raw(), err)
+		record.Snapshot = snapshot
+		record.UnsavedSecrets = unsavedSecrets
+		r.options.recordChange(cmd, record)
+		if err != nil {
+			r.result = fmt.Sprintf("failed: %v", err)
+			failed++
+			continue
+		}
+		r.result = "succeeded"
+		cmd.Println()
+	}
+	printFanOutResults(cmd, "Results", runs, func(r *fanOutRun) string {
+		return r.result
+	}, "")
+
+	if failed > 0 {
+		return fmt.Errorf("the command failed in %d of %d %s", failed, len(runs), fanOutNoun(runs))
+	}
+	return nil
+}
+
+// forTarget returns the options of the command in one of the contexts or namespaces it is run in, given its args
+// there. They share the policy and the report, and run kubectl and handle signals the same way.
+func (o *confirmOptions) forTarget(args []string) *confirmOptions {
+	target := &confirmOptions{
+		policy:          o.policy,
+		report:          o.report,
+		embedded:        o.embedded,
+		execRunner:      o.execRunner,
+		embeddedSignals: o.embeddedSignals,
+	}
+	target.parseArgs(args)
+	return target
+}
+
+// resolveFanOut returns a run for each combination of the contexts and namespaces to run the command in
+func (o *confirmOptions) resolveFanOut(cmd *cobra.Command) ([]*fanOutRun, error) {
+	contexts := []string{""}
+	if len(o.contexts) > 0 {
+		resolved, err := o.resolveContexts(cmd)
+		if err != nil {
+			return nil, err
+		}
+		contexts = resolved
+	}
+
+	var runs []*fanOutRun
+	for _, c := range contexts {
+		namespaces, err := o.resolveNamespaces(cmd, c)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range namespaces {
+			runs = append(runs, &fanOutRun{context: c, namespace: ns})
+		}
+	}
+	return runs, nil
+}
+
+// resolveContexts returns the contexts specified by --contexts, which is a comma separated list of contexts. Glob
+// patterns, like prod-*, are replaced by the matching contexts in the kubeconfig.
+func (o *confirmOptions) resolveContexts(cmd *cobra.Command) ([]string, error) {
+	var contexts []string
+	var kubeconfigContexts []string
+	for _, pattern := range splitList(o.contexts) {
+		if !strings.ContainsAny(pattern, "*?[") {
+			contexts = appendUnique(contexts, pattern)
+			continue
+		}
+		if kubeconfigContexts == nil {
+			names, err := o.getContextNames(cmd)
+			if err != nil {
+				return nil, err
+			}
+			kubeconfigContexts = names
+		}
+		matched := false
+		for _, name := range kubeconfigContexts {
+			if matchesAnyPattern([]string{pattern}, name) {
+				contexts = appendUnique(contexts, name)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no contexts match %q", pattern)
+		}
+	}
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("--contexts requires at least one context")
+	}
+	return contexts, nil
+}
+
+// getContextNames returns the names of the contexts in the kubeconfig
+func (o *confirmOptions) getContextNames(cmd *cobra.Command) ([]string, error) {
+	args := []string{"config", "get-contexts", "-o", "name"}
+	if len(o.kubeconfig) > 0 {
+		args = append(args, "--kubeconfig="+o.kubeconfig)
+	}
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	if err := o.runKubectl(cmd.Context(), args, cmd.InOrStdin(), &stdout, &stderr); err != nil {
+		return nil, fmt.Errorf("%s", stderr.String())
+	}
+	return strings.Fields(stdout.String()), nil
+}
+
+// resolveNamespaces returns the namespaces in the context specified by --confirm-namespaces, which is a comma separated
+// list of namespaces, and --confirm-namespace-selector, which is a label selector of namespaces. If neither is
+// specified, the namespace is not changed, which is represented by an empty namespace.
+func (o *confirmOptions) resolveNamespaces(cmd *cobra.Command, context string) ([]string, error) {
+	if len(o.namespaces) == 0 && len(o.namespaceSelector) == 0 {
+		return []string{""}, nil
+	}
+	var namespaces []string
+	for _, ns := range splitList(o.namespaces) {
+		namespaces = appendUnique(namespaces, ns)
+	}
+	if len(o.namespaceSelector) > 0 {
+		args := append([]string{"get", "namespaces", "--selector=" + o.namespaceSelector, "-o", "name"}, o.globalFlags()...)
+		if len(context) > 0 {
+			args = append(args, "--context="+context)
+		}
+		stdout := bytes.Buffer{}
+		stderr := bytes.Buffer{}
+		if err := o.runKubectl(cmd.Context(), args, cmd.InOrStdin(), &stdout, &stderr); err != nil {
+			return nil, fmt.Errorf("%s", stderr.String())
+		}
+		matched := strings.Fields(stdout.String())
+		if len(matched) == 0 {
+			if len(context) > 0 {
+				return nil, fmt.Errorf("no namespaces in context %s match %q", context, o.namespaceSelector)
+			}
+			return nil, fmt.Errorf("no namespaces match %q", o.namespaceSelector)
+		}
+		for _, name := range matched {
+			namespaces = appendUnique(namespaces, strings.TrimPrefix(name, "namespace/"))
+		}
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("--confirm-namespaces requires at least one namespace")
+	}
+	return namespaces, nil
+}
+
+// promptFanOut asks the user to confirm the command in all contexts and namespaces at once, or in each of them
+// separately. It returns true if each of them must be confirmed separately, which is required if any of the previews
+// is incomplete, or the policy requires additional confirmation. An error is returned if the user did not confirm.
+func (o *confirmOptions) promptFanOut(cmd *cobra.Command, runs []*fanOutRun) (bool, error) {
+	util.PrintSectionTitle(cmd, "Confirm")
+	names := make([]string, 0, len(runs))
+	incomplete, challenged := false, false
+	for _, r := range runs {
+		names = append(names, r.name())
+		incomplete = incomplete || len(r.options.failedSteps) > 0
+		challenged = challenged || len(r.options.policyChallenges) > 0
+	}
+	cmd.Printf("The following command will be executed in %d %s (%s):\n%s %s\n\n",
+		len(runs), fanOutNoun(runs), strings.Join(names, ", "), util.GetKubectlPath(), strings.Join(redactArgs(o.args.Raw()), " "))
+	if incomplete || challenged {
+		if incomplete {
+			cmd.Printf("Some previews are incomplete, so each of them must be confirmed separately.\n")
+		} else {
+			cmd.Printf("The policy requires additional confirmation, so each of them must be confirmed separately.\n")
+		}
+		cmd.Printf("Enter '%s' to continue: ", confirmEachResponse)
+	} else {
+		cmd.Printf("Enter '%s' to execute it in all of them, or '%s' to confirm each of them separately: ", confirmAllResponse, confirmEachResponse)
+	}
+	response, err := readResponse(cmd, o.signals())
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case response == confirmEachResponse:
+		return true, nil
+	case response == confirmAllResponse && !incomplete && !challenged:
+		return false, nil
+	}
+	return false, fmt.Errorf("not confirmed")
+}
+
+// previewCounts returns the number of objects the command creates, changes, and leaves unchanged
+func (o *confirmOptions) previewCounts() (created, changed, unchanged int) {
+	for _, p := range o.preview {
+		switch {
+		case p.live == nil:
+			created++
+		case p.changed():
+			changed++
+		default:
+			unchanged++
+		}
+	}
+	return created, changed, unchanged
+}
+
+// previewSummary summarizes the preview of the command in one line
+func (o *confirmOptions) previewSummary(commandName string) string {
+	if len(o.failedSteps) > 0 {
+		names := make([]string, 0, len(o.failedSteps))
+		for _, f := range o.failedSteps {
+			names = append(names, f.name)
+		}
+		return "preview incomplete (" + strings.Join(names, ", ") + " failed)"
+	}
+	if !diffCommands[commandName] {
+		return "previewed"
+	}
+	return formatCounts(o.previewCounts())
+}
+
+func formatCounts(created, changed, unchanged int) string {
+	return fmt.Sprintf("%d created, %d changed, %d unchanged", created, changed, unchanged)
+}
+
+// fanOutNoun describes what the runs are in, like contexts or namespaces
+func fanOutNoun(runs []*fanOutRun) string {
+	if len(runs) > 0 && len(runs[0].context) > 0 && len(runs[0].namespace) > 0 {
+		return "contexts and namespaces"
+	} else if len(runs) > 0 && len(runs[0].namespace) > 0 {
+		return "namespaces"
+	}
+	return "contexts"
+}
+
+func printFanOutTitle(cmd *cobra.Command, r *fanOutRun) {
+	var parts []string
+	if len(r.context) > 0 {
+		parts = append(parts, "Context: "+r.context)
+	}
+	if len(r.namespace) > 0 {
+		parts = append(parts, "Namespace: "+r.namespace)
+	}
+	cmd.Printf("########## %s\n\n", strings.Join(parts, ", "))
+}
+
+// printFanOutSummary prints the effects of the command in each context and namespace, and their total
+func printFanOutSummary(cmd *cobra.Command, commandName string, runs []*fanOutRun) {
+	var totals [3]int
+	for _, r := range runs {
+		created, changed, unchanged := r.options.previewCounts()
+		totals[0], totals[1], totals[2] = totals[0]+created, totals[1]+changed, totals[2]+unchanged
+	}
+	footer := ""
+	if diffCommands[commandName] {
+		footer = "Total: " + formatCounts(totals[0], totals[1], totals[2])
+	}
+	printFanOutResults(cmd, "Summary", runs, func(r *fanOutRun) string {
+		return r.options.previewSummary(commandName)
+	}, footer)
+}
+
+// printFanOutResults prints a section with a line for each context and namespace, followed by the footer, if any
+func printFanOutResults(cmd *cobra.Command, title string, runs []*fanOutRun, result func(r *fanOutRun) string, footer string) {
+	util.PrintSectionTitle(cmd, title)
+	width := 0
+	for _, r := range runs {
+		if len(r.name()) > width {
+			width = len(r.name())
+		}
+	}
+	for _, r := range runs {
+		cmd.Printf("%-*s  %s\n", width, r.name(), result(r))
+	}
+	if len(footer) > 0 {
+		cmd.Println(footer)
+	}
+	cmd.Println()
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func appendUnique(values []string, s string) []string {
+	if containsString(values, s) {
+		return values
+	}
+	return append(values, s)
+}
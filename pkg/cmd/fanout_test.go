@@ -0,0 +1,377 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestResolveContexts(t *testing.T) {
+	testCases := []struct {
+		name             string
+		fakeOsArgs       []string
+		expectedContexts []string
+		expectedError    string
+		expectedRunArgs  []string
+	}{
+		{
+			name:             "list",
+			fakeOsArgs:       []string{"confirm", "--contexts=prod-us, prod-eu,prod-us", "apply", "-f", "x.yaml"},
+			expectedContexts: []string{"prod-us", "prod-eu"},
+		},
+		{
+			name:             "glob",
+			fakeOsArgs:       []string{"confirm", "--contexts", "prod-*,staging", "--kubeconfig", "kc", "apply", "-f", "x.yaml"},
+			expectedContexts: []string{"prod-eu", "prod-us", "staging"},
+			expectedRunArgs:  []string{"config", "get-contexts", "-o", "name", "--kubeconfig=kc"},
+		},
+		{
+			name:          "glob without matches",
+			fakeOsArgs:    []string{"confirm", "--contexts=dev-*", "apply", "-f", "x.yaml"},
+			expectedError: `no contexts match "dev-*"`,
+		},
+		{
+			name:          "empty",
+			fakeOsArgs:    []string{"confirm", "--contexts=,", "apply", "-f", "x.yaml"},
+			expectedError: "--contexts requires at least one context",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun("prod-eu\nprod-us\nstaging\n", "", nil)
+
+			o := &confirmOptions{}
+			o.parseArgs(tc.fakeOsArgs[1:])
+			cmd, _, _, _ := util.NewTestCommand()
+			contexts, err := o.resolveContexts(cmd)
+			if len(tc.expectedError) > 0 {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveContexts failed: %v", err)
+			}
+			if !reflect.DeepEqual(contexts, tc.expectedContexts) {
+				t.Fatalf("wrong contexts.\nexpected: %v\ngot: %v", tc.expectedContexts, contexts)
+			}
+			if tc.expectedRunArgs != nil && !fakeExecRunner.HasRunArgs(tc.expectedRunArgs) {
+				t.Fatalf("expected a run with args %v, got %v", tc.expectedRunArgs, fakeExecRunner.RunArgs)
+			}
+		})
+	}
+}
+
+func TestRunFanOut(t *testing.T) {
+	testCases := []struct {
+		name             string
+		fakeOsArgs       []string
+		response         string
+		failingContexts  []string
+		expectedExecuted []string
+		expectedStdout   []string
+		expectedError    string
+		expectedExitCode int
+	}{
+		{
+			name:             "confirm all",
+			fakeOsArgs:       []string{"confirm", "--contexts=a,b", "delete", "pod", "foo"},
+			response:         "all\n",
+			expectedExecuted: []string{"a", "b"},
+			expectedStdout: []string{
+				"########## Context: a\n\n========== Config ===========\nContext:    a\n",
+				"========== Summary ==========\na  previewed\nb  previewed\n",
+				"The following command will be executed in 2 contexts (a, b):\nkubectl delete pod foo\n",
+				"========== Results ==========\na  succeeded\nb  succeeded\n",
+			},
+		},
+		{
+			name:             "confirm each",
+			fakeOsArgs:       []string{"confirm", "--contexts=a,b", "delete", "pod", "foo"},
+			response:         "each\nno\nyes\n",
+			expectedExecuted: []string{"b"},
+			expectedStdout: []string{
+				"kubectl delete pod foo --context=a\n",
+				"========== Results ==========\na  skipped\nb  succeeded\n",
+			},
+		},
+		{
+			name:             "stop on first failure",
+			fakeOsArgs:       []string{"confirm", "--contexts=a,b", "delete", "pod", "foo"},
+			response:         "all\n",
+			failingContexts:  []string{"a"},
+			expectedExecuted: []string{"a"},
+			expectedStdout: []string{
+				"========== Results ==========\na  failed: exit status 1\nb  not executed, because the command failed before\n",
+			},
+			expectedError: "the command failed in 1 of 2 contexts",
+		},
+		{
+			name:             "continue on error",
+			fakeOsArgs:       []string{"confirm", "--contexts=a,b", "--continue-on-error", "delete", "pod", "foo"},
+			response:         "all\n",
+			failingContexts:  []string{"a"},
+			expectedExecuted: []string{"a", "b"},
+			expectedStdout: []string{
+				"========== Results ==========\na  failed: exit status 1\nb  succeeded\n",
+			},
+			expectedError: "the command failed in 1 of 2 contexts",
+		},
+		{
+			name:             "abort",
+			fakeOsArgs:       []string{"confirm", "--contexts=a,b", "delete", "pod", "foo"},
+			response:         "yes\n",
+			expectedExitCode: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actualExitCode int
+			util.Exit = func(code int) {
+				actualExitCode = code
+			}
+
+			fakeExecRunner := util.NewFakeExecRunner()
+			for _, name := range []string{"a", "b"} {
+				var err error
+				if containsString(tc.failingContexts, name) {
+					err = fmt.Errorf("exit status 1")
+				}
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("view"), `{"current-context": "a", "contexts": [{"name": "a", "context": {}}, {"name": "b", "context": {}}]}`, "", nil)
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), "pod \"foo\" deleted (server dry run)\n", "", nil)
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("can-i"), "yes\n", "", nil)
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "foo", "namespace": "default"}}`, "", nil)
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--context="+name), "pod \"foo\" deleted\n", "", err)
+			}
+
+			o := &confirmOptions{}
+			o.parseArgs(tc.fakeOsArgs[1:])
+			cmd, stdin, stdout, _ := util.NewTestCommand()
+			stdin.WriteString(tc.response)
+
+			err := o.runFanOut(cmd, "delete")
+			if len(tc.expectedError) > 0 {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("runFanOut failed: %v", err)
+			}
+			for _, name := range []string{"a", "b"} {
+				executed := fakeExecRunner.HasRunArgs([]string{"delete", "pod", "foo", "--context=" + name})
+				if executed != containsString(tc.expectedExecuted, name) {
+					t.Fatalf("expected executed in %s to be %v", name, !executed)
+				}
+			}
+			for _, s := range tc.expectedStdout {
+				if !strings.Contains(stdout.String(), s) {
+					t.Fatalf("expected stdout to contain:\n%s\ngot:\n%s", s, stdout.String())
+				}
+			}
+			if actualExitCode != tc.expectedExitCode {
+				t.Fatalf("wrong exit code. expected: %d, got %d", tc.expectedExitCode, actualExitCode)
+			}
+		})
+	}
+}
+
+func TestRunFanOutRunner(t *testing.T) {
+	util.Exit = func(code int) {}
+	fakeExecRunner := util.NewFakeExecRunner()
+	for _, name := range []string{"a", "b"} {
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("view"), `{"current-context": "a", "contexts": [{"name": "a", "context": {}}, {"name": "b", "context": {}}]}`, "", nil)
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), "pod \"foo\" deleted (server dry run)\n", "", nil)
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("can-i"), "yes\n", "", nil)
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), `{"kind": "List", "items": []}`, "", nil)
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("--context="+name), "pod \"foo\" deleted\n", "", nil)
+	}
+
+	// Every kubectl run in each context goes through the runner of the options, like when the command is embedded
+	runner := util.ExecRun
+	defer func() { util.ExecRun = runner }()
+	var runs int32
+	util.ExecRun = func(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		t.Errorf("expected kubectl %v to be run by the runner of the options", args)
+		return runner(ctx, name, args, stdin, stdout, stderr)
+	}
+	o := &confirmOptions{execRunner: func(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		atomic.AddInt32(&runs, 1)
+		return runner(ctx, name, args, stdin, stdout, stderr)
+	}}
+	o.parseArgs([]string{"--contexts=a,b", "delete", "pod", "foo"})
+	cmd, stdin, _, _ := util.NewTestCommand()
+	stdin.WriteString("all\n")
+
+	if err := o.runFanOut(cmd, "delete"); err != nil {
+		t.Fatalf("runFanOut failed: %v", err)
+	}
+	if !fakeExecRunner.HasRunArgs([]string{"delete", "pod", "foo", "--context=b"}) || int(runs) != fakeExecRunner.RunCount() {
+		t.Fatalf("expected all %d runs to use the runner of the options, got %d", fakeExecRunner.RunCount(), runs)
+	}
+}
+
+func TestRunFanOutInvalid(t *testing.T) {
+	testCases := []struct {
+		name          string
+		fakeOsArgs    []string
+		expectedError string
+	}{
+		{
+			name:          "edit",
+			fakeOsArgs:    []string{"confirm", "--contexts=a,b", "edit", "deploy/foo"},
+			expectedError: "--contexts, --confirm-namespaces, and --confirm-namespace-selector cannot be used with edit",
+		},
+		{
+			name:          "context",
+			fakeOsArgs:    []string{"confirm", "--contexts=a,b", "--context=c", "delete", "pod", "foo"},
+			expectedError: "--contexts and --context cannot be used together",
+		},
+		{
+			name:          "stdin",
+			fakeOsArgs:    []string{"confirm", "--contexts=a,b", "apply", "-f", "-"},
+			expectedError: "the command cannot be run in several contexts or namespaces with stdin or non-regular files, because they can only be read once",
+		},
+		{
+			name:          "namespace",
+			fakeOsArgs:    []string{"confirm", "--confirm-namespaces=a,b", "-n", "c", "delete", "pod", "foo"},
+			expectedError: "--confirm-namespaces and --confirm-namespace-selector cannot be used with --namespace or --all-namespaces",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &confirmOptions{}
+			o.parseArgs(tc.fakeOsArgs[1:])
+			cmd, _, _, _ := util.NewTestCommand()
+			if err := o.runFanOut(cmd, o.args.Verb()); err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestResolveNamespaces(t *testing.T) {
+	testCases := []struct {
+		name               string
+		fakeOsArgs         []string
+		context            string
+		fakeStdout         string
+		expectedNamespaces []string
+		expectedRunArgs    []string
+		expectedError      string
+	}{
+		{
+			name:               "no namespaces",
+			fakeOsArgs:         []string{"confirm", "--contexts=a", "delete", "pod", "foo"},
+			expectedNamespaces: []string{""},
+		},
+		{
+			name:               "list",
+			fakeOsArgs:         []string{"confirm", "--confirm-namespaces=x,y,x", "delete", "pod", "foo"},
+			expectedNamespaces: []string{"x", "y"},
+		},
+		{
+			name:               "selector",
+			fakeOsArgs:         []string{"confirm", "--confirm-namespaces=x", "--confirm-namespace-selector", "tenant", "--kubeconfig=kc", "delete", "pod", "foo"},
+			context:            "prod",
+			fakeStdout:         "namespace/x\nnamespace/z\n",
+			expectedNamespaces: []string{"x", "z"},
+			expectedRunArgs:    []string{"get", "namespaces", "--selector=tenant", "-o", "name", "--kubeconfig=kc", "--context=prod"},
+		},
+		{
+			name:          "selector without matches",
+			fakeOsArgs:    []string{"confirm", "--confirm-namespace-selector=tenant", "delete", "pod", "foo"},
+			context:       "prod",
+			expectedError: `no namespaces in context prod match "tenant"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun(tc.fakeStdout, "", nil)
+
+			o := &confirmOptions{}
+			o.parseArgs(tc.fakeOsArgs[1:])
+			cmd, _, _, _ := util.NewTestCommand()
+			namespaces, err := o.resolveNamespaces(cmd, tc.context)
+			if len(tc.expectedError) > 0 {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveNamespaces failed: %v", err)
+			}
+			if !reflect.DeepEqual(namespaces, tc.expectedNamespaces) {
+				t.Fatalf("wrong namespaces.\nexpected: %q\ngot: %q", tc.expectedNamespaces, namespaces)
+			}
+			if tc.expectedRunArgs != nil && !fakeExecRunner.HasRunArgs(tc.expectedRunArgs) {
+				t.Fatalf("expected a run with args %v, got %v", tc.expectedRunArgs, fakeExecRunner.RunArgs)
+			}
+		})
+	}
+}
+
+func TestRunFanOutNamespaces(t *testing.T) {
+	util.Exit = func(code int) {
+		t.Fatalf("unexpected exit with code %d", code)
+	}
+	fakeExecRunner := util.NewFakeExecRunner()
+	for _, ns := range []string{"x", "y"} {
+		created := ""
+		if ns == "x" {
+			created = `, {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "bar", "namespace": "x"}}`
+		}
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("view"), `{"current-context": "a", "contexts": [{"name": "a", "context": {}}]}`, "", nil)
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), `{"kind": "List", "items": [{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "`+ns+`"}, "data": {"a": "2"}}`+created+`]}`, "", nil)
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("get"), `{"kind": "List", "items": [{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "`+ns+`"}, "data": {"a": "1"}}]}`, "", nil)
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("--namespace="+ns), "configmap/foo configured\n", "", nil)
+	}
+
+	o := &confirmOptions{}
+	o.parseArgs([]string{"--confirm-namespaces=x,y", "apply", "-f", "foo.yaml"})
+	cmd, stdin, stdout, _ := util.NewTestCommand()
+	stdin.WriteString("all\n")
+	if err := o.runFanOut(cmd, "apply"); err != nil {
+		t.Fatalf("runFanOut failed: %v", err)
+	}
+	for _, s := range []string{
+		"########## Namespace: x\n",
+		"========== Summary ==========\nx  1 created, 1 changed, 0 unchanged\ny  0 created, 1 changed, 0 unchanged\nTotal: 1 created, 2 changed, 0 unchanged\n",
+		"The following command will be executed in 2 namespaces (x, y):\nkubectl apply -f foo.yaml\n",
+		"========== Results ==========\nx  succeeded\ny  succeeded\n",
+	} {
+		if !strings.Contains(stdout.String(), s) {
+			t.Fatalf("expected stdout to contain:\n%s\ngot:\n%s", s, stdout.String())
+		}
+	}
+	for _, ns := range []string{"x", "y"} {
+		if !fakeExecRunner.HasRunArgs([]string{"apply", "-f", "foo.yaml", "--namespace=" + ns}) {
+			t.Fatalf("expected the command to be executed in namespace %s, got %v", ns, fakeExecRunner.RunArgs)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// fieldElement is an element of the path of a field in managedFields, which is a field name (f:), the keys of an item
+// of a list (k:), a value of a set (v:), or an index of a list (i:)
+type fieldElement struct {
+	prefix byte
+	name   string
+	keys   map[string]interface{}
+	value  interface{}
+	index  int
+}
+
+func (e fieldElement) String() string {
+	switch e.prefix {
+	case 'f':
+		return "." + e.name
+	case 'k':
+		names := make([]string, 0, len(e.keys))
+		for name := range e.keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names))
+		for _, name := range names {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", name, e.keys[name]))
+		}
+		return "[" + strings.Join(pairs, ",") + "]"
+	case 'v':
+		return fmt.Sprintf("[%v]", e.value)
+	}
+	return "[" + strconv.Itoa(e.index) + "]"
+}
+
+// managedField is a field owned by one or more managers
+type managedField struct {
+	path     []fieldElement
+	managers []string
+}
+
+// fieldOwnershipChange is a field whose managers change when the command is executed
+type fieldOwnershipChange struct {
+	path     string
+	from     []string
+	to       []string
+	modified bool
+}
+
+// managedFields returns the fields of obj owned by each manager, by their path, like .spec.replicas
+func managedFields(obj map[string]interface{}) map[string]*managedField {
+	fields := map[string]*managedField{}
+	for _, entry := range util.NestedSlice(obj, "metadata", "managedFields") {
+		manager := util.NestedString(entry, "manager")
+		if subresource := util.NestedString(entry, "subresource"); len(subresource) > 0 {
+			manager += " (" + subresource + ")"
+		}
+		collectManagedFields(util.NestedMap(entry, "fieldsV1"), nil, manager, fields)
+	}
+	return fields
+}
+
+// collectManagedFields adds the fields owned by manager to fields. A field is owned if it has no children, or if it
+// has a "." child, which marks an item of a list or set that is owned as a whole.
+func collectManagedFields(node map[string]interface{}, path []fieldElement, manager string, fields map[string]*managedField) {
+	if len(path) > 0 && (len(node) == 0 || node["."] != nil) {
+		key := formatFieldPath(path)
+		if fields[key] == nil {
+			fields[key] = &managedField{path: path}
+		}
+		if !containsString(fields[key].managers, manager) {
+			fields[key].managers = append(fields[key].managers, manager)
+			sort.Strings(fields[key].managers)
+		}
+	}
+	for k, child := range node {
+		element, ok := parseFieldElement(k)
+		if !ok {
+			continue
+		}
+		childNode, _ := child.(map[string]interface{})
+		collectManagedFields(childNode, append(append([]fieldElement{}, path...), element), manager, fields)
+	}
+}
+
+func parseFieldElement(k string) (fieldElement, bool) {
+	prefix, rest, found := strings.Cut(k, ":")
+	if !found || len(prefix) != 1 {
+		return fieldElement{}, false
+	}
+	e := fieldElement{prefix: prefix[0]}
+	switch e.prefix {
+	case 'f':
+		e.name = rest
+	case 'k':
+		if err := util.UnmarshalJSON([]byte(rest), &e.keys); err != nil {
+			return fieldElement{}, false
+		}
+	case 'v':
+		if err := util.UnmarshalJSON([]byte(rest), &e.value); err != nil {
+			return fieldElement{}, false
+		}
+	case 'i':
+		index, err := strconv.Atoi(rest)
+		if err != nil {
+			return fieldElement{}, false
+		}
+		e.index = index
+	default:
+		return fieldElement{}, false
+	}
+	return e, true
+}
+
+func formatFieldPath(path []fieldElement) string {
+	sb := strings.Builder{}
+	for _, e := range path {
+		sb.WriteString(e.String())
+	}
+	return sb.String()
+}
+
+// fieldValue returns the value of the field at path in obj
+func fieldValue(obj interface{}, path []fieldElement) (interface{}, bool) {
+	v := obj
+	for _, e := range path {
+		switch e.prefix {
+		case 'f':
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[e.name]; !ok {
+				return nil, false
+			}
+		case 'i':
+			list, ok := v.([]interface{})
+			if !ok || e.index >= len(list) {
+				return nil, false
+			}
+			v = list[e.index]
+		default:
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			found := false
+			for _, item := range list {
+				if (e.prefix == 'v' && reflect.DeepEqual(item, e.value)) || (e.prefix == 'k' && hasKeys(item, e.keys)) {
+					v, found = item, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		}
+	}
+	return v, true
+}
+
+func hasKeys(item interface{}, keys map[string]interface{}) bool {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for k, v := range keys {
+		if !reflect.DeepEqual(m[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldOwnershipChanges returns the fields of the object whose managers change when the command is executed. Fields
+// that are only released by their managers are not included.
+func (p previewObject) fieldOwnershipChanges() []fieldOwnershipChange {
+	if p.live == nil {
+		return nil
+	}
+	before, after := managedFields(p.live), managedFields(p.merged)
+	var changes []fieldOwnershipChange
+	for key, field := range after {
+		previous := before[key]
+		if previous == nil {
+			continue
+		}
+		var from, to []string
+		for _, m := range previous.managers {
+			if !containsString(field.managers, m) {
+				from = append(from, m)
+			}
+		}
+		for _, m := range field.managers {
+			if !containsString(previous.managers, m) {
+				to = append(to, m)
+			}
+		}
+		if len(to) == 0 {
+			continue
+		}
+		liveValue, liveFound := fieldValue(p.live, field.path)
+		mergedValue, mergedFound := fieldValue(p.merged, field.path)
+		modified := liveFound != mergedFound || !reflect.DeepEqual(liveValue, mergedValue)
+		changes = append(changes, fieldOwnershipChange{path: key, from: from, to: to, modified: modified})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+	return changes
+}
+
+// printFieldManagers shows the fields whose managers change, and warns about fields that are modified while they are
+// owned by a different manager, like a controller that may change them back. Nothing is printed if no managers change.
+func (o *confirmOptions) printFieldManagers(cmd *cobra.Command) {
+	var lines, warnings []string
+	for _, p := range o.preview {
+		changes := p.fieldOwnershipChanges()
+		if len(changes) == 0 {
+			continue
+		}
+		name := util.ObjectName(p.merged)
+		lines = append(lines, name+":")
+		for _, c := range changes {
+			if len(c.from) == 0 {
+				lines = append(lines, fmt.Sprintf("  %s: shared with %s", c.path, strings.Join(c.to, ", ")))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("  %s: %s -> %s", c.path, strings.Join(c.from, ", "), strings.Join(c.to, ", ")))
+			if c.modified {
+				warnings = append(warnings, fmt.Sprintf("  %s%s (owned by %s)", name, c.path, strings.Join(c.from, ", ")))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	util.PrintSectionTitle(cmd, "Field Managers")
+	defer cmd.Println()
+	for _, line := range lines {
+		cmd.Println(line)
+	}
+	if len(warnings) > 0 {
+		cmd.Printf("WARNING: The following fields are modified while another manager owns them, which may change them back:\n")
+		for _, w := range warnings {
+			cmd.Println(w)
+		}
+	}
+}
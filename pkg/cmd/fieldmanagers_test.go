@@ -0,0 +1,151 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+const testFieldManagersLive = `{
+	"apiVersion": "apps/v1",
+	"kind": "Deployment",
+	"metadata": {
+		"name": "api",
+		"managedFields": [
+			{"manager": "helm", "operation": "Update", "fieldsV1": {"f:spec": {"f:replicas": {}, "f:template": {"f:spec": {"f:containers": {"k:{\"name\":\"app\"}": {".": {}, "f:image": {}, "f:name": {}}}}}}}},
+			{"manager": "kube-controller-manager", "operation": "Update", "subresource": "status", "fieldsV1": {"f:status": {"f:replicas": {}}}}
+		]
+	},
+	"spec": {"replicas": 2, "template": {"spec": {"containers": [{"name": "app", "image": "app:1"}]}}},
+	"status": {"replicas": 2}
+}`
+
+const testFieldManagersMerged = `{
+	"apiVersion": "apps/v1",
+	"kind": "Deployment",
+	"metadata": {
+		"name": "api",
+		"managedFields": [
+			{"manager": "helm", "operation": "Update", "fieldsV1": {"f:spec": {"f:template": {"f:spec": {"f:containers": {"k:{\"name\":\"app\"}": {".": {}, "f:name": {}}}}}}}},
+			{"manager": "kube-controller-manager", "operation": "Update", "subresource": "status", "fieldsV1": {"f:status": {"f:replicas": {}}}},
+			{"manager": "kubectl-client-side-apply", "operation": "Update", "fieldsV1": {"f:spec": {"f:replicas": {}, "f:template": {"f:spec": {"f:containers": {"k:{\"name\":\"app\"}": {".": {}, "f:image": {}}}}}}}}
+		]
+	},
+	"spec": {"replicas": 2, "template": {"spec": {"containers": [{"name": "app", "image": "app:2"}]}}},
+	"status": {"replicas": 2}
+}`
+
+func decodeTestObject(t *testing.T, s string) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := util.UnmarshalJSON([]byte(s), &obj); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return obj
+}
+
+func TestFieldOwnershipChanges(t *testing.T) {
+	p := previewObject{live: decodeTestObject(t, testFieldManagersLive), merged: decodeTestObject(t, testFieldManagersMerged)}
+	expected := []fieldOwnershipChange{
+		{path: ".spec.replicas", from: []string{"helm"}, to: []string{"kubectl-client-side-apply"}},
+		{path: ".spec.template.spec.containers[name=app]", to: []string{"kubectl-client-side-apply"}, modified: true},
+		{path: ".spec.template.spec.containers[name=app].image", from: []string{"helm"}, to: []string{"kubectl-client-side-apply"}, modified: true},
+	}
+	actual := p.fieldOwnershipChanges()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("wrong changes.\nexpected: %+v\ngot: %+v", expected, actual)
+	}
+
+	created := previewObject{merged: decodeTestObject(t, testFieldManagersMerged)}
+	if changes := created.fieldOwnershipChanges(); changes != nil {
+		t.Fatalf("expected no changes for a created object, got %+v", changes)
+	}
+}
+
+func TestPrintFieldManagers(t *testing.T) {
+	o := confirmOptions{preview: []previewObject{
+		{live: decodeTestObject(t, testFieldManagersLive), merged: decodeTestObject(t, testFieldManagersMerged)},
+		{live: decodeTestObject(t, testFieldManagersMerged), merged: decodeTestObject(t, testFieldManagersMerged)},
+	}}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	o.printFieldManagers(cmd)
+	expected := `========== Field Managers ===
+deployment.apps/api:
+  .spec.replicas: helm -> kubectl-client-side-apply
+  .spec.template.spec.containers[name=app]: shared with kubectl-client-side-apply
+  .spec.template.spec.containers[name=app].image: helm -> kubectl-client-side-apply
+WARNING: The following fields are modified while another manager owns them, which may change them back:
+  deployment.apps/api.spec.template.spec.containers[name=app].image (owned by helm)
+
+`
+	if stdout.String() != expected {
+		t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	obj := decodeTestObject(t, `{"metadata": {"finalizers": ["a", "b"]}, "spec": {"ports": [{"port": 80, "protocol": "TCP", "name": "http"}]}}`)
+	testCases := []struct {
+		key           string
+		expectedValue interface{}
+		expectedFound bool
+	}{
+		{key: `f:metadata/f:finalizers/v:"b"`, expectedValue: "b", expectedFound: true},
+		{key: `f:metadata/f:finalizers/i:0`, expectedValue: "a", expectedFound: true},
+		{key: `f:spec/f:ports/k:{"port":80,"protocol":"TCP"}/f:name`, expectedValue: "http", expectedFound: true},
+		{key: `f:spec/f:ports/k:{"port":443,"protocol":"TCP"}/f:name`},
+		{key: `f:spec/f:missing`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			var path []fieldElement
+			for _, k := range splitFieldKey(tc.key) {
+				e, ok := parseFieldElement(k)
+				if !ok {
+					t.Fatalf("invalid element %q", k)
+				}
+				path = append(path, e)
+			}
+			value, found := fieldValue(obj, path)
+			if found != tc.expectedFound || !reflect.DeepEqual(value, tc.expectedValue) {
+				t.Fatalf("wrong value. expected: %v %v, got: %v %v", tc.expectedValue, tc.expectedFound, value, found)
+			}
+		})
+	}
+}
+
+// splitFieldKey splits a test key like f:spec/f:replicas at the slashes that are not inside JSON
+func splitFieldKey(key string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range key {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				parts = append(parts, key[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, key[start:])
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// Labels and annotations that GitOps controllers put on the objects they manage
+const (
+	// Argo CD annotation tracking, whose value is <application>:<group>/<kind>:<namespace>/<name>
+	argoCDTrackingIDAnnotation = "argocd.argoproj.io/tracking-id"
+	// The label commonly configured as the Argo CD tracking label. The default tracking label,
+	// app.kubernetes.io/instance, is not used, because Helm sets it too.
+	argoCDInstanceLabel      = "argocd.argoproj.io/instance"
+	fluxKustomizationLabel   = "kustomize.toolkit.fluxcd.io/name"
+	fluxKustomizationNSLabel = "kustomize.toolkit.fluxcd.io/namespace"
+	fluxHelmReleaseLabel     = "helm.toolkit.fluxcd.io/name"
+	fluxHelmReleaseNSLabel   = "helm.toolkit.fluxcd.io/namespace"
+)
+
+// gitOpsManagedObject is a live object affected by the command that a GitOps controller manages
+type gitOpsManagedObject struct {
+	name  string
+	owner string
+}
+
+// gitOpsOwner returns the Argo CD Application or Flux Kustomization or HelmRelease that manages obj, or an empty
+// string if it is not managed by either of them
+func gitOpsOwner(obj map[string]interface{}) string {
+	labels := util.NestedMap(obj, "metadata", "labels")
+	annotations := util.NestedMap(obj, "metadata", "annotations")
+	if trackingID, ok := annotations[argoCDTrackingIDAnnotation].(string); ok && len(trackingID) > 0 {
+		application, _, _ := strings.Cut(trackingID, ":")
+		return "Argo CD Application " + application
+	}
+	if application, ok := labels[argoCDInstanceLabel].(string); ok && len(application) > 0 {
+		return "Argo CD Application " + application
+	}
+	if name, ok := labels[fluxKustomizationLabel].(string); ok && len(name) > 0 {
+		return "Flux Kustomization " + namespacedName(labels[fluxKustomizationNSLabel], name)
+	}
+	if name, ok := labels[fluxHelmReleaseLabel].(string); ok && len(name) > 0 {
+		return "Flux HelmRelease " + namespacedName(labels[fluxHelmReleaseNSLabel], name)
+	}
+	return ""
+}
+
+func namespacedName(namespace interface{}, name string) string {
+	if ns, ok := namespace.(string); ok && len(ns) > 0 {
+		return ns + "/" + name
+	}
+	return name
+}
+
+// liveObjects returns the current state of the objects affected by the command, as far as the preview knows them,
+// including the objects that delete deletes
+func (o *confirmOptions) liveObjects() []map[string]interface{} {
+	var objs []map[string]interface{}
+	for _, p := range o.preview {
+		if p.live != nil {
+			objs = append(objs, p.live)
+		}
+	}
+	objs = append(objs, o.rolloutObjects...)
+	return append(objs, o.deletedObjects...)
+}
+
+// gitOpsManagedObjects returns the live objects affected by the command that a GitOps controller manages
+func (o *confirmOptions) gitOpsManagedObjects() []gitOpsManagedObject {
+	var managed []gitOpsManagedObject
+	for _, obj := range o.liveObjects() {
+		if owner := gitOpsOwner(obj); len(owner) > 0 {
+			managed = append(managed, gitOpsManagedObject{name: util.ObjectName(obj), owner: owner})
+		}
+	}
+	return managed
+}
+
+// printGitOps warns that changes to objects managed by a GitOps controller may be reverted or cause drift. Nothing is
+// printed if none of the affected objects are managed.
+func (o *confirmOptions) printGitOps(cmd *cobra.Command) {
+	managed := o.gitOpsManagedObjects()
+	if len(managed) == 0 {
+		return
+	}
+	util.PrintSectionTitle(cmd, "GitOps")
+	defer cmd.Println()
+	cmd.Printf("WARNING: The following objects are managed by GitOps. Changing them directly may be reverted by the controller or cause drift:\n")
+	for _, m := range managed {
+		cmd.Printf("  %s (%s)\n", m.name, m.owner)
+	}
+}
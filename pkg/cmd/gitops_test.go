@@ -0,0 +1,107 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestGitOpsOwner(t *testing.T) {
+	testCases := []struct {
+		name     string
+		metadata string
+		expected string
+	}{
+		{
+			name:     "argo cd tracking id",
+			metadata: `{"annotations": {"argocd.argoproj.io/tracking-id": "payments:apps/Deployment:prod/api"}}`,
+			expected: "Argo CD Application payments",
+		},
+		{
+			name:     "argo cd instance label",
+			metadata: `{"labels": {"argocd.argoproj.io/instance": "payments"}}`,
+			expected: "Argo CD Application payments",
+		},
+		{
+			name:     "flux kustomization",
+			metadata: `{"labels": {"kustomize.toolkit.fluxcd.io/name": "apps", "kustomize.toolkit.fluxcd.io/namespace": "flux-system"}}`,
+			expected: "Flux Kustomization flux-system/apps",
+		},
+		{
+			name:     "flux helm release",
+			metadata: `{"labels": {"helm.toolkit.fluxcd.io/name": "redis"}}`,
+			expected: "Flux HelmRelease redis",
+		},
+		{
+			name:     "helm instance label is not gitops",
+			metadata: `{"labels": {"app.kubernetes.io/instance": "redis"}}`,
+		},
+		{
+			name:     "no metadata",
+			metadata: `{}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var metadata map[string]interface{}
+			if err := json.Unmarshal([]byte(tc.metadata), &metadata); err != nil {
+				t.Fatal(err)
+			}
+			actual := gitOpsOwner(map[string]interface{}{"metadata": metadata})
+			if actual != tc.expected {
+				t.Fatalf("wrong owner. expected: %q, got: %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPrintGitOps(t *testing.T) {
+	managed := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "api", "labels": map[string]interface{}{"argocd.argoproj.io/instance": "payments"}},
+	}
+	unmanaged := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings"},
+	}
+	o := confirmOptions{preview: []previewObject{{live: managed, merged: managed}, {live: unmanaged, merged: unmanaged}, {merged: managed}}}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	o.printGitOps(cmd)
+	expected := `========== GitOps ===========
+WARNING: The following objects are managed by GitOps. Changing them directly may be reverted by the controller or cause drift:
+  deployment.apps/api (Argo CD Application payments)
+
+`
+	if stdout.String() != expected {
+		t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+	if !o.newPolicyInput("apply").gitOpsManaged {
+		t.Fatalf("expected the policy input to be gitops managed")
+	}
+
+	o = confirmOptions{preview: []previewObject{{live: unmanaged, merged: unmanaged}}}
+	cmd, _, stdout, _ = util.NewTestCommand()
+	o.printGitOps(cmd)
+	if stdout.Len() > 0 {
+		t.Fatalf("expected nothing to be printed, got:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,571 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+// The files in the directory of a change that have its record, the report that was shown at the prompt, and the
+// objects as they were edited by kubectl confirm edit
+const (
+	changeRecordFile = "record.json"
+	changeReportFile = "report.txt"
+	changeEditedFile = "edited.yaml"
+)
+
+// The format of the IDs of changes, which are also the names of their directories in the history
+var changeIDPattern = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}-[0-9a-f]{6}$`)
+
+// Results of a change
+const (
+	changeResultSucceeded = "succeeded"
+	changeResultFailed    = "failed"
+	changeResultAborted   = "aborted"
+)
+
+// changeRecord is the audit entry of a command that was executed, which is kept in the history
+type changeRecord struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Verb string    `json:"verb"`
+	// Args are the args of kubectl, with the values of sensitive flags masked
+	Args      []string `json:"args"`
+	Context   string   `json:"context"`
+	Namespace string   `json:"namespace"`
+	User      string   `json:"user"`
+	// Result is succeeded or failed, according to the exit status of kubectl, or aborted if the command was not confirmed
+	Result       string              `json:"result"`
+	Error        string              `json:"error,omitempty"`
+	Verification *verificationResult `json:"verification,omitempty"`
+	// Snapshot is true if the objects were saved before the change, so that it can be rolled back
+	Snapshot bool `json:"snapshot,omitempty"`
+	// RollbackOf is the ID of the change that this change rolled back
+	RollbackOf string `json:"rollbackOf,omitempty"`
+	// ConnectionFlags are the global flags that select the cluster and the credentials, other than --context, like
+	// --kubeconfig, so that a rollback connects the same way. Secrets, like --token, are never recorded.
+	ConnectionFlags []string `json:"connectionFlags,omitempty"`
+	// Created are the objects that did not exist before the change, which are not removed by a rollback
+	Created []objectRef `json:"created,omitempty"`
+	// UnsavedSecrets are the Secrets that were left out of the snapshot, because snapshotSecrets is not enabled in the
+	// policy, which prevents the change from being rolled back
+	UnsavedSecrets []objectRef `json:"unsavedSecrets,omitempty"`
+}
+
+// objectRef identifies an object that was affected by a change
+type objectRef struct {
+	// Resource is the name of the object, like deployment.v1.apps/foo
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Global flags that are recorded with a change, and reused by its rollback. The flags that contain secrets are left
+// out, and --context is recorded on its own.
+var connectionFlags = []string{
+	"as", "as-group", "as-uid", "certificate-authority", "client-certificate", "client-key", "cluster",
+	"insecure-skip-tls-verify", "kubeconfig", "server", "tls-server-name", "user",
+}
+
+// Connection flags with the path of a file, which are made absolute, so that a rollback works from any directory
+var connectionFileFlags = []string{"certificate-authority", "client-certificate", "client-key", "kubeconfig"}
+
+// getHistoryDir returns the directory where changes are recorded, which is ~/.kube/confirm-history, or the directory
+// specified by the KUBECTL_CONFIRM_HISTORY environment variable. Nothing is recorded if it is set to an empty string.
+func getHistoryDir() string {
+	if historyDir, found := os.LookupEnv("KUBECTL_CONFIRM_HISTORY"); found {
+		return historyDir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "confirm-history")
+}
+
+// newChangeID returns an ID for a change, which sorts by time, like 20240102-150405-1a2b3c
+func newChangeID(t time.Time) string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return t.Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// changeID returns the ID of the change made by the command, which is created the first time it is needed
+func (o *confirmOptions) changeID() string {
+	if len(o.id) == 0 {
+		o.id = newChangeID(time.Now())
+	}
+	return o.id
+}
+
+// newChangeRecord returns the record of the command, using the config resolved by printConfig. The values of sensitive
+// flags, like --token, are masked. The temp file of edit is replaced by the copy that is saved with the record.
+func (o *confirmOptions) newChangeRecord(verb string, kubectlArgs []string, execErr error) *changeRecord {
+	args := redactArgs(kubectlArgs)
+	if o.savesEditedCopy() {
+		edited := filepath.Join(getHistoryDir(), o.changeID(), changeEditedFile)
+		for i := range args {
+			if args[i] == o.editedFile {
+				args[i] = edited
+			}
+		}
+	}
+	r := &changeRecord{
+		ID:        o.changeID(),
+		Time:      time.Now().UTC(),
+		Verb:      verb,
+		Args:      args,
+		Context:   o.resolvedContext,
+		Namespace: o.resolvedNamespace,
+		User:      o.resolvedUser,
+		Result:    changeResultSucceeded,
+	}
+	if len(o.namespace) > 0 {
+		r.Namespace = o.namespace
+	}
+	if o.args != nil {
+		r.ConnectionFlags = o.args.FlagArgs(func(f kubeargs.Flag) bool {
+			return f.Global && containsString(connectionFlags, f.Name)
+		})
+		for i, arg := range r.ConnectionFlags {
+			name, value, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			if containsString(connectionFileFlags, name) {
+				if abs, err := filepath.Abs(value); err == nil {
+					r.ConnectionFlags[i] = "--" + name + "=" + abs
+				}
+			}
+		}
+	}
+	for _, p := range o.preview {
+		if p.live == nil && p.merged != nil {
+			r.Created = append(r.Created, objectRef{
+				Resource:  qualifiedResourceName(p.merged),
+				Namespace: util.NestedString(p.merged, "metadata", "namespace"),
+			})
+		}
+	}
+	if len(o.rollbackOf) > 0 {
+		r.Verb = "rollback"
+		r.RollbackOf = o.rollbackOf
+	}
+	if execErr != nil {
+		r.Result = changeResultFailed
+		r.Error = execErr.Error()
+	}
+	return r
+}
+
+// saveChangeRecord writes the record to the directory of the change in the history. The directory is only accessible
+// by the user, because the history may contain sensitive information.
+func saveChangeRecord(historyDir string, r *changeRecord) error {
+	dir := filepath.Join(historyDir, r.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, changeRecordFile), append(data, '\n'), 0600)
+}
+
+// loadChangeRecord reads the record of a change from the history
+func loadChangeRecord(historyDir string, id string) (*changeRecord, error) {
+	if len(historyDir) == 0 {
+		return nil, fmt.Errorf("the history is disabled, because KUBECTL_CONFIRM_HISTORY is empty")
+	}
+	if !changeIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid change ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(historyDir, id, changeRecordFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("change %s was not found in the history", id)
+	} else if err != nil {
+		return nil, err
+	}
+	var r changeRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("the record of change %s is invalid: %v", id, err)
+	}
+	return &r, nil
+}
+
+// startReport keeps a copy of everything printed from now on, until stopReport is called, which is the report shown at
+// the prompt. It is saved in the history along with the record of the change, so that it can be shown again.
+func (o *confirmOptions) startReport(cmd *cobra.Command) {
+	// cmd.Print writes to the output of cmd if it is set, and to stderr otherwise, so the output is only restored if it
+	// was set, and the output of kubectl itself still goes to stdout
+	o.reportOut = nil
+	if cmd.OutOrStdout() == cmd.OutOrStderr() {
+		o.reportOut = cmd.OutOrStdout()
+	}
+	o.report = &bytes.Buffer{}
+	o.reporting = true
+	cmd.SetOut(io.MultiWriter(cmd.OutOrStderr(), o.report))
+}
+
+// stopReport stops keeping a copy of what is printed, so that the output of the command is not part of the report
+func (o *confirmOptions) stopReport(cmd *cobra.Command) {
+	if o.reporting {
+		cmd.SetOut(o.reportOut)
+		o.reporting = false
+	}
+}
+
+// recordChange records the command in the history, and shows how to roll it back if its objects were saved. A failure
+// to record it is only a warning, because the command has already been executed.
+func (o *confirmOptions) recordChange(cmd *cobra.Command, r *changeRecord) {
+	historyDir := getHistoryDir()
+	if len(historyDir) == 0 {
+		return
+	}
+	err := saveChangeRecord(historyDir, r)
+	if err == nil && o.report != nil && o.report.Len() > 0 {
+		err = os.WriteFile(filepath.Join(historyDir, r.ID, changeReportFile), o.report.Bytes(), 0600)
+	}
+	if err == nil && o.savesEditedCopy() {
+		var edited []byte
+		if edited, err = o.editedCopy(); err == nil {
+			err = os.WriteFile(filepath.Join(historyDir, r.ID, changeEditedFile), edited, 0600)
+		}
+	}
+	if err != nil {
+		cmd.PrintErrf("Warning: the change could not be recorded in the history: %v\n", err)
+		return
+	}
+	if len(r.UnsavedSecrets) > 0 {
+		cmd.PrintErrf("Change %s was recorded in the history, but cannot be rolled back, because it affected Secrets, which are only saved if snapshotSecrets is enabled in the policy\n", r.ID)
+	} else if r.Snapshot {
+		cmd.PrintErrf("Change %s was recorded in the history, and can be rolled back with: kubectl confirm rollback %s\n", r.ID, r.ID)
+	}
+}
+
+// savesEditedCopy returns true if a copy of the objects edited by edit is saved with the record of the change, which
+// requires the dry run to have returned them
+func (o *confirmOptions) savesEditedCopy() bool {
+	return len(o.editedFile) > 0 && len(o.preview) > 0
+}
+
+// editedCopy returns the copy of the objects edited by edit that is saved with the record of the change. It is the file
+// as the user saved it, unless the policy masks values in any of the objects, in which case it is the objects as the
+// server dry run returned them, with their sensitive values masked.
+func (o *confirmOptions) editedCopy() ([]byte, error) {
+	r := o.policy.redactor()
+	items := make([]interface{}, 0, len(o.preview))
+	masked := false
+	for _, p := range o.preview {
+		redacted := r.redact(p.merged)
+		masked = masked || !reflect.DeepEqual(redacted, p.merged)
+		items = append(items, redacted)
+	}
+	if !masked {
+		return os.ReadFile(o.editedFile)
+	}
+	return []byte(yaml.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})), nil
+}
+
+// recordAborted records a command that was not executed, because it was not confirmed
+func (o *confirmOptions) recordAborted(cmd *cobra.Command, verb string, kubectlArgs []string) {
+	record := o.newChangeRecord(verb, kubectlArgs, nil)
+	record.Result = changeResultAborted
+	record.Created = nil
+	o.recordChange(cmd, record)
+}
+
+// listChangeRecords returns the records of the changes in the history, oldest first. Records that cannot be read are
+// skipped with a warning.
+func listChangeRecords(cmd *cobra.Command, historyDir string) ([]*changeRecord, error) {
+	entries, err := os.ReadDir(historyDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var records []*changeRecord
+	for _, entry := range entries {
+		if !entry.IsDir() || !changeIDPattern.MatchString(entry.Name()) {
+			continue
+		}
+		r, err := loadChangeRecord(historyDir, entry.Name())
+		if err != nil {
+			cmd.PrintErrf("Warning: %v\n", err)
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+// historyFilter selects the changes listed by kubectl confirm history
+type historyFilter struct {
+	context   string
+	namespace string
+	user      string
+	verb      string
+	since     string
+	until     string
+}
+
+// parseHistoryTime parses the time of --since or --until, which is a duration before now, like 90m, 24h, or 7d, a
+// date in the local time zone, like 2024-01-02, or a time in RFC 3339 format, like 2024-01-02T15:04:05Z
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") && days >= 0 {
+		return now.AddDate(0, 0, -days), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a duration like 24h or 7d, a date like 2024-01-02, or a time like 2024-01-02T15:04:05Z", s)
+}
+
+// filter returns the records that match all the criteria of the filter. Contexts and namespaces can be glob patterns.
+func (f historyFilter) filter(records []*changeRecord, now time.Time) ([]*changeRecord, error) {
+	var since, until time.Time
+	var err error
+	if len(f.since) > 0 {
+		if since, err = parseHistoryTime(f.since, now); err != nil {
+			return nil, fmt.Errorf("--since: %v", err)
+		}
+	}
+	if len(f.until) > 0 {
+		if until, err = parseHistoryTime(f.until, now); err != nil {
+			return nil, fmt.Errorf("--until: %v", err)
+		}
+	}
+	var result []*changeRecord
+	for _, r := range records {
+		switch {
+		case len(f.context) > 0 && !matchesAnyPattern([]string{f.context}, r.Context),
+			len(f.namespace) > 0 && !matchesAnyPattern([]string{f.namespace}, r.Namespace),
+			len(f.user) > 0 && f.user != r.User,
+			len(f.verb) > 0 && f.verb != r.Verb,
+			!since.IsZero() && r.Time.Before(since),
+			!until.IsZero() && !r.Time.Before(until):
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// deleteCreatedCommands returns the kubectl commands that delete the objects created by the change, in the context and
+// with the connection flags of the change
+func (r *changeRecord) deleteCreatedCommands() []string {
+	commands := make([]string, 0, len(r.Created))
+	for _, c := range r.Created {
+		args := []string{"kubectl", "delete", c.Resource}
+		if len(c.Namespace) > 0 {
+			args = append(args, "--namespace="+c.Namespace)
+		}
+		if len(r.Context) > 0 {
+			args = append(args, "--context="+r.Context)
+		}
+		commands = append(commands, strings.Join(append(args, r.ConnectionFlags...), " "))
+	}
+	return commands
+}
+
+// unsavedSecrets returns the Secrets that were left out of the snapshot of the change, like secret/foo (namespace bar)
+func (r *changeRecord) unsavedSecrets() []string {
+	secrets := make([]string, 0, len(r.UnsavedSecrets))
+	for _, s := range r.UnsavedSecrets {
+		if len(s.Namespace) > 0 {
+			secrets = append(secrets, fmt.Sprintf("%s (namespace %s)", s.Resource, s.Namespace))
+		} else {
+			secrets = append(secrets, s.Resource)
+		}
+	}
+	return secrets
+}
+
+// summary returns the result of the change as it is shown in the history, including whether its verification failed
+func (r *changeRecord) summary() string {
+	if r.Verification != nil && !r.Verification.Succeeded {
+		return r.Result + ", verification failed"
+	}
+	return r.Result
+}
+
+// newHistoryCommand returns the command that lists the changes in the history
+func newHistoryCommand() *cobra.Command {
+	f := historyFilter{}
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the commands that were confirmed or aborted, which are recorded in the history",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The history is the output of the command, so it is printed to stdout instead of stderr
+			cmd.SetOut(cmd.OutOrStdout())
+			return printHistory(cmd, f, time.Now())
+		},
+	}
+	cmd.Flags().StringVar(&f.context, "context", "", "Only list changes in the context, which can be a glob pattern")
+	cmd.Flags().StringVarP(&f.namespace, "namespace", "n", "", "Only list changes in the namespace, which can be a glob pattern")
+	cmd.Flags().StringVar(&f.user, "user", "", "Only list changes made as the kubeconfig user")
+	cmd.Flags().StringVar(&f.verb, "verb", "", "Only list changes made by the command, like apply or rollback")
+	cmd.Flags().StringVar(&f.since, "since", "", "Only list changes since a duration ago, like 24h or 7d, a date, like 2024-01-02, or a time")
+	cmd.Flags().StringVar(&f.until, "until", "", "Only list changes before a duration ago, a date, or a time")
+	return cmd
+}
+
+// printHistory lists the changes in the history that match the filter, oldest first
+func printHistory(cmd *cobra.Command, f historyFilter, now time.Time) error {
+	historyDir := getHistoryDir()
+	if len(historyDir) == 0 {
+		return fmt.Errorf("the history is disabled, because KUBECTL_CONFIRM_HISTORY is empty")
+	}
+	records, err := listChangeRecords(cmd, historyDir)
+	if err != nil {
+		return err
+	}
+	records, err = f.filter(records, now)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		cmd.PrintErrln("No changes found in the history")
+		return nil
+	}
+
+	headers := []string{"ID", "TIME", "RESULT", "CONTEXT", "NAMESPACE", "USER", "COMMAND"}
+	rows := [][]string{headers}
+	for _, r := range records {
+		rows = append(rows, []string{
+			r.ID, r.Time.In(now.Location()).Format("2006-01-02 15:04"), r.summary(), r.Context, r.Namespace, r.User,
+			"kubectl " + strings.Join(redactArgs(r.Args), " "),
+		})
+	}
+	widths := make([]int, len(headers))
+	for _, row := range rows {
+		for i, value := range row {
+			widths[i] = max(widths[i], len(value))
+		}
+	}
+	for _, row := range rows {
+		line := ""
+		for i, value := range row {
+			line += fmt.Sprintf("%-*s  ", widths[i], value)
+		}
+		cmd.Println(strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+// newShowCommand returns the command that shows a change in the history, along with the report that was shown at the
+// prompt
+func newShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a change in the history, and the report that was shown when it was confirmed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The change is the output of the command, so it is printed to stdout instead of stderr
+			cmd.SetOut(cmd.OutOrStdout())
+			return showChange(cmd, args[0])
+		},
+	}
+}
+
+// showChange prints the record of a change, followed by the report that was shown at the prompt, as it was shown
+func showChange(cmd *cobra.Command, id string) error {
+	historyDir := getHistoryDir()
+	r, err := loadChangeRecord(historyDir, id)
+	if err != nil {
+		return err
+	}
+	report, err := os.ReadFile(filepath.Join(historyDir, id, changeReportFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	util.PrintSectionTitle(cmd, "Change")
+	cmd.Printf("%-11s %s\n", "ID:", r.ID)
+	cmd.Printf("%-11s %s\n", "Time:", r.Time.Local().Format("2006-01-02 15:04:05 MST"))
+	cmd.Printf("%-11s kubectl %s\n", "Command:", strings.Join(redactArgs(r.Args), " "))
+	cmd.Printf("%-11s %s\n", "Context:", r.Context)
+	cmd.Printf("%-11s %s\n", "Namespace:", r.Namespace)
+	cmd.Printf("%-11s %s\n", "User:", r.User)
+	cmd.Printf("%-11s %s\n", "Result:", r.Result)
+	if len(r.Error) > 0 {
+		cmd.Printf("%-11s %s\n", "Error:", r.Error)
+	}
+	if r.Verification != nil {
+		verified := "succeeded"
+		if !r.Verification.Succeeded {
+			verified = "failed"
+		}
+		cmd.Printf("%-11s %s\n", "Verified:", verified)
+	}
+	if len(r.RollbackOf) > 0 {
+		cmd.Printf("%-11s %s\n", "Rolls back:", r.RollbackOf)
+	}
+	if len(r.ConnectionFlags) > 0 {
+		cmd.Printf("%-11s %s\n", "Connection:", strings.Join(r.ConnectionFlags, " "))
+	}
+	if r.Snapshot && len(r.UnsavedSecrets) == 0 {
+		cmd.Printf("%-11s kubectl confirm rollback %s\n", "Rollback:", r.ID)
+	}
+	for i, secret := range r.unsavedSecrets() {
+		label := ""
+		if i == 0 {
+			label = "Unsaved:"
+		}
+		cmd.Printf("%-11s %s\n", label, secret)
+	}
+	for i, command := range r.deleteCreatedCommands() {
+		label := ""
+		if i == 0 {
+			label = "Created:"
+		}
+		cmd.Printf("%-11s %s\n", label, command)
+	}
+	cmd.Println()
+
+	if len(report) == 0 {
+		cmd.Println("The report shown at the prompt was not recorded for this change")
+		return nil
+	}
+	cmd.Print(string(report))
+	return nil
+}
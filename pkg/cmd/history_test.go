@@ -0,0 +1,349 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestNewChangeID(t *testing.T) {
+	id := newChangeID(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC))
+	if !regexp.MustCompile(`^20240102-150405-[0-9a-f]{6}$`).MatchString(id) {
+		t.Fatalf("wrong change ID %q", id)
+	}
+}
+
+func TestGetHistoryDir(t *testing.T) {
+	historyDir := os.Getenv("KUBECTL_CONFIRM_HISTORY")
+	defer os.Setenv("KUBECTL_CONFIRM_HISTORY", historyDir)
+
+	_ = os.Setenv("KUBECTL_CONFIRM_HISTORY", "/tmp/history")
+	if actual := getHistoryDir(); actual != "/tmp/history" {
+		t.Fatalf("expected the history dir from the environment, got %q", actual)
+	}
+	_ = os.Unsetenv("KUBECTL_CONFIRM_HISTORY")
+	if actual := getHistoryDir(); filepath.Base(actual) != "confirm-history" {
+		t.Fatalf("expected the default history dir, got %q", actual)
+	}
+}
+
+// useTestHistoryDir records changes in a temp dir until the test finishes, and returns the dir
+func useTestHistoryDir(t *testing.T) string {
+	historyDir := os.Getenv("KUBECTL_CONFIRM_HISTORY")
+	t.Cleanup(func() {
+		_ = os.Setenv("KUBECTL_CONFIRM_HISTORY", historyDir)
+	})
+	dir := t.TempDir()
+	_ = os.Setenv("KUBECTL_CONFIRM_HISTORY", dir)
+	return dir
+}
+
+func TestRecordChange(t *testing.T) {
+	dir := useTestHistoryDir(t)
+
+	o := &confirmOptions{resolvedContext: "prod", resolvedNamespace: "default", resolvedUser: "admin", namespace: "x"}
+	record := o.newChangeRecord("delete", []string{"delete", "pod", "foo", "--token=abc"}, errors.New("exit status 1"))
+	cmd, _, _, stderr := util.NewTestCommand()
+	record.Snapshot = true
+	o.recordChange(cmd, record)
+	if expected := "can be rolled back with: kubectl confirm rollback " + o.changeID(); !strings.Contains(stderr.String(), expected) {
+		t.Fatalf("expected stderr to contain %q, got: %s", expected, stderr.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, o.changeID(), changeRecordFile))
+	if err != nil {
+		t.Fatalf("the record was not written: %v", err)
+	}
+	var actual changeRecord
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("invalid record: %v", err)
+	}
+	if actual.ID != o.changeID() || actual.Verb != "delete" || actual.Context != "prod" || actual.Namespace != "x" || actual.User != "admin" ||
+		actual.Result != changeResultFailed || actual.Error != "exit status 1" || !reflect.DeepEqual(actual.Args, []string{"delete", "pod", "foo", "--token=***"}) || !actual.Snapshot {
+		t.Fatalf("wrong record: %+v", actual)
+	}
+	info, err := os.Stat(filepath.Join(dir, o.changeID()))
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the change dir to be private, got %v, %v", info, err)
+	}
+
+	// A change that affected Secrets that were not saved cannot be rolled back
+	o = &confirmOptions{}
+	record = o.newChangeRecord("delete", []string{"delete", "secret", "foo"}, nil)
+	record.Snapshot = true
+	record.UnsavedSecrets = []objectRef{{Resource: "secret/foo", Namespace: "x"}}
+	cmd, _, stdout, stderr := util.NewTestCommand()
+	o.recordChange(cmd, record)
+	if expected := "cannot be rolled back, because it affected Secrets"; !strings.Contains(stderr.String(), expected) || strings.Contains(stderr.String(), "kubectl confirm rollback") {
+		t.Fatalf("expected stderr to contain %q, got: %s", expected, stderr.String())
+	}
+	if err := showChange(cmd, record.ID); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Unsaved:    secret/foo (namespace x)\n"; !strings.Contains(stdout.String(), expected) || strings.Contains(stdout.String(), "Rollback:") {
+		t.Fatalf("expected stdout to contain %q, got: %s", expected, stdout.String())
+	}
+
+	// Nothing is recorded if the history is disabled
+	_ = os.Setenv("KUBECTL_CONFIRM_HISTORY", "")
+	o = &confirmOptions{}
+	o.recordChange(cmd, o.newChangeRecord("delete", nil, nil))
+	if _, err := os.Stat(filepath.Join(dir, o.changeID())); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be recorded, got %v", err)
+	}
+}
+
+func TestNewChangeRecordConnection(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &confirmOptions{}
+	o.parseArgs([]string{"apply", "-f", "foo.yaml", "--kubeconfig", "config", "--server=https://example.com", "--token=abc", "--context=prod", "--insecure-skip-tls-verify"})
+	o.preview = []previewObject{
+		{live: nil, merged: map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": "foo", "namespace": "bar"}}},
+		{live: map[string]interface{}{}, merged: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "foo", "namespace": "bar"}}},
+	}
+
+	record := o.newChangeRecord("apply", o.args.Raw(), nil)
+	expectedFlags := []string{"--kubeconfig=" + filepath.Join(wd, "config"), "--server=https://example.com", "--insecure-skip-tls-verify"}
+	if !reflect.DeepEqual(record.ConnectionFlags, expectedFlags) {
+		t.Fatalf("wrong connection flags.\nexpected: %v\ngot: %v", expectedFlags, record.ConnectionFlags)
+	}
+	expectedCreated := []objectRef{{Resource: "deployment.v1.apps/foo", Namespace: "bar"}}
+	if !reflect.DeepEqual(record.Created, expectedCreated) {
+		t.Fatalf("wrong created objects.\nexpected: %v\ngot: %v", expectedCreated, record.Created)
+	}
+}
+
+func TestLoadChangeRecord(t *testing.T) {
+	dir := t.TempDir()
+	record := &changeRecord{ID: "20240102-150405-1a2b3c", Verb: "apply", Context: "prod"}
+	if err := saveChangeRecord(dir, record); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		historyDir    string
+		id            string
+		expectedError string
+	}{
+		{historyDir: dir, id: "20240102-150405-1a2b3c"},
+		{historyDir: dir, id: "20240102-150405-000000", expectedError: "change 20240102-150405-000000 was not found in the history"},
+		{historyDir: dir, id: "../20240102-150405-1a2b3c", expectedError: `invalid change ID "../20240102-150405-1a2b3c"`},
+		{historyDir: "", id: "20240102-150405-1a2b3c", expectedError: "the history is disabled, because KUBECTL_CONFIRM_HISTORY is empty"},
+	}
+	for _, tc := range testCases {
+		actual, err := loadChangeRecord(tc.historyDir, tc.id)
+		if len(tc.expectedError) > 0 {
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+			}
+			continue
+		}
+		if err != nil || actual.Verb != "apply" || actual.Context != "prod" {
+			t.Fatalf("wrong record %+v, %v", actual, err)
+		}
+	}
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value         string
+		expected      time.Time
+		expectedError bool
+	}{
+		{value: "90m", expected: time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)},
+		{value: "7d", expected: time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)},
+		{value: "2024-01-02", expected: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-02T15:04:05Z", expected: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{value: "last tuesday", expectedError: true},
+		{value: "-1d", expectedError: true},
+	}
+	for _, tc := range testCases {
+		actual, err := parseHistoryTime(tc.value, now)
+		if tc.expectedError != (err != nil) {
+			t.Fatalf("%s: unexpected error %v", tc.value, err)
+		}
+		if !actual.Equal(tc.expected) {
+			t.Fatalf("%s: expected %s, got %s", tc.value, tc.expected, actual)
+		}
+	}
+}
+
+func TestPrintHistory(t *testing.T) {
+	dir := useTestHistoryDir(t)
+	records := []*changeRecord{
+		{ID: "20240102-150405-000001", Time: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), Verb: "apply", Args: []string{"apply", "-f", "x.yaml"}, Context: "prod-us", Namespace: "api", User: "admin", Result: changeResultSucceeded},
+		{ID: "20240103-090000-000002", Time: time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC), Verb: "delete", Args: []string{"delete", "pod", "x"}, Context: "staging", Namespace: "default", User: "dev", Result: changeResultAborted},
+		{ID: "20240105-100000-000003", Time: time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC), Verb: "apply", Args: []string{"apply", "-f", "y.yaml"}, Context: "prod-eu", Namespace: "api", User: "admin", Result: changeResultSucceeded,
+			Verification: &verificationResult{}},
+	}
+	for _, r := range records {
+		if err := saveChangeRecord(dir, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		filter         historyFilter
+		expectedStdout string
+		expectedStderr string
+		expectedError  string
+	}{
+		{
+			name:   "all changes",
+			filter: historyFilter{},
+			expectedStdout: "" +
+				"ID                      TIME              RESULT                          CONTEXT  NAMESPACE  USER   COMMAND\n" +
+				"20240102-150405-000001  2024-01-02 15:04  succeeded                       prod-us  api        admin  kubectl apply -f x.yaml\n" +
+				"20240103-090000-000002  2024-01-03 09:00  aborted                         staging  default    dev    kubectl delete pod x\n" +
+				"20240105-100000-000003  2024-01-05 10:00  succeeded, verification failed  prod-eu  api        admin  kubectl apply -f y.yaml\n",
+		},
+		{
+			name:           "context pattern and time range",
+			filter:         historyFilter{context: "prod-*", since: "2024-01-02", until: "2024-01-03"},
+			expectedStdout: "20240102-150405-000001",
+		},
+		{
+			name:           "verb and user",
+			filter:         historyFilter{verb: "delete", user: "dev", namespace: "default"},
+			expectedStdout: "20240103-090000-000002",
+		},
+		{
+			name:           "since a duration",
+			filter:         historyFilter{since: "6d"},
+			expectedStdout: "20240105-100000-000003",
+		},
+		{
+			name:           "nothing matches",
+			filter:         historyFilter{user: "nobody"},
+			expectedStderr: "No changes found in the history",
+		},
+		{
+			name:          "invalid time",
+			filter:        historyFilter{until: "tomorrow"},
+			expectedError: "--until: invalid time",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, _, stdout, stderr := util.NewTestCommand()
+			err := printHistory(cmd, tc.filter, now)
+			if len(tc.expectedError) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.expectedError) {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stdout.String(), tc.expectedStdout) || !strings.Contains(stderr.String(), tc.expectedStderr) {
+				t.Fatalf("wrong output.\nexpected stdout: %s\ngot: %s\nexpected stderr: %s\ngot: %s", tc.expectedStdout, stdout.String(), tc.expectedStderr, stderr.String())
+			}
+			// A filter that matches a single change lists it after the header
+			if len(tc.expectedStdout) > 0 && !strings.Contains(tc.expectedStdout, "\n") && strings.Count(stdout.String(), "\n") != 2 {
+				t.Fatalf("expected only one change to be listed, got:\n%s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestShowChange(t *testing.T) {
+	dir := useTestHistoryDir(t)
+	record := &changeRecord{ID: "20240102-150405-1a2b3c", Time: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), Verb: "rollback", Args: []string{"apply", "--filename", "snapshot.yaml"},
+		Context: "prod", Namespace: "api", User: "admin", Result: changeResultFailed, Error: "exit status 1", RollbackOf: "20240101-000000-000000", Snapshot: true,
+		ConnectionFlags: []string{"--user=admin"}, Created: []objectRef{{Resource: "configmap/foo", Namespace: "api"}, {Resource: "namespace/api"}}}
+	if err := saveChangeRecord(dir, record); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, _, stdout, _ := util.NewTestCommand()
+	if err := showChange(cmd, record.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"========== Change ===========\nID:         20240102-150405-1a2b3c\n",
+		"Command:    kubectl apply --filename snapshot.yaml\nContext:    prod\nNamespace:  api\nUser:       admin\nResult:     failed\nError:      exit status 1\n",
+		"Rolls back: 20240101-000000-000000\nConnection: --user=admin\nRollback:   kubectl confirm rollback 20240102-150405-1a2b3c\n",
+		"Created:    kubectl delete configmap/foo --namespace=api --context=prod --user=admin\n" +
+			"            kubectl delete namespace/api --context=prod --user=admin\n",
+		"The report shown at the prompt was not recorded for this change\n",
+	} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Fatalf("expected stdout to contain:\n%s\ngot:\n%s", expected, stdout.String())
+		}
+	}
+
+	report := "========== Confirm ==========\nThe following command will be executed:\nkubectl apply --filename snapshot.yaml\n"
+	if err := os.WriteFile(filepath.Join(dir, record.ID, changeReportFile), []byte(report), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd, _, stdout, _ = util.NewTestCommand()
+	if err := showChange(cmd, record.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(stdout.String(), "\n\n"+report) {
+		t.Fatalf("expected the report to be shown, got:\n%s", stdout.String())
+	}
+}
+
+func TestRecordAborted(t *testing.T) {
+	dir := useTestHistoryDir(t)
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("config"), `{"current-context": "prod", "contexts": [{"name": "prod", "context": {"namespace": "api"}}]}`, "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("can-i"), "yes\n", "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), `{"kind": "List", "items": []}`, "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), "pod \"x\" deleted (server dry run)\n", "", nil)
+	util.Exit = func(code int) {}
+
+	o := &confirmOptions{}
+	cmd, stdin, stdout, _ := util.NewTestCommand()
+	stdin.WriteString("no\n")
+	if err := o.run(cmd, []string{"delete", "pod", "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := loadChangeRecord(dir, o.changeID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Result != changeResultAborted || record.Verb != "delete" || record.Context != "prod" || record.Namespace != "api" {
+		t.Fatalf("wrong record: %+v", record)
+	}
+	report, err := os.ReadFile(filepath.Join(dir, o.changeID(), changeReportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stdout.String(), string(report)) || !strings.Contains(string(report), "pod \"x\" deleted (server dry run)\n") ||
+		!strings.HasSuffix(string(report), "Enter 'yes' to continue: \n") {
+		t.Fatalf("expected the report to be what was shown before the prompt.\nreport:\n%s\nstdout:\n%s", string(report), stdout.String())
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// The path of the pod template spec in each kind of workload
+var podSpecPaths = map[string][]string{
+	"Deployment.apps":  {"spec", "template", "spec"},
+	"StatefulSet.apps": {"spec", "template", "spec"},
+	"DaemonSet.apps":   {"spec", "template", "spec"},
+	"Job.batch":        {"spec", "template", "spec"},
+	"CronJob.batch":    {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// The registry of images that do not specify one
+const defaultRegistry = "docker.io"
+
+// imageRef is a container image reference, like registry.example.com/team/app:1.2@sha256:...
+type imageRef struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// parseImageRef parses a container image reference. The registry is the first component of the name if it looks like
+// a host name, and docker.io otherwise.
+func parseImageRef(image string) imageRef {
+	ref := imageRef{registry: defaultRegistry}
+	name, digest, _ := strings.Cut(image, "@")
+	ref.digest = digest
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.tag = name[:i], name[i+1:]
+	}
+	if first, rest, found := strings.Cut(name, "/"); found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.registry, name = first, rest
+	}
+	ref.repository = name
+	return ref
+}
+
+// containerImage is the image of a container or init container of a workload
+type containerImage struct {
+	container string
+	image     string
+}
+
+// containerImages returns the images of the containers and init containers of a workload, or nil if obj is not a
+// workload
+func containerImages(obj map[string]interface{}) []containerImage {
+	if obj == nil {
+		return nil
+	}
+	kind := util.NestedString(obj, "kind")
+	if group := util.ObjectGroup(obj); group != "" {
+		kind += "." + group
+	}
+	path, found := podSpecPaths[kind]
+	if !found {
+		return nil
+	}
+	spec := util.NestedMap(obj, path...)
+	var images []containerImage
+	for _, field := range []string{"initContainers", "containers"} {
+		for _, c := range util.NestedSlice(spec, field) {
+			images = append(images, containerImage{container: util.NestedString(c, "name"), image: util.NestedString(c, "image")})
+		}
+	}
+	return images
+}
+
+// imageChange is a container whose image changes when the command is executed. From is empty if the container or the
+// workload does not exist yet.
+type imageChange struct {
+	container string
+	from      string
+	to        string
+}
+
+// imageChanges returns the containers of the workload whose images change when the command is executed
+func (p previewObject) imageChanges() []imageChange {
+	before := map[string]string{}
+	for _, c := range containerImages(p.live) {
+		before[c.container] = c.image
+	}
+	var changes []imageChange
+	for _, c := range containerImages(p.merged) {
+		if from, found := before[c.container]; !found || from != c.image {
+			changes = append(changes, imageChange{container: c.container, from: from, to: c.image})
+		}
+	}
+	return changes
+}
+
+// imageProblems returns what is wrong with the new image of a container: a latest or missing tag, a tag that changes
+// while the digest, which takes precedence, stays the same, a digest that changes while the tag stays the same, and a
+// registry that is not allowed by the policy
+func (o *confirmOptions) imageProblems(c imageChange) []string {
+	var problems []string
+	to := parseImageRef(c.to)
+	if len(to.digest) == 0 && (len(to.tag) == 0 || to.tag == "latest") {
+		problems = append(problems, "uses the latest tag")
+	}
+	if len(c.from) > 0 {
+		from := parseImageRef(c.from)
+		sameImage := from.registry == to.registry && from.repository == to.repository
+		if sameImage && len(from.digest) > 0 && from.digest == to.digest && from.tag != to.tag {
+			problems = append(problems, fmt.Sprintf("changes the tag from %s to %s but not the digest, so the image does not change", from.tag, to.tag))
+		}
+		if sameImage && len(from.digest) > 0 && len(to.digest) > 0 && from.digest != to.digest && from.tag == to.tag && len(to.tag) > 0 {
+			problems = append(problems, fmt.Sprintf("changes the digest but not the tag %s", to.tag))
+		}
+	}
+	if o.policy != nil && len(o.policy.ImageRegistries) > 0 && !matchesAnyPattern(o.policy.ImageRegistries, to.registry) {
+		problems = append(problems, fmt.Sprintf("uses registry %s, which is not allowed by the policy", to.registry))
+	}
+	return problems
+}
+
+// printImages shows the container images that change in the workloads affected by the command, and warns about images
+// that may not be what was intended. Nothing is printed if no images change.
+func (o *confirmOptions) printImages(cmd *cobra.Command) {
+	var lines, warnings []string
+	for _, p := range o.preview {
+		changes := p.imageChanges()
+		if len(changes) == 0 {
+			continue
+		}
+		name := util.ObjectName(p.merged)
+		lines = append(lines, name+":")
+		for _, c := range changes {
+			from := c.from
+			if len(from) == 0 {
+				from = "<none>"
+			}
+			lines = append(lines, fmt.Sprintf("  %s: %s -> %s", c.container, from, c.to))
+			for _, problem := range o.imageProblems(c) {
+				warnings = append(warnings, fmt.Sprintf("  %s %s: %s %s", name, c.container, c.to, problem))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	util.PrintSectionTitle(cmd, "Images")
+	defer cmd.Println()
+	for _, line := range lines {
+		cmd.Println(line)
+	}
+	if len(warnings) > 0 {
+		cmd.Printf("WARNING: The following images may not be what was intended:\n")
+		for _, w := range warnings {
+			cmd.Println(w)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestParseImageRef(t *testing.T) {
+	testCases := []struct {
+		image    string
+		expected imageRef
+	}{
+		{image: "nginx", expected: imageRef{registry: "docker.io", repository: "nginx"}},
+		{image: "nginx:1.25", expected: imageRef{registry: "docker.io", repository: "nginx", tag: "1.25"}},
+		{image: "team/app:1.2", expected: imageRef{registry: "docker.io", repository: "team/app", tag: "1.2"}},
+		{image: "localhost/app", expected: imageRef{registry: "localhost", repository: "app"}},
+		{image: "localhost:5000/app:1", expected: imageRef{registry: "localhost:5000", repository: "app", tag: "1"}},
+		{image: "registry.example.com/team/app:1.2@sha256:abc", expected: imageRef{registry: "registry.example.com", repository: "team/app", tag: "1.2", digest: "sha256:abc"}},
+		{image: "registry.example.com/app@sha256:abc", expected: imageRef{registry: "registry.example.com", repository: "app", digest: "sha256:abc"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.image, func(t *testing.T) {
+			if actual := parseImageRef(tc.image); actual != tc.expected {
+				t.Fatalf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestImageChanges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		live     string
+		merged   string
+		expected []imageChange
+	}{
+		{
+			name:   "deployment",
+			live:   `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"initContainers": [{"name": "init", "image": "init:1"}], "containers": [{"name": "app", "image": "app:1"}, {"name": "proxy", "image": "proxy:1"}]}}}}`,
+			merged: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"initContainers": [{"name": "init", "image": "init:2"}], "containers": [{"name": "app", "image": "app:2"}, {"name": "proxy", "image": "proxy:1"}, {"name": "log", "image": "log:1"}]}}}}`,
+			expected: []imageChange{
+				{container: "init", from: "init:1", to: "init:2"},
+				{container: "app", from: "app:1", to: "app:2"},
+				{container: "log", to: "log:1"},
+			},
+		},
+		{
+			name:     "new cronjob",
+			merged:   `{"apiVersion": "batch/v1", "kind": "CronJob", "spec": {"jobTemplate": {"spec": {"template": {"spec": {"containers": [{"name": "job", "image": "job:1"}]}}}}}}`,
+			expected: []imageChange{{container: "job", to: "job:1"}},
+		},
+		{
+			name:   "not a workload",
+			live:   `{"apiVersion": "v1", "kind": "Pod", "spec": {"containers": [{"name": "app", "image": "app:1"}]}}`,
+			merged: `{"apiVersion": "v1", "kind": "Pod", "spec": {"containers": [{"name": "app", "image": "app:2"}]}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := previewObject{merged: decodeTestObject(t, tc.merged)}
+			if len(tc.live) > 0 {
+				p.live = decodeTestObject(t, tc.live)
+			}
+			if actual := p.imageChanges(); !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestImageProblems(t *testing.T) {
+	testCases := []struct {
+		name       string
+		change     imageChange
+		registries []string
+		expected   []string
+	}{
+		{
+			name:   "tag bump",
+			change: imageChange{from: "app:1", to: "app:2"},
+		},
+		{
+			name:     "latest tag",
+			change:   imageChange{from: "app:1", to: "app:latest"},
+			expected: []string{"uses the latest tag"},
+		},
+		{
+			name:     "no tag",
+			change:   imageChange{to: "app"},
+			expected: []string{"uses the latest tag"},
+		},
+		{
+			name:   "digest without tag",
+			change: imageChange{to: "app@sha256:abc"},
+		},
+		{
+			name:     "tag changes but not digest",
+			change:   imageChange{from: "app:1@sha256:abc", to: "app:2@sha256:abc"},
+			expected: []string{"changes the tag from 1 to 2 but not the digest, so the image does not change"},
+		},
+		{
+			name:     "digest changes but not tag",
+			change:   imageChange{from: "app:1@sha256:abc", to: "app:1@sha256:def"},
+			expected: []string{"changes the digest but not the tag 1"},
+		},
+		{
+			name:       "allowed registry",
+			change:     imageChange{to: "123.dkr.ecr.us-east-1.amazonaws.com/app:1"},
+			registries: []string{"registry.example.com", "*.dkr.ecr.us-east-1.amazonaws.com"},
+		},
+		{
+			name:       "registry not allowed",
+			change:     imageChange{from: "registry.example.com/app:1", to: "app:latest"},
+			registries: []string{"registry.example.com"},
+			expected:   []string{"uses the latest tag", "uses registry docker.io, which is not allowed by the policy"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := confirmOptions{policy: &policy{ImageRegistries: tc.registries}}
+			if actual := o.imageProblems(tc.change); !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPrintImages(t *testing.T) {
+	o := confirmOptions{preview: []previewObject{
+		{
+			live:   decodeTestObject(t, `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api"}, "spec": {"template": {"spec": {"containers": [{"name": "app", "image": "app:1"}, {"name": "proxy", "image": "proxy:1"}]}}}}`),
+			merged: decodeTestObject(t, `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api"}, "spec": {"template": {"spec": {"containers": [{"name": "app", "image": "app:2"}, {"name": "proxy", "image": "proxy:latest"}]}}}}`),
+		},
+		{
+			live:   decodeTestObject(t, `{"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"name": "db"}, "spec": {"template": {"spec": {"containers": [{"name": "db", "image": "db:1"}]}}}}`),
+			merged: decodeTestObject(t, `{"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"name": "db"}, "spec": {"replicas": 3, "template": {"spec": {"containers": [{"name": "db", "image": "db:1"}]}}}}`),
+		},
+		{
+			merged: decodeTestObject(t, `{"apiVersion": "batch/v1", "kind": "Job", "metadata": {"name": "migrate"}, "spec": {"template": {"spec": {"containers": [{"name": "migrate", "image": "app:2"}]}}}}`),
+		},
+	}}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	o.printImages(cmd)
+	expected := `========== Images ===========
+deployment.apps/api:
+  app: app:1 -> app:2
+  proxy: proxy:1 -> proxy:latest
+job.batch/migrate:
+  migrate: <none> -> app:2
+WARNING: The following images may not be what was intended:
+  deployment.apps/api proxy: proxy:latest uses the latest tag
+
+`
+	if stdout.String() != expected {
+		t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+
+	o = confirmOptions{preview: []previewObject{o.preview[1]}}
+	cmd, _, stdout, _ = util.NewTestCommand()
+	o.printImages(cmd)
+	if stdout.Len() > 0 {
+		t.Fatalf("expected nothing to be printed, got:\n%s", stdout.String())
+	}
+}
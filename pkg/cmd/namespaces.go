@@ -0,0 +1,214 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+// Kinds that are not namespaced, so they are expected to have no namespace. Kinds are written as Kind for the core API
+// group, or Kind.group for other groups. Kinds of custom resources are not known, so they are assumed to be namespaced.
+var clusterScopedKinds = map[string]bool{
+	"APIService.apiregistration.k8s.io":                         true,
+	"CertificateSigningRequest.certificates.k8s.io":             true,
+	"ClusterRole.rbac.authorization.k8s.io":                     true,
+	"ClusterRoleBinding.rbac.authorization.k8s.io":              true,
+	"CSIDriver.storage.k8s.io":                                  true,
+	"CSINode.storage.k8s.io":                                    true,
+	"CustomResourceDefinition.apiextensions.k8s.io":             true,
+	"FlowSchema.flowcontrol.apiserver.k8s.io":                   true,
+	"IngressClass.networking.k8s.io":                            true,
+	"MutatingWebhookConfiguration.admissionregistration.k8s.io": true,
+	"Namespace":                       true,
+	"Node":                            true,
+	"PersistentVolume":                true,
+	"PodSecurityPolicy.policy":        true,
+	"PriorityClass.scheduling.k8s.io": true,
+	"PriorityLevelConfiguration.flowcontrol.apiserver.k8s.io":       true,
+	"RuntimeClass.node.k8s.io":                                      true,
+	"StorageClass.storage.k8s.io":                                   true,
+	"ValidatingAdmissionPolicy.admissionregistration.k8s.io":        true,
+	"ValidatingAdmissionPolicyBinding.admissionregistration.k8s.io": true,
+	"ValidatingWebhookConfiguration.admissionregistration.k8s.io":   true,
+	"VolumeAttachment.storage.k8s.io":                               true,
+}
+
+// The extensions of the files kubectl reads from a directory
+var manifestExtensions = []string{".json", ".yaml", ".yml"}
+
+// manifestObject is an object in one of the manifests of the command, and the file, kustomization, or stdin it is in
+type manifestObject struct {
+	yaml.Header
+	source string
+}
+
+// kind returns the kind of the object as Kind for the core API group, or Kind.group for other groups
+func (m manifestObject) kind() string {
+	if group, _, found := strings.Cut(m.APIVersion, "/"); found {
+		return m.Kind + "." + group
+	}
+	return m.Kind
+}
+
+// namespaced returns true if the object is expected to be in a namespace
+func (m manifestObject) namespaced() bool {
+	return !clusterScopedKinds[m.kind()]
+}
+
+// hasManifests returns true if the command has manifests that can be read without consuming them
+func (o *confirmOptions) hasManifests() bool {
+	return o.hasRenderedManifest() || (len(o.filenames) > 0 && !o.hasAnyNonRegularFiles)
+}
+
+// printManifests prints the Rendered section for a kustomization or a manifest from stdin, and then warns about
+// objects in any of the manifests that take their namespace from the context, or whose namespace does not match
+// --namespace, and about objects with deprecated API versions. It is part of the config step, because it uses the
+// namespace resolved by printConfig.
+func (o *confirmOptions) printManifests(cmd *cobra.Command) error {
+	var objects []manifestObject
+	if o.hasRenderedManifest() {
+		rendered, err := o.printRendered(cmd)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, rendered...)
+	}
+	objects = append(objects, o.readManifests(cmd).files...)
+	o.manifests = objects
+	o.printNamespaceCheck(cmd, objects)
+	o.printAPIVersions(cmd, objects)
+	return nil
+}
+
+// manifestReader reads the objects in the manifests of the command the first time they are needed, so that the preview
+// steps that run concurrently share one kubectl kustomize run and one read of the files
+type manifestReader struct {
+	once sync.Once
+	// The objects rendered from the kustomization or read from stdin, where they come from, and why they could not be
+	// rendered
+	rendered    []manifestObject
+	source      string
+	renderedErr error
+	// The objects in the files and directories specified by -f
+	files []manifestObject
+}
+
+// readManifests returns the objects in the manifests of the command, which are read by the first preview step that
+// needs them. They are read again every time if the preview steps were not created, like in some tests.
+func (o *confirmOptions) readManifests(cmd *cobra.Command) *manifestReader {
+	r := o.manifestReader
+	if r == nil {
+		r = &manifestReader{}
+	}
+	r.once.Do(func() {
+		if o.hasRenderedManifest() {
+			r.rendered, r.source, r.renderedErr = o.renderedObjects(cmd)
+		}
+		if !o.hasAnyNonRegularFiles {
+			r.files = o.readManifestFiles()
+		}
+	})
+	return r
+}
+
+// readManifestFiles returns the objects in the files and directories specified by -f. URLs and stdin are skipped.
+// Files that cannot be read are skipped too, because kubectl reports them when the command is executed.
+func (o *confirmOptions) readManifestFiles() []manifestObject {
+	recursive := o.args != nil && o.args.Has("recursive") && o.args.Value("recursive") != "false"
+	var objects []manifestObject
+	readFile := func(path string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		for _, h := range yaml.ReadHeaders(data) {
+			objects = append(objects, manifestObject{Header: h, source: path})
+		}
+	}
+	for _, f := range o.filenames {
+		if f == "-" || strings.HasPrefix(f, "http://") || strings.HasPrefix(f, "https://") {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			readFile(f)
+			continue
+		}
+		_ = filepath.WalkDir(f, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != f && !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if containsString(manifestExtensions, filepath.Ext(path)) {
+				readFile(path)
+			}
+			return nil
+		})
+	}
+	return objects
+}
+
+// printNamespaceCheck warns about namespaced objects without a namespace, which take the default namespace of the
+// context, and about objects whose namespace does not match --namespace. Nothing is printed if there are none.
+func (o *confirmOptions) printNamespaceCheck(cmd *cobra.Command, objects []manifestObject) {
+	var defaulted, mismatched []string
+	for _, obj := range objects {
+		name := obj.kind() + "/" + obj.Name
+		switch {
+		case !obj.namespaced():
+		case len(obj.Namespace) == 0 && len(o.namespace) == 0:
+			defaulted = append(defaulted, name+" ("+obj.source+")")
+		case len(obj.Namespace) > 0 && len(o.namespace) > 0 && obj.Namespace != o.namespace:
+			mismatched = append(mismatched, name+" in "+obj.Namespace+" ("+obj.source+")")
+		}
+	}
+	if len(defaulted) == 0 && len(mismatched) == 0 {
+		return
+	}
+
+	util.PrintSectionTitle(cmd, "Namespace Check")
+	defer cmd.Println()
+	if len(defaulted) > 0 {
+		cmd.Printf("WARNING: %d object(s) do not specify a namespace, so the default namespace %s of context %s will be used:\n", len(defaulted), o.resolvedNamespace, o.resolvedContext)
+		for _, name := range defaulted {
+			cmd.Printf("  %s\n", name)
+		}
+	}
+	if len(mismatched) > 0 {
+		cmd.Printf("WARNING: %d object(s) specify a namespace that does not match --namespace=%s:\n", len(mismatched), o.namespace)
+		for _, name := range mismatched {
+			cmd.Printf("  %s\n", name)
+		}
+	}
+}
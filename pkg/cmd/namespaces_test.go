@@ -0,0 +1,150 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+func TestReadManifestFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml":        "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+		"b.json":        `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "b", "namespace": "x"}}`,
+		"notes.txt":     "kind: Ignored\n",
+		"sub/c.yml":     "apiVersion: v1\nkind: Secret\nmetadata:\n  name: c\n",
+		"single/d.yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: d\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []manifestObject
+	}{
+		{
+			name: "file, url, and missing file",
+			args: []string{"apply", "-f", filepath.Join(dir, "single/d.yaml"), "-f", "https://example.com/x.yaml", "-f", filepath.Join(dir, "missing.yaml")},
+			expected: []manifestObject{
+				{Header: yaml.Header{APIVersion: "v1", Kind: "Pod", Name: "d"}, source: filepath.Join(dir, "single/d.yaml")},
+			},
+		},
+		{
+			name: "directory",
+			args: []string{"apply", "-f", dir},
+			expected: []manifestObject{
+				{Header: yaml.Header{APIVersion: "v1", Kind: "ConfigMap", Name: "a"}, source: filepath.Join(dir, "a.yaml")},
+				{Header: yaml.Header{APIVersion: "v1", Kind: "Service", Name: "b", Namespace: "x"}, source: filepath.Join(dir, "b.json")},
+			},
+		},
+		{
+			name: "recursive directory",
+			args: []string{"apply", "-R", "-f", dir},
+			expected: []manifestObject{
+				{Header: yaml.Header{APIVersion: "v1", Kind: "ConfigMap", Name: "a"}, source: filepath.Join(dir, "a.yaml")},
+				{Header: yaml.Header{APIVersion: "v1", Kind: "Service", Name: "b", Namespace: "x"}, source: filepath.Join(dir, "b.json")},
+				{Header: yaml.Header{APIVersion: "v1", Kind: "Pod", Name: "d"}, source: filepath.Join(dir, "single/d.yaml")},
+				{Header: yaml.Header{APIVersion: "v1", Kind: "Secret", Name: "c"}, source: filepath.Join(dir, "sub/c.yml")},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := confirmOptions{}
+			o.parseArgs(tc.args)
+			actual := o.readManifestFiles()
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("wrong objects.\nexpected: %+v\ngot: %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPrintNamespaceCheck(t *testing.T) {
+	objects := []manifestObject{
+		{Header: yaml.Header{APIVersion: "v1", Kind: "ConfigMap", Name: "a"}, source: "a.yaml"},
+		{Header: yaml.Header{APIVersion: "apps/v1", Kind: "Deployment", Name: "b", Namespace: "staging"}, source: "b.yaml"},
+		{Header: yaml.Header{APIVersion: "v1", Kind: "Namespace", Name: "c"}, source: "b.yaml"},
+		{Header: yaml.Header{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole", Name: "d"}, source: "b.yaml"},
+		{Header: yaml.Header{APIVersion: "v1", Kind: "Service", Name: "e", Namespace: "prod"}, source: "b.yaml"},
+	}
+	testCases := []struct {
+		name           string
+		options        confirmOptions
+		expectedStdout string
+	}{
+		{
+			name:    "default namespace of the context",
+			options: confirmOptions{resolvedContext: "prod-us", resolvedNamespace: "dev"},
+			expectedStdout: `========== Namespace Check ==
+WARNING: 1 object(s) do not specify a namespace, so the default namespace dev of context prod-us will be used:
+  ConfigMap/a (a.yaml)
+
+`,
+		},
+		{
+			name:    "namespace flag",
+			options: confirmOptions{namespace: "prod", resolvedContext: "prod-us", resolvedNamespace: "prod"},
+			expectedStdout: `========== Namespace Check ==
+WARNING: 1 object(s) specify a namespace that does not match --namespace=prod:
+  Deployment.apps/b in staging (b.yaml)
+
+`,
+		},
+		{
+			name:    "another namespace flag",
+			options: confirmOptions{namespace: "staging", resolvedContext: "prod-us", resolvedNamespace: "staging"},
+			expectedStdout: `========== Namespace Check ==
+WARNING: 1 object(s) specify a namespace that does not match --namespace=staging:
+  Service/e in prod (b.yaml)
+
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, _, stdout, _ := util.NewTestCommand()
+			tc.options.printNamespaceCheck(cmd, objects)
+			if stdout.String() != tc.expectedStdout {
+				t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", tc.expectedStdout, stdout.String())
+			}
+		})
+	}
+
+	// Nothing is printed if every object has the expected namespace
+	cmd, _, stdout, _ := util.NewTestCommand()
+	o := confirmOptions{args: kubeargs.Parse([]string{"apply"}), resolvedNamespace: "dev"}
+	o.printNamespaceCheck(cmd, objects[2:4])
+	if stdout.Len() > 0 {
+		t.Fatalf("expected nothing to be printed, got:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// The API verb that each command needs on the objects it affects. Apply needs create for objects that do not exist
+// yet, and patch for objects that do.
+var permissionVerbs = map[string]string{
+	"annotate": "patch",
+	"apply":    "patch",
+	"cordon":   "patch",
+	"create":   "create",
+	"delete":   "delete",
+	"drain":    "patch",
+	"label":    "patch",
+	"patch":    "patch",
+	"replace":  "update",
+	"rollout":  "patch",
+	"scale":    "patch",
+	"set":      "patch",
+	"taint":    "patch",
+	"uncordon": "patch",
+}
+
+// Commands whose operands are nodes, without a resource type
+var nodeCommands = map[string]bool{
+	"cordon":   true,
+	"drain":    true,
+	"uncordon": true,
+}
+
+// The number of kubectl auth can-i checks that are run at the same time
+const maxConcurrentPermissionChecks = 8
+
+// The subresource that each command changes, if it does not change the object itself
+var permissionSubresources = map[string]string{
+	"scale": "scale",
+}
+
+// permissionDeniedError is returned by the permissions step when the command is not allowed to do everything it needs
+// to do. The command is aborted even if the policy allows previews to fail, because it cannot succeed.
+type permissionDeniedError struct {
+	denied []string
+}
+
+func (e *permissionDeniedError) Error() string {
+	return "not allowed to " + strings.Join(e.denied, ", ")
+}
+
+// permissionCheck is an API verb on a resource, or on an object if name is set, and whether it is allowed
+type permissionCheck struct {
+	verb        string
+	resource    string
+	name        string
+	subresource string
+	// namespace is empty for the default namespace of the context, and * for all namespaces
+	namespace     string
+	clusterScoped bool
+}
+
+// namespaceColumn returns the namespace of the check as it is shown in the permission matrix
+func (c permissionCheck) namespaceColumn() string {
+	switch {
+	case c.clusterScoped:
+		return ""
+	case len(c.namespace) == 0:
+		return "(default)"
+	}
+	return c.namespace
+}
+
+// object returns the resource and name of the check, like deployment.apps/api, and its subresource, if any
+func (c permissionCheck) object() string {
+	s := c.resource
+	if len(c.name) > 0 {
+		s += "/" + c.name
+	}
+	if len(c.subresource) > 0 {
+		s += " (" + c.subresource + ")"
+	}
+	return s
+}
+
+// resourceRef is a resource type, like deploy or deployments.apps, and optionally the name of an object
+type resourceRef struct {
+	resource string
+	name     string
+}
+
+// parseResourceOperands returns the objects named by the operands of a command, as TYPE/NAME, or as TYPE[,TYPE]
+// followed by names. Operands that change labels, annotations, environment variables, images, or taints, like key=value
+// or key-, are skipped. If types are given without names, the command applies to a selector or to all objects, so the
+// types themselves are returned.
+func parseResourceOperands(operands []string, types []string) []resourceRef {
+	var refs []resourceRef
+	named := false
+	for _, op := range operands {
+		if strings.ContainsAny(op, "=:") || strings.HasSuffix(op, "-") {
+			continue
+		}
+		if resource, name, found := strings.Cut(op, "/"); found {
+			refs = append(refs, resourceRef{resource: resource, name: name})
+			continue
+		}
+		if types == nil {
+			types = strings.Split(op, ",")
+			continue
+		}
+		named = true
+		for _, t := range types {
+			refs = append(refs, resourceRef{resource: t, name: op})
+		}
+	}
+	if !named {
+		for _, t := range types {
+			refs = append(refs, resourceRef{resource: t})
+		}
+	}
+	return refs
+}
+
+// hasPermissionChecks returns true if the objects that the command affects, and the verb it needs on them, are known
+func hasPermissionChecks(commandName string, operands []string) bool {
+	if len(permissionVerbs[commandName]) == 0 {
+		return false
+	}
+	return commandName != "rollout" || (len(operands) > 0 && rolloutPreviewCommands[operands[0]])
+}
+
+// permissionChecks returns the checks of the verb that the command needs on each object it affects, from its manifests
+// or its operands
+func (o *confirmOptions) permissionChecks(cmd *cobra.Command, commandName string) ([]permissionCheck, error) {
+	verb := permissionVerbs[commandName]
+	subresource := permissionSubresources[commandName]
+	if len(o.filenames) > 0 || len(o.kustomize) > 0 {
+		objects, err := o.manifestObjects(cmd)
+		if err != nil {
+			return nil, err
+		}
+		var checks []permissionCheck
+		for _, obj := range objects {
+			check := permissionCheck{verb: verb, resource: strings.ToLower(obj.kind()), name: obj.Name, subresource: subresource, namespace: obj.Namespace}
+			if !obj.namespaced() {
+				check.namespace, check.clusterScoped = "", true
+			} else if len(check.namespace) == 0 {
+				check.namespace = o.namespace
+			}
+			checks = append(checks, check)
+		}
+		if commandName == "apply" {
+			return o.applyPermissionChecks(cmd, objects, checks), nil
+		}
+		return checks, nil
+	}
+
+	operands := o.args.Operands()
+	var types []string
+	switch {
+	case nodeCommands[commandName]:
+		types = []string{"nodes"}
+	case (commandName == "rollout" || commandName == "set") && len(operands) > 0:
+		operands = operands[1:]
+	}
+	namespace := o.namespace
+	if o.args.Has("all-namespaces") && o.args.Value("all-namespaces") != "false" {
+		namespace = "*"
+	}
+	clusterScoped := commandName == "taint" || nodeCommands[commandName]
+	if clusterScoped {
+		namespace = ""
+	}
+	var checks []permissionCheck
+	for _, ref := range parseResourceOperands(operands, types) {
+		checks = append(checks, permissionCheck{verb: verb, resource: ref.resource, name: ref.name, subresource: subresource, namespace: namespace, clusterScoped: clusterScoped})
+	}
+	return checks, nil
+}
+
+// manifestObjects returns the objects in the manifests of the command. Manifests that cannot be read without consuming
+// them, like URLs, are skipped.
+func (o *confirmOptions) manifestObjects(cmd *cobra.Command) ([]manifestObject, error) {
+	m := o.readManifests(cmd)
+	if m.renderedErr != nil {
+		return nil, m.renderedErr
+	}
+	return append(append([]manifestObject{}, m.rendered...), m.files...), nil
+}
+
+// applyPermissionChecks changes the checks of the manifest objects of apply to create for objects that do not exist
+// yet. If it cannot be determined whether the objects exist, for example because their kind is created by the same
+// manifest, both create and patch are checked.
+func (o *confirmOptions) applyPermissionChecks(cmd *cobra.Command, objects []manifestObject, checks []permissionCheck) []permissionCheck {
+	objs := make([]map[string]interface{}, 0, len(objects))
+	for i, obj := range objects {
+		metadata := map[string]interface{}{"name": obj.Name}
+		if len(checks[i].namespace) > 0 {
+			metadata["namespace"] = checks[i].namespace
+		}
+		objs = append(objs, map[string]interface{}{"apiVersion": obj.APIVersion, "kind": obj.Kind, "metadata": metadata})
+	}
+	live, err := o.getLiveObjects(cmd, objs)
+	result := make([]permissionCheck, 0, len(checks))
+	for i, c := range checks {
+		if err != nil {
+			create := c
+			create.verb = "create"
+			result = append(result, create, c)
+			continue
+		}
+		if !liveObjectExists(live, objs[i]) {
+			c.verb = "create"
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// liveObjectExists returns true if obj is one of the live objects. An object without a namespace is in the default
+// namespace of the context, which is not known here, so it matches a live object in any namespace.
+func liveObjectExists(live map[string]map[string]interface{}, obj map[string]interface{}) bool {
+	name := util.NestedString(obj, "metadata", "name")
+	for _, l := range live {
+		if util.NestedString(l, "kind") == util.NestedString(obj, "kind") &&
+			util.ObjectGroup(l) == util.ObjectGroup(obj) &&
+			util.NestedString(l, "metadata", "name") == name &&
+			(len(util.NestedString(obj, "metadata", "namespace")) == 0 || util.NestedString(l, "metadata", "namespace") == util.NestedString(obj, "metadata", "namespace")) {
+			return true
+		}
+	}
+	return false
+}
+
+// canI returns true if the check is allowed, using kubectl auth can-i with the same global flags as the command, so
+// that impersonation with --as is respected. It does not read stdin, which may be the manifest of the command, so that
+// checks can run concurrently.
+func (o *confirmOptions) canI(cmd *cobra.Command, c permissionCheck) (bool, error) {
+	resource := c.resource
+	if len(c.name) > 0 {
+		resource += "/" + c.name
+	}
+	args := []string{"auth", "can-i", c.verb, resource}
+	if len(c.subresource) > 0 {
+		args = append(args, "--subresource="+c.subresource)
+	}
+	if c.namespace == "*" {
+		args = append(args, "--all-namespaces")
+	} else if len(c.namespace) > 0 {
+		args = append(args, "--namespace="+c.namespace)
+	}
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	err := o.runKubectl(cmd.Context(), append(args, o.globalFlags()...), nil, &stdout, &stderr)
+	// can-i exits with an error when the answer is no, so the answer is checked first
+	answer := strings.TrimSpace(stdout.String())
+	switch {
+	case strings.HasPrefix(answer, "yes"):
+		return true, nil
+	case strings.HasPrefix(answer, "no"):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("%s", stderr.String())
+	}
+	return false, fmt.Errorf("unexpected response from kubectl auth can-i: %q", answer)
+}
+
+// canIAll runs the checks concurrently, at most maxConcurrentPermissionChecks at a time, and returns whether each of
+// them is allowed. If any check fails, the error of the first one that failed, in the order of the checks, is returned.
+func (o *confirmOptions) canIAll(cmd *cobra.Command, checks []permissionCheck) ([]bool, error) {
+	allowed := make([]bool, len(checks))
+	errs := make([]error, len(checks))
+	slots := make(chan struct{}, maxConcurrentPermissionChecks)
+	done := make(chan struct{}, len(checks))
+	for i, c := range checks {
+		slots <- struct{}{}
+		go func(i int, c permissionCheck) {
+			allowed[i], errs[i] = o.canI(cmd, c)
+			<-slots
+			done <- struct{}{}
+		}(i, c)
+	}
+	for range checks {
+		<-done
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return allowed, nil
+}
+
+// printPermissions checks that the user is allowed to do what the command needs on each object it affects, and shows
+// the result as a matrix of objects and verbs. It fails if anything is not allowed, so that commands that would fail,
+// or only partially apply, are not confirmed. The checks are run concurrently, because there is one for each object
+// and verb.
+func (o *confirmOptions) printPermissions(cmd *cobra.Command, commandName string) error {
+	checks, err := o.permissionChecks(cmd, commandName)
+	if err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	util.PrintSectionTitle(cmd, "Permissions")
+	defer cmd.Println()
+
+	// Each row is an object in a namespace, and each column is a verb
+	type row struct {
+		object    string
+		namespace string
+	}
+	var rows []row
+	var verbs []string
+	results := map[row]map[string]string{}
+	var unique []permissionCheck
+	objectWidth, namespaceWidth := len("OBJECT"), len("NAMESPACE")
+	for _, c := range checks {
+		r := row{object: c.object(), namespace: c.namespaceColumn()}
+		if results[r] == nil {
+			rows = append(rows, r)
+			results[r] = map[string]string{}
+			objectWidth = max(objectWidth, len(r.object))
+			namespaceWidth = max(namespaceWidth, len(r.namespace))
+		}
+		if !containsString(verbs, c.verb) {
+			verbs = append(verbs, c.verb)
+		}
+		if _, found := results[r][c.verb]; found {
+			continue
+		}
+		results[r][c.verb] = ""
+		unique = append(unique, c)
+	}
+
+	allowed, err := o.canIAll(cmd, unique)
+	if err != nil {
+		return err
+	}
+	var denied []string
+	for i, c := range unique {
+		r := row{object: c.object(), namespace: c.namespaceColumn()}
+		results[r][c.verb] = "no"
+		if allowed[i] {
+			results[r][c.verb] = "yes"
+		} else {
+			denied = append(denied, c.verb+" "+c.object())
+		}
+	}
+
+	header := fmt.Sprintf("%-*s  %-*s", objectWidth, "OBJECT", namespaceWidth, "NAMESPACE")
+	for _, v := range verbs {
+		header += fmt.Sprintf("  %-6s", strings.ToUpper(v))
+	}
+	cmd.Println(strings.TrimRight(header, " "))
+	for _, r := range rows {
+		line := fmt.Sprintf("%-*s  %-*s", objectWidth, r.object, namespaceWidth, r.namespace)
+		for _, v := range verbs {
+			result, found := results[r][v]
+			if !found {
+				result = "-"
+			}
+			line += fmt.Sprintf("  %-6s", result)
+		}
+		cmd.Println(strings.TrimRight(line, " "))
+	}
+
+	if len(denied) > 0 {
+		return &permissionDeniedError{denied: denied}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestParseResourceOperands(t *testing.T) {
+	testCases := []struct {
+		name     string
+		operands []string
+		types    []string
+		expected []resourceRef
+	}{
+		{
+			name:     "type and names",
+			operands: []string{"pod", "a", "b"},
+			expected: []resourceRef{{resource: "pod", name: "a"}, {resource: "pod", name: "b"}},
+		},
+		{
+			name:     "type/name",
+			operands: []string{"deploy/a", "svc/b"},
+			expected: []resourceRef{{resource: "deploy", name: "a"}, {resource: "svc", name: "b"}},
+		},
+		{
+			name:     "types without names",
+			operands: []string{"pods,services"},
+			expected: []resourceRef{{resource: "pods"}, {resource: "services"}},
+		},
+		{
+			name:     "labels",
+			operands: []string{"pods", "a", "env=prod", "tier-"},
+			expected: []resourceRef{{resource: "pods", name: "a"}},
+		},
+		{
+			name:     "taint",
+			operands: []string{"nodes", "node-1", "dedicated=special:NoSchedule"},
+			expected: []resourceRef{{resource: "nodes", name: "node-1"}},
+		},
+		{
+			name:     "implicit type",
+			operands: []string{"node-1", "node-2"},
+			types:    []string{"nodes"},
+			expected: []resourceRef{{resource: "nodes", name: "node-1"}, {resource: "nodes", name: "node-2"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := parseResourceOperands(tc.operands, tc.types); !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHasPermissionChecks(t *testing.T) {
+	testCases := []struct {
+		commandName string
+		operands    []string
+		expected    bool
+	}{
+		{commandName: "delete", operands: []string{"pod", "a"}, expected: true},
+		{commandName: "rollout", operands: []string{"restart", "deploy/a"}, expected: true},
+		{commandName: "rollout", operands: []string{"status", "deploy/a"}, expected: false},
+		{commandName: "exec", operands: []string{"a"}, expected: false},
+	}
+	for _, tc := range testCases {
+		if actual := hasPermissionChecks(tc.commandName, tc.operands); actual != tc.expected {
+			t.Fatalf("hasPermissionChecks(%q, %v): expected %t, got %t", tc.commandName, tc.operands, tc.expected, actual)
+		}
+	}
+}
+
+func TestPermissionChecks(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.yaml")
+	content := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: x\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: x\n"
+	if err := os.WriteFile(manifest, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		liveJSON string
+		liveErr  error
+		expected []permissionCheck
+	}{
+		{
+			name: "delete with namespace",
+			args: []string{"delete", "pod", "a", "-n", "x"},
+			expected: []permissionCheck{
+				{verb: "delete", resource: "pod", name: "a", namespace: "x"},
+			},
+		},
+		{
+			name: "scale in all namespaces",
+			args: []string{"scale", "deploy", "--all", "-A", "--replicas=0"},
+			expected: []permissionCheck{
+				{verb: "patch", resource: "deploy", subresource: "scale", namespace: "*"},
+			},
+		},
+		{
+			name: "set image",
+			args: []string{"set", "image", "deploy/api", "app=app:2"},
+			expected: []permissionCheck{
+				{verb: "patch", resource: "deploy", name: "api"},
+			},
+		},
+		{
+			name: "cordon",
+			args: []string{"cordon", "node-1"},
+			expected: []permissionCheck{
+				{verb: "patch", resource: "nodes", name: "node-1", clusterScoped: true},
+			},
+		},
+		{
+			name: "delete manifest",
+			args: []string{"delete", "-f", manifest, "-n", "y"},
+			expected: []permissionCheck{
+				{verb: "delete", resource: "deployment.apps", name: "api", namespace: "y"},
+				{verb: "delete", resource: "configmap", name: "settings", namespace: "x"},
+				{verb: "delete", resource: "namespace", name: "x", clusterScoped: true},
+			},
+		},
+		{
+			name:     "apply manifest",
+			args:     []string{"apply", "-f", manifest},
+			liveJSON: `{"kind": "List", "items": [{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api", "namespace": "default"}}]}`,
+			expected: []permissionCheck{
+				{verb: "patch", resource: "deployment.apps", name: "api"},
+				{verb: "create", resource: "configmap", name: "settings", namespace: "x"},
+				{verb: "create", resource: "namespace", name: "x", clusterScoped: true},
+			},
+		},
+		{
+			name:    "apply manifest when the live objects are unknown",
+			args:    []string{"apply", "-f", manifest},
+			liveErr: errors.New("the server doesn't have a resource type"),
+			expected: []permissionCheck{
+				{verb: "create", resource: "deployment.apps", name: "api"},
+				{verb: "patch", resource: "deployment.apps", name: "api"},
+				{verb: "create", resource: "configmap", name: "settings", namespace: "x"},
+				{verb: "patch", resource: "configmap", name: "settings", namespace: "x"},
+				{verb: "create", resource: "namespace", name: "x", clusterScoped: true},
+				{verb: "patch", resource: "namespace", name: "x", clusterScoped: true},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			for i := 0; i < 3; i++ {
+				fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), tc.liveJSON, "", tc.liveErr)
+			}
+			o := &confirmOptions{}
+			o.parseArgs(tc.args)
+			cmd, _, _, _ := util.NewTestCommand()
+			actual, err := o.permissionChecks(cmd, o.args.Verb())
+			if err != nil {
+				t.Fatalf("permissionChecks failed: %v", err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCanI(t *testing.T) {
+	testCases := []struct {
+		name          string
+		check         permissionCheck
+		stdout        string
+		stderr        string
+		err           error
+		expectedArgs  []string
+		expected      bool
+		expectedError string
+	}{
+		{
+			name:         "yes",
+			check:        permissionCheck{verb: "patch", resource: "deploy", name: "api", subresource: "scale", namespace: "x"},
+			stdout:       "yes\n",
+			expectedArgs: []string{"auth", "can-i", "patch", "deploy/api", "--subresource=scale", "--namespace=x", "--context=ctx", "--as=jane"},
+			expected:     true,
+		},
+		{
+			name:         "no",
+			check:        permissionCheck{verb: "delete", resource: "pods", namespace: "*"},
+			stdout:       "no\n",
+			err:          errors.New("exit status 1"),
+			expectedArgs: []string{"auth", "can-i", "delete", "pods", "--all-namespaces", "--context=ctx", "--as=jane"},
+		},
+		{
+			name:          "error",
+			check:         permissionCheck{verb: "delete", resource: "pods"},
+			stderr:        "error: You must be logged in to the server (Unauthorized)\n",
+			err:           errors.New("exit status 1"),
+			expectedArgs:  []string{"auth", "can-i", "delete", "pods", "--context=ctx", "--as=jane"},
+			expectedError: "error: You must be logged in to the server (Unauthorized)\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun(tc.stdout, tc.stderr, tc.err)
+			o := &confirmOptions{}
+			o.parseArgs([]string{"delete", "pods", "--context=ctx", "--as=jane"})
+			cmd, _, _, _ := util.NewTestCommand()
+			allowed, err := o.canI(cmd, tc.check)
+			if len(tc.expectedError) > 0 {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("canI failed: %v", err)
+			}
+			if allowed != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, allowed)
+			}
+			if !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), tc.expectedArgs) {
+				t.Fatalf("wrong args.\nexpected: %v\ngot: %v", tc.expectedArgs, fakeExecRunner.LastRunArgs())
+			}
+		})
+	}
+}
+
+func TestPrintPermissions(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("pod/a"), "yes\n", "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("pod/b"), "no\n", "", errors.New("exit status 1"))
+	o := &confirmOptions{}
+	o.parseArgs([]string{"delete", "pod", "a", "b", "-n", "x"})
+	cmd, _, stdout, _ := util.NewTestCommand()
+	err := o.printPermissions(cmd, "delete")
+	var permissionDenied *permissionDeniedError
+	if !errors.As(err, &permissionDenied) || err.Error() != "not allowed to delete pod/b" {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+	expected := `========== Permissions ======
+OBJECT  NAMESPACE  DELETE
+pod/a   x          yes
+pod/b   x          no
+
+`
+	if stdout.String() != expected {
+		t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+
+	o = &confirmOptions{}
+	o.parseArgs([]string{"delete", "-f", "https://example.com/x.yaml"})
+	cmd, _, stdout, _ = util.NewTestCommand()
+	if err := o.printPermissions(cmd, "delete"); err != nil || stdout.Len() > 0 {
+		t.Fatalf("expected nothing to be checked, got %v:\n%s", err, stdout.String())
+	}
+}
+
+func TestCanIAll(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	checks := make([]permissionCheck, 0, 3*maxConcurrentPermissionChecks)
+	for i := 0; i < cap(checks); i++ {
+		checks = append(checks, permissionCheck{verb: "delete", resource: "pods", name: strconv.Itoa(i)})
+		fakeExecRunner.SetupRunWithAction(func(args []string) error {
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	o := &confirmOptions{}
+	o.parseArgs([]string{"delete", "pods"})
+	cmd, _, _, _ := util.NewTestCommand()
+	// The fake runs have no output, so every check fails, and the error of the first one is returned
+	_, err := o.canIAll(cmd, checks)
+	if err == nil || err.Error() != `unexpected response from kubectl auth can-i: ""` {
+		t.Fatalf("expected the error of the first check, got %v", err)
+	}
+	if fakeExecRunner.RunCount() != len(checks) {
+		t.Fatalf("expected %d checks to be run, got %d", len(checks), fakeExecRunner.RunCount())
+	}
+	if maxRunning < 2 || maxRunning > maxConcurrentPermissionChecks {
+		t.Fatalf("expected between 2 and %d checks to run at the same time, got %d", maxConcurrentPermissionChecks, maxRunning)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// Commands that need kubectl confirm itself, because they open an editor or are not kubectl commands
+var unembeddableCommands = map[string]bool{
+	"edit":     true,
+	"help":     true,
+	"rollback": true,
+	"version":  true,
+}
+
+// Preview is a kubectl command that was previewed the same way as by kubectl confirm, which can be executed once it is
+// confirmed. It is the basis of the confirm package, which lets other tools embed the confirmation. A Preview must
+// be executed or aborted, which removes its temp files.
+type Preview struct {
+	options     *confirmOptions
+	commandName string
+	errOut      io.Writer
+}
+
+// PreviewOptions control how NewPreview previews a command, and how the preview executes it
+type PreviewOptions struct {
+	// Stdin is the manifest of commands that use -f -
+	Stdin io.Reader
+	// ErrOut is where warnings, like the errors of preview steps, are printed. If it is nil, they are discarded.
+	ErrOut io.Writer
+	// Runner runs kubectl. If it is nil, kubectl is run as a process.
+	Runner util.ExecRunner
+	// Signals interrupt the preview, the prompt, and the command, like os.Interrupt. If there are none, no signal
+	// handlers are installed, and they are only interrupted when the context is cancelled.
+	Signals []os.Signal
+}
+
+// PreviewObject is an object that the command affects, as shown in the Dry Run and Diff sections
+type PreviewObject struct {
+	// Name is the kind and name of the object, like deployment.apps/foo
+	Name      string
+	Namespace string
+	// Action is what the command does to the object, as kubectl prints it, like created, configured, or deleted
+	Action string
+	// Diff is the unified diff of the object as it is now and as it will be, with sensitive values masked. It is
+	// empty if the object does not change, or if it is deleted.
+	Diff string
+}
+
+// NewPreview previews a kubectl command, given its args without kubectl itself, and keeps what would be shown by
+// kubectl confirm as its report. Commands that need kubectl confirm itself, like edit and rollback, and commands that
+// run in several contexts or namespaces, cannot be previewed.
+func NewPreview(ctx context.Context, args []string, opts PreviewOptions) (*Preview, error) {
+	o := &confirmOptions{embedded: true, execRunner: opts.Runner, embeddedSignals: opts.Signals}
+	o.parseArgs(args)
+	commandName := o.args.Verb()
+	switch {
+	case len(commandName) == 0:
+		return nil, fmt.Errorf("expected at least one argument")
+	case unembeddableCommands[commandName]:
+		return nil, fmt.Errorf("%s is only supported by kubectl confirm", commandName)
+	case len(o.contexts) > 0 || len(o.namespaces) > 0 || len(o.namespaceSelector) > 0:
+		return nil, fmt.Errorf("--contexts, --confirm-namespaces, and --confirm-namespace-selector are only supported by kubectl confirm")
+	}
+
+	p, err := loadPolicy()
+	if err != nil {
+		return nil, err
+	}
+	o.policy = p
+	if err := o.parseVerifyTimeout(); err != nil {
+		return nil, err
+	}
+
+	o.checkForNonRegularFiles()
+	if containsString(o.filenames, "-") && opts.Stdin != nil {
+		if o.stdinManifest, err = io.ReadAll(opts.Stdin); err != nil {
+			return nil, err
+		}
+	}
+
+	preview := &Preview{options: o, commandName: commandName, errOut: opts.ErrOut}
+	cmd := preview.command(ctx, io.Discard)
+	cmd.SetIn(opts.Stdin)
+	err = o.previewCommand(cmd, commandName)
+	o.stopReport(cmd)
+	if err != nil {
+		o.cleanup()
+		return nil, err
+	}
+	return preview, nil
+}
+
+// command returns a command that prints to out and to the errOut of the preview
+func (p *Preview) command(ctx context.Context, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.SetContext(ctx)
+	cmd.SetOut(out)
+	cmd.SetErr(p.errOut)
+	if p.errOut == nil {
+		cmd.SetErr(io.Discard)
+	}
+	return cmd
+}
+
+// Args returns the args of the kubectl command that is executed when the preview is confirmed
+func (p *Preview) Args() []string {
+	return p.options.args.Raw()
+}
+
+// Context returns the context, cluster, user, and namespace that the command targets, as shown in the Config section
+func (p *Preview) Context() (kubeContext, cluster, user, namespace string) {
+	o := p.options
+	return o.resolvedContext, o.resolvedCluster, o.resolvedUser, o.resolvedNamespace
+}
+
+// Report returns the sections that kubectl confirm would show before the prompt, with sensitive values masked
+func (p *Preview) Report() string {
+	if p.options.report == nil {
+		return ""
+	}
+	return p.options.report.String()
+}
+
+// Objects returns the objects that the command affects, in the order they are shown in the report. They are known for
+// commands that have a diff, like apply, and for delete.
+func (p *Preview) Objects() []PreviewObject {
+	o := p.options
+	verb := o.args.Verb()
+	r := o.policy.redactor()
+	objects := make([]PreviewObject, 0, len(o.preview)+len(o.deletedObjects))
+	for _, obj := range o.preview {
+		objects = append(objects, PreviewObject{
+			Name:      util.ObjectName(obj.merged),
+			Namespace: util.NestedString(obj.merged, "metadata", "namespace"),
+			Action:    obj.action(verb),
+			Diff:      obj.diff(r),
+		})
+	}
+	for _, obj := range o.deletedObjects {
+		objects = append(objects, PreviewObject{
+			Name:      util.ObjectName(obj),
+			Namespace: util.NestedString(obj, "metadata", "namespace"),
+			Action:    "deleted",
+		})
+	}
+	return objects
+}
+
+// Warnings returns the warnings returned by the server dry run
+func (p *Preview) Warnings() []string {
+	return p.options.warnings
+}
+
+// FailedSteps returns the preview steps that failed, when the policy allows confirming the command anyway, like
+// "dry run: dry run did not finish within 1m0s"
+func (p *Preview) FailedSteps() []string {
+	var failed []string
+	for _, f := range p.options.failedSteps {
+		failed = append(failed, f.name+": "+strings.TrimSpace(f.err.Error()))
+	}
+	return failed
+}
+
+// PolicyChallenges returns the messages of the policy rules that require a stronger confirmation of the command
+func (p *Preview) PolicyChallenges() []string {
+	return p.options.policyChallenges
+}
+
+// ExpectedResponse returns the response that confirms the command, which is yes, or the name of the context if any
+// preview steps failed or a policy rule requires it
+func (p *Preview) ExpectedResponse() string {
+	return p.options.expectedResponse()
+}
+
+// Prompt shows the command that will be executed and asks the user to confirm it, the same way as kubectl confirm. It
+// returns true if the user entered the expected response.
+func (p *Preview) Prompt(ctx context.Context, in io.Reader, out io.Writer) (bool, error) {
+	cmd := p.command(ctx, out)
+	cmd.SetIn(in)
+	return p.options.prompt(cmd, p.Args())
+}
+
+// Execute executes the confirmed command, with the output of kubectl written to stdout and stderr, and records it in
+// the history, along with the report. Its result is verified if --confirm-verify was specified.
+func (p *Preview) Execute(ctx context.Context, stdout, stderr io.Writer) error {
+	defer p.options.cleanup()
+	cmd := p.command(ctx, stdout)
+	cmd.SetErr(stderr)
+	return p.options.executeAndRecord(cmd, p.commandName, p.Args())
+}
+
+// Abort records the command in the history as aborted, without executing it
+func (p *Preview) Abort(ctx context.Context) {
+	defer p.options.cleanup()
+	p.options.recordAborted(p.command(ctx, io.Discard), p.commandName, p.Args())
+}
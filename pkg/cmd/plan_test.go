@@ -0,0 +1,107 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestPreview(t *testing.T) {
+	dir := useTestHistoryDir(t)
+	t.Setenv("KUBECTL_CONFIRM_POLICY", filepath.Join(t.TempDir(), "missing.json"))
+	const manifest = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n  namespace: x\n"
+
+	// Both the dry run and the command itself must get the manifest from stdin
+	var stdins []string
+	run := func(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		joined := strings.Join(args, " ")
+		if strings.HasPrefix(joined, "apply") && stdin != nil {
+			data, err := io.ReadAll(stdin)
+			if err != nil {
+				return err
+			}
+			stdins = append(stdins, string(data))
+		}
+		switch {
+		case strings.HasPrefix(joined, "config view"):
+			_, _ = io.WriteString(stdout, `{"current-context": "prod", "contexts": [{"name": "prod", "context": {}}]}`)
+		case strings.Contains(joined, "--dry-run=server"):
+			_, _ = io.WriteString(stdout, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "x"}}`)
+		case strings.Contains(joined, "can-i"):
+			_, _ = io.WriteString(stdout, "yes\n")
+		case strings.HasPrefix(joined, "apply"):
+			_, _ = io.WriteString(stderr, "error: connection refused\n")
+			return errors.New("exit status 1")
+		}
+		return nil
+	}
+
+	// No signal handlers are installed, because the tool that embeds the preview did not pass any signals
+	defer func() { notifyContext = signal.NotifyContext }()
+	notifyContext = func(ctx context.Context, signals ...os.Signal) (context.Context, context.CancelFunc) {
+		t.Fatalf("expected no signal handlers, got %v", signals)
+		return ctx, func() {}
+	}
+	// Fake runs would be used instead of the runner if it were not passed to the preview
+	util.NewFakeExecRunner()
+
+	ctx := context.Background()
+	preview, err := NewPreview(ctx, []string{"apply", "-f", "-"}, PreviewOptions{Stdin: strings.NewReader(manifest), Runner: run})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedObjects := []PreviewObject{{
+		Name:      "configmap/foo",
+		Namespace: "x",
+		Action:    "created",
+		Diff:      "--- live/v1.ConfigMap.x.foo\n+++ merged/v1.ConfigMap.x.foo\n@@ -0,0 +1,5 @@\n+apiVersion: v1\n+kind: ConfigMap\n+metadata:\n+  name: foo\n+  namespace: x\n",
+	}}
+	if !reflect.DeepEqual(preview.Objects(), expectedObjects) {
+		t.Fatalf("wrong objects.\nexpected: %+v\ngot: %+v", expectedObjects, preview.Objects())
+	}
+	if !strings.Contains(preview.Report(), "configmap/foo created (server dry run)") {
+		t.Fatalf("expected the dry run in the report, got:\n%s", preview.Report())
+	}
+	stderr := &strings.Builder{}
+	if err := preview.Execute(ctx, io.Discard, stderr); err == nil {
+		t.Fatal("expected the error of kubectl")
+	}
+	if !strings.Contains(stderr.String(), "error: connection refused") {
+		t.Fatalf("expected the stderr of kubectl, got:\n%s", stderr.String())
+	}
+	if len(stdins) != 2 || stdins[0] != manifest || stdins[1] != manifest {
+		t.Fatalf("expected the manifest to be passed to the dry run and the command, got %q", stdins)
+	}
+	cmd, _, _, _ := util.NewTestCommand()
+	records, err := listChangeRecords(cmd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Result != changeResultFailed || records[0].Context != "prod" {
+		t.Fatalf("expected the failed command to be recorded, got %+v", records)
+	}
+}
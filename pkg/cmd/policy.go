@@ -0,0 +1,442 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// policy controls what the plugin allows. It is loaded from the JSON file named by the KUBECTL_CONFIRM_POLICY
+// environment variable, or from ~/.kube/confirm-policy.json if that is not set. If the file does not exist, there are
+// no restrictions.
+type policy struct {
+	// PreviewFailure is what happens when a preview step fails: abort (the default), or warn, which shows the preview
+	// as unavailable and lets the user confirm the command anyway
+	PreviewFailure string `json:"previewFailure"`
+	// Timeouts are the durations that preview steps are allowed to take, like 30s, by step name. The default timeout
+	// applies to steps that are not listed.
+	Timeouts map[string]string `json:"timeouts"`
+	// Redactions mask sensitive values in addition to the values of Secrets, which are always masked
+	Redactions []redactionRule `json:"redactions"`
+	// ImageRegistries are glob patterns of the registries that container images are allowed to come from, like
+	// *.dkr.ecr.us-east-1.amazonaws.com. Images from other registries are flagged. Images without a registry come from
+	// docker.io.
+	ImageRegistries []string `json:"imageRegistries"`
+	// RolloutMinAvailable is the percentage of the pods of a workload that must stay available while its pods are
+	// replaced. Rollouts that may have fewer available pods are flagged.
+	RolloutMinAvailable int `json:"rolloutMinAvailable"`
+	// SnapshotSecrets saves Secrets, including their data, in the snapshots that changes are rolled back to. Secrets
+	// are left out of snapshots by default, so that their data is not written to disk.
+	SnapshotSecrets bool         `json:"snapshotSecrets"`
+	Rules           []policyRule `json:"rules"`
+
+	timeouts map[string]time.Duration
+}
+
+// policyRule applies its action to commands that match all of its criteria. Criteria that are not set match
+// everything. Contexts and namespaces are glob patterns, like prod-*. GitOpsManaged matches commands that do or do not
+// affect objects managed by a GitOps controller. Warnings are regular expressions, like (?i)deprecated, which match
+// commands whose server dry run returns a matching warning.
+type policyRule struct {
+	Verbs         []string          `json:"verbs"`
+	Contexts      []string          `json:"contexts"`
+	Namespaces    []string          `json:"namespaces"`
+	PodLabels     map[string]string `json:"podLabels"`
+	GitOpsManaged *bool             `json:"gitOpsManaged"`
+	Warnings      []string          `json:"warnings"`
+	Action        string            `json:"action"`
+	Message       string            `json:"message"`
+
+	warnings []*regexp.Regexp
+}
+
+// Policy rule actions
+const (
+	policyActionDeny = "deny"
+	// The user must enter the name of the context instead of yes to confirm the command
+	policyActionChallenge = "challenge"
+)
+
+// Preview failure modes
+const (
+	previewFailureAbort = "abort"
+	previewFailureWarn  = "warn"
+)
+
+// The key of the timeout that applies to steps without their own timeout
+const defaultTimeoutKey = "default"
+
+// policyInput describes the command being confirmed, for matching against policy rules
+type policyInput struct {
+	verb      string
+	context   string
+	namespace string
+	// objectNamespaces are the namespaces of the objects affected by the command, which are matched instead of the
+	// namespace of the command if the objects are known, even if none of them are namespaced
+	objectNamespaces []string
+	podLabels        map[string]string
+	// gitOpsManaged is true if the command affects objects managed by a GitOps controller
+	gitOpsManaged bool
+	// warnings are the warnings returned by the server dry run
+	warnings []string
+}
+
+// newPolicyInput describes the command being confirmed, using the config resolved by printConfig, the pod resolved
+// by the target summary, if any, and the objects found by the preview
+func (o *confirmOptions) newPolicyInput(verb string) policyInput {
+	input := policyInput{
+		verb:          verb,
+		context:       o.resolvedContext,
+		namespace:     o.resolvedNamespace,
+		gitOpsManaged: len(o.gitOpsManagedObjects()) > 0,
+		warnings:      o.warnings,
+	}
+	input.objectNamespaces = o.affectedNamespaces(input.namespace)
+	if o.targetPod != nil {
+		input.namespace = util.NestedString(o.targetPod, "metadata", "namespace")
+		input.objectNamespaces = nil
+		input.podLabels = map[string]string{}
+		for k, v := range util.NestedMap(o.targetPod, "metadata", "labels") {
+			input.podLabels[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return input
+}
+
+// affectedNamespaces returns the namespaces of the objects affected by the command that the preview knows, from the
+// server dry run, the rollout preview, and the manifests of the command, so that an object cannot escape a rule by
+// setting its own namespace. Objects in a manifest without a namespace are in the namespace of the command. It
+// returns nil if no objects are known.
+func (o *confirmOptions) affectedNamespaces(commandNamespace string) []string {
+	namespaces := []string{}
+	known := false
+	add := func(namespace string) {
+		if !containsString(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	objs := o.liveObjects()
+	for _, p := range o.preview {
+		objs = append(objs, p.merged)
+	}
+	for _, obj := range objs {
+		if obj == nil {
+			continue
+		}
+		known = true
+		if namespace := util.NestedString(obj, "metadata", "namespace"); len(namespace) > 0 {
+			add(namespace)
+		}
+	}
+	for _, m := range o.manifests {
+		known = true
+		if len(m.Namespace) > 0 {
+			add(m.Namespace)
+		} else if m.namespaced() {
+			add(commandNamespace)
+		}
+	}
+	if !known {
+		return nil
+	}
+	return namespaces
+}
+
+// namespaces returns the namespaces that rules are matched against
+func (input policyInput) namespaces() []string {
+	if input.objectNamespaces != nil {
+		return input.objectNamespaces
+	}
+	return []string{input.namespace}
+}
+
+// describeNamespaces returns the namespaces of the command, for the default messages of rules
+func (input policyInput) describeNamespaces() string {
+	namespaces := input.namespaces()
+	if len(namespaces) == 1 {
+		return fmt.Sprintf("namespace %q", namespaces[0])
+	}
+	quoted := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		quoted = append(quoted, strconv.Quote(namespace))
+	}
+	return "namespaces " + strings.Join(quoted, ", ")
+}
+
+func getPolicyPath() string {
+	if policyPath, found := os.LookupEnv("KUBECTL_CONFIRM_POLICY"); found {
+		return policyPath
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "confirm-policy.json")
+}
+
+func loadPolicy() (*policy, error) {
+	p := &policy{}
+	policyPath := getPolicyPath()
+	if len(policyPath) == 0 {
+		return p, nil
+	}
+	data, err := os.ReadFile(policyPath)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", policyPath, err)
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Action != policyActionDeny && r.Action != policyActionChallenge {
+			return nil, fmt.Errorf("invalid policy %s: unknown action %q", policyPath, r.Action)
+		}
+		for _, w := range r.Warnings {
+			re, err := regexp.Compile(w)
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy %s: invalid warnings %q: %v", policyPath, w, err)
+			}
+			r.warnings = append(r.warnings, re)
+		}
+	}
+	if p.RolloutMinAvailable < 0 || p.RolloutMinAvailable > 100 {
+		return nil, fmt.Errorf("invalid policy %s: rolloutMinAvailable must be a percentage from 0 to 100", policyPath)
+	}
+	if p.PreviewFailure != "" && p.PreviewFailure != previewFailureAbort && p.PreviewFailure != previewFailureWarn {
+		return nil, fmt.Errorf("invalid policy %s: unknown preview failure mode %q", policyPath, p.PreviewFailure)
+	}
+	p.timeouts = map[string]time.Duration{}
+	for name, value := range p.Timeouts {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid policy %s: invalid timeout %q for %s", policyPath, value, name)
+		}
+		p.timeouts[name] = timeout
+	}
+	for i := range p.Redactions {
+		if err := p.Redactions[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid policy %s: %v", policyPath, err)
+		}
+	}
+	return p, nil
+}
+
+// redactor returns the redactor that masks sensitive values in everything that is printed or recorded
+func (p *policy) redactor() *redactor {
+	if p == nil {
+		return newRedactor(nil)
+	}
+	return newRedactor(p.Redactions)
+}
+
+// stepTimeout returns the time the named preview step is allowed to take
+func (p *policy) stepTimeout(name string) time.Duration {
+	if p == nil {
+		return defaultStepTimeout
+	}
+	if timeout, found := p.timeouts[name]; found {
+		return timeout
+	}
+	if timeout, found := p.timeouts[defaultTimeoutKey]; found {
+		return timeout
+	}
+	return defaultStepTimeout
+}
+
+// warnOnPreviewFailure returns true if the user can confirm the command when a preview step fails
+func (p *policy) warnOnPreviewFailure() bool {
+	return p != nil && p.PreviewFailure == previewFailureWarn
+}
+
+// snapshotSecrets returns true if Secrets are saved in snapshots
+func (p *policy) snapshotSecrets() bool {
+	return p != nil && p.SnapshotSecrets
+}
+
+// checkPolicy returns an error if the command is denied by a policy rule, or if the rules cannot be checked because
+// the config or target could not be resolved, or because the dry run or rollout preview that a rule needs failed. The
+// messages of the challenge rules that match the command are recorded in policyChallenges.
+func (o *confirmOptions) checkPolicy(verb string) error {
+	if o.policy == nil || len(o.policy.Rules) == 0 {
+		return nil
+	}
+	for _, name := range []string{"config", "target"} {
+		if o.hasFailedStep(name) {
+			return fmt.Errorf("cannot check the policy, because the %s preview is unavailable", name)
+		}
+	}
+	for _, name := range []string{"dry run", "rollout"} {
+		if !o.hasFailedStep(name) {
+			continue
+		}
+		for _, r := range o.policy.Rules {
+			if r.needsPreview(name, o.manifestsRead()) {
+				return fmt.Errorf("cannot check the policy, because the %s preview is unavailable", name)
+			}
+		}
+	}
+	input := o.newPolicyInput(verb)
+	if err := o.policy.check(input); err != nil {
+		return err
+	}
+	o.policyChallenges = o.policy.challenges(input)
+	return nil
+}
+
+// check returns an error if the command is denied by a policy rule
+func (p *policy) check(input policyInput) error {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.Rules {
+		if r.matches(input) && r.Action == policyActionDeny {
+			message := r.Message
+			if len(message) == 0 {
+				message = fmt.Sprintf("%s is not allowed in context %q, %s", input.verb, input.context, input.describeNamespaces())
+			}
+			return fmt.Errorf("denied by policy: %s", message)
+		}
+	}
+	return nil
+}
+
+// challenges returns the messages of the challenge rules that match the command
+func (p *policy) challenges(input policyInput) []string {
+	if p == nil {
+		return nil
+	}
+	var messages []string
+	for _, r := range p.Rules {
+		if r.matches(input) && r.Action == policyActionChallenge {
+			message := r.Message
+			if len(message) == 0 {
+				message = fmt.Sprintf("%s requires additional confirmation in context %q, %s", input.verb, input.context, input.describeNamespaces())
+			}
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// needsPreview returns true if the rule cannot be checked without the named preview step. The dry run finds the
+// warnings, and the dry run or rollout preview finds the objects, which tell whether they are managed by GitOps, and
+// which namespaces they are in if the manifests of the command could not be read.
+func (r *policyRule) needsPreview(step string, manifestsRead bool) bool {
+	switch {
+	case r.GitOpsManaged != nil:
+		return true
+	case step == "dry run":
+		return len(r.Warnings) > 0 || (len(r.Namespaces) > 0 && !manifestsRead)
+	}
+	return false
+}
+
+// manifestsRead returns true if every manifest of the command was read by the config preview, so that the namespaces
+// of its objects are known without the dry run. Manifests from URLs and non-regular files are not read.
+func (o *confirmOptions) manifestsRead() bool {
+	if o.hasAnyNonRegularFiles {
+		return false
+	}
+	for _, f := range o.filenames {
+		if strings.HasPrefix(f, "http://") || strings.HasPrefix(f, "https://") || (f == "-" && o.stdinManifest == nil) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *policyRule) matches(input policyInput) bool {
+	if len(r.Verbs) > 0 && !containsString(r.Verbs, input.verb) {
+		return false
+	}
+	if len(r.Contexts) > 0 && !matchesAnyPattern(r.Contexts, input.context) {
+		return false
+	}
+	if len(r.Namespaces) > 0 && !matchesAnyNamespace(r.Namespaces, input.namespaces()) {
+		return false
+	}
+	if r.GitOpsManaged != nil && *r.GitOpsManaged != input.gitOpsManaged {
+		return false
+	}
+	if len(r.Warnings) > 0 && !matchesAnyWarning(r.warnings, input.warnings) {
+		return false
+	}
+	if len(r.PodLabels) > 0 {
+		if input.podLabels == nil {
+			return false
+		}
+		for k, v := range r.PodLabels {
+			if labelValue, found := input.podLabels[k]; !found || labelValue != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesAnyWarning(patterns []*regexp.Regexp, warnings []string) bool {
+	for _, pattern := range patterns {
+		for _, w := range warnings {
+			if pattern.MatchString(w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesAnyNamespace returns true if any of the namespaces matches any of the patterns
+func matchesAnyNamespace(patterns []string, namespaces []string) bool {
+	for _, namespace := range namespaces {
+		if matchesAnyPattern(patterns, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, s); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
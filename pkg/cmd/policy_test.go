@@ -0,0 +1,456 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	defer os.Unsetenv("KUBECTL_CONFIRM_POLICY")
+
+	_ = os.Setenv("KUBECTL_CONFIRM_POLICY", filepath.Join(dir, "missing.json"))
+	p, err := loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy failed: %v", err)
+	}
+	if len(p.Rules) != 0 {
+		t.Fatalf("expected no rules when the policy file does not exist, got %v", p.Rules)
+	}
+
+	policyPath := filepath.Join(dir, "policy.json")
+	_ = os.Setenv("KUBECTL_CONFIRM_POLICY", policyPath)
+	_ = os.WriteFile(policyPath, []byte(`{"rules": [{"verbs": ["exec"], "contexts": ["prod-*"], "action": "deny"}]}`), 0600)
+	p, err = loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy failed: %v", err)
+	}
+	if len(p.Rules) != 1 || p.Rules[0].Verbs[0] != "exec" || p.Rules[0].Contexts[0] != "prod-*" {
+		t.Fatalf("wrong rules: %v", p.Rules)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"rules": [{"gitOpsManaged": true, "action": "challenge"}]}`), 0600)
+	p, err = loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy failed: %v", err)
+	}
+	if len(p.Rules) != 1 || p.Rules[0].GitOpsManaged == nil || !*p.Rules[0].GitOpsManaged || p.Rules[0].Action != policyActionChallenge {
+		t.Fatalf("wrong rules: %v", p.Rules)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"rules": [{"warnings": ["(?i)deprecated"], "action": "deny"}]}`), 0600)
+	p, err = loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy failed: %v", err)
+	}
+	if err := p.check(policyInput{verb: "apply", warnings: []string{"apps/v1beta1 Deployment is Deprecated"}}); err == nil {
+		t.Fatalf("expected a command with a deprecation warning to be denied")
+	}
+	if err := p.check(policyInput{verb: "apply"}); err != nil {
+		t.Fatalf("expected a command without warnings to be allowed, got %v", err)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"rules": [{"warnings": ["("], "action": "deny"}]}`), 0600)
+	if _, err := loadPolicy(); err == nil || !strings.Contains(err.Error(), `invalid warnings "("`) {
+		t.Fatalf("expected invalid warnings error, got %v", err)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"rules": [{"action": "explode"}]}`), 0600)
+	if _, err := loadPolicy(); err == nil || !strings.Contains(err.Error(), `unknown action "explode"`) {
+		t.Fatalf("expected unknown action error, got %v", err)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{`), 0600)
+	if _, err := loadPolicy(); err == nil {
+		t.Fatalf("expected an error for invalid JSON")
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"previewFailure": "warn", "timeouts": {"default": "10s", "dry run": "2m"}}`), 0600)
+	p, err = loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy failed: %v", err)
+	}
+	if !p.warnOnPreviewFailure() {
+		t.Fatalf("expected previews to be allowed to fail")
+	}
+	if p.stepTimeout("dry run") != 2*time.Minute || p.stepTimeout("config") != 10*time.Second {
+		t.Fatalf("wrong timeouts: %v", p.timeouts)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"previewFailure": "ignore"}`), 0600)
+	if _, err := loadPolicy(); err == nil || !strings.Contains(err.Error(), `unknown preview failure mode "ignore"`) {
+		t.Fatalf("expected unknown preview failure mode error, got %v", err)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"redactions": [{"kinds": ["ConfigMap"], "paths": [".data.password"], "keys": "(?i)token"}]}`), 0600)
+	p, err = loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy failed: %v", err)
+	}
+	if len(p.Redactions) != 1 || len(p.Redactions[0].paths) != 1 || p.Redactions[0].keys == nil {
+		t.Fatalf("wrong redactions: %v", p.Redactions)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"redactions": [{"paths": ["data"]}]}`), 0600)
+	if _, err := loadPolicy(); err == nil || !strings.Contains(err.Error(), `invalid path "data"`) {
+		t.Fatalf("expected invalid path error, got %v", err)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"imageRegistries": ["registry.example.com"], "rolloutMinAvailable": 75}`), 0600)
+	p, err = loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy failed: %v", err)
+	}
+	if len(p.ImageRegistries) != 1 || p.RolloutMinAvailable != 75 {
+		t.Fatalf("wrong image registries or rollout minimum: %v, %d", p.ImageRegistries, p.RolloutMinAvailable)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"rolloutMinAvailable": 150}`), 0600)
+	if _, err := loadPolicy(); err == nil || !strings.Contains(err.Error(), "rolloutMinAvailable must be a percentage") {
+		t.Fatalf("expected invalid rolloutMinAvailable error, got %v", err)
+	}
+
+	_ = os.WriteFile(policyPath, []byte(`{"timeouts": {"config": "soon"}}`), 0600)
+	if _, err := loadPolicy(); err == nil || !strings.Contains(err.Error(), `invalid timeout "soon" for config`) {
+		t.Fatalf("expected invalid timeout error, got %v", err)
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	var p *policy
+	if p.stepTimeout("config") != defaultStepTimeout {
+		t.Fatalf("expected the default timeout without a policy")
+	}
+	if p.warnOnPreviewFailure() {
+		t.Fatalf("expected previews to abort on failure without a policy")
+	}
+	p = &policy{timeouts: map[string]time.Duration{"target": time.Second}}
+	if p.stepTimeout("target") != time.Second || p.stepTimeout("config") != defaultStepTimeout {
+		t.Fatalf("wrong timeouts: %v", p.timeouts)
+	}
+}
+
+func TestCheckPolicyWithFailedSteps(t *testing.T) {
+	o := &confirmOptions{
+		policy:      &policy{Rules: []policyRule{{Verbs: []string{"delete"}, Contexts: []string{"prod-*"}, Action: policyActionDeny}}},
+		failedSteps: []stepFailure{{name: "config", err: fmt.Errorf("timed out")}},
+	}
+	if err := o.checkPolicy("delete"); err == nil || err.Error() != "cannot check the policy, because the config preview is unavailable" {
+		t.Fatalf("expected the policy check to fail, got %v", err)
+	}
+	o.policy = &policy{}
+	if err := o.checkPolicy("delete"); err != nil {
+		t.Fatalf("expected no error without rules, got %v", err)
+	}
+
+	o = &confirmOptions{
+		policy:      &policy{Rules: []policyRule{{Warnings: []string{"deprecated"}, Action: policyActionDeny}}},
+		failedSteps: []stepFailure{{name: "dry run", err: fmt.Errorf("timed out")}},
+	}
+	if err := o.checkPolicy("apply"); err == nil || err.Error() != "cannot check the policy, because the dry run preview is unavailable" {
+		t.Fatalf("expected the policy check to fail, got %v", err)
+	}
+
+	// Whether the objects are managed by GitOps is unknown if they could not be determined
+	managed := true
+	for _, name := range []string{"dry run", "rollout"} {
+		o = &confirmOptions{
+			policy:      &policy{Rules: []policyRule{{GitOpsManaged: &managed, Action: policyActionDeny}}},
+			failedSteps: []stepFailure{{name: name, err: fmt.Errorf("timed out")}},
+		}
+		expected := "cannot check the policy, because the " + name + " preview is unavailable"
+		if err := o.checkPolicy("apply"); err == nil || err.Error() != expected {
+			t.Fatalf("expected error %q, got %v", expected, err)
+		}
+	}
+	o = &confirmOptions{
+		policy:      &policy{Rules: []policyRule{{Warnings: []string{"deprecated"}, Action: policyActionDeny}}},
+		failedSteps: []stepFailure{{name: "rollout", err: fmt.Errorf("timed out")}},
+	}
+	if err := o.checkPolicy("rollout"); err != nil {
+		t.Fatalf("expected warning rules to be checked when only the rollout preview failed, got %v", err)
+	}
+}
+
+func TestCheckPolicyNamespacesWithFailedDryRun(t *testing.T) {
+	testCases := []struct {
+		name          string
+		filenames     []string
+		expectedError string
+	}{
+		{
+			name: "no manifests",
+		},
+		{
+			name:      "manifests that were read",
+			filenames: []string{"x.yaml"},
+		},
+		{
+			name:          "manifest from a URL",
+			filenames:     []string{"https://example.com/x.yaml"},
+			expectedError: "cannot check the policy, because the dry run preview is unavailable",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &confirmOptions{
+				policy:            &policy{Rules: []policyRule{{Namespaces: []string{"prod"}, Action: policyActionDeny}}},
+				filenames:         tc.filenames,
+				resolvedNamespace: "default",
+				failedSteps:       []stepFailure{{name: "dry run", err: fmt.Errorf("timed out")}},
+			}
+			err := o.checkPolicy("apply")
+			if len(tc.expectedError) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tc.expectedError) > 0 && (err == nil || err.Error() != tc.expectedError) {
+				t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := &policy{
+		Rules: []policyRule{
+			{
+				Verbs:     []string{"exec", "cp"},
+				Contexts:  []string{"prod-*"},
+				PodLabels: map[string]string{"env": "production"},
+				Action:    policyActionDeny,
+				Message:   "no exec into production pods",
+			},
+			{
+				Verbs:      []string{"debug"},
+				Namespaces: []string{"kube-system"},
+				Action:     policyActionDeny,
+			},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		input         policyInput
+		expectedError string
+	}{
+		{
+			name:          "matching verb, context, and labels is denied",
+			input:         policyInput{verb: "exec", context: "prod-us", namespace: "foo", podLabels: map[string]string{"env": "production", "app": "foo"}},
+			expectedError: "denied by policy: no exec into production pods",
+		},
+		{
+			name:  "different labels are allowed",
+			input: policyInput{verb: "exec", context: "prod-us", namespace: "foo", podLabels: map[string]string{"env": "staging"}},
+		},
+		{
+			name:  "no pod is allowed when the rule requires pod labels",
+			input: policyInput{verb: "exec", context: "prod-us", namespace: "foo"},
+		},
+		{
+			name:  "different context is allowed",
+			input: policyInput{verb: "cp", context: "dev", namespace: "foo", podLabels: map[string]string{"env": "production"}},
+		},
+		{
+			name:  "different verb is allowed",
+			input: policyInput{verb: "port-forward", context: "prod-us", namespace: "foo", podLabels: map[string]string{"env": "production"}},
+		},
+		{
+			name:          "default message",
+			input:         policyInput{verb: "debug", context: "dev", namespace: "kube-system"},
+			expectedError: `denied by policy: debug is not allowed in context "dev", namespace "kube-system"`,
+		},
+		{
+			name:          "namespace of an affected object is denied",
+			input:         policyInput{verb: "debug", context: "dev", namespace: "default", objectNamespaces: []string{"foo", "kube-system"}},
+			expectedError: `denied by policy: debug is not allowed in context "dev", namespaces "foo", "kube-system"`,
+		},
+		{
+			name:  "namespaces of the affected objects are matched instead of the namespace of the command",
+			input: policyInput{verb: "debug", context: "dev", namespace: "kube-system", objectNamespaces: []string{"foo"}},
+		},
+		{
+			name:  "cluster scoped objects are not in any namespace",
+			input: policyInput{verb: "debug", context: "dev", namespace: "kube-system", objectNamespaces: []string{}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.check(tc.input)
+			if len(tc.expectedError) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tc.expectedError) > 0 && (err == nil || err.Error() != tc.expectedError) {
+				t.Fatalf("wrong error. expected: %q, got: %v", tc.expectedError, err)
+			}
+		})
+	}
+
+	var nilPolicy *policy
+	if err := nilPolicy.check(policyInput{verb: "exec"}); err != nil {
+		t.Fatalf("expected a nil policy to allow everything, got %v", err)
+	}
+}
+
+func TestAffectedNamespaces(t *testing.T) {
+	testCases := []struct {
+		name     string
+		options  *confirmOptions
+		expected []string
+	}{
+		{
+			name:    "no objects",
+			options: &confirmOptions{},
+		},
+		{
+			name: "dry run objects",
+			options: &confirmOptions{preview: []previewObject{
+				{merged: decodeTestObject(t, `{"kind": "ConfigMap", "metadata": {"name": "a", "namespace": "prod"}}`)},
+				{merged: decodeTestObject(t, `{"kind": "ClusterRole", "metadata": {"name": "b"}}`)},
+			}},
+			expected: []string{"prod"},
+		},
+		{
+			name:     "cluster scoped objects",
+			options:  &confirmOptions{deletedObjects: []map[string]interface{}{decodeTestObject(t, `{"kind": "Namespace", "metadata": {"name": "prod"}}`)}},
+			expected: []string{},
+		},
+		{
+			name: "manifest objects",
+			options: &confirmOptions{manifests: []manifestObject{
+				{Header: yaml.Header{Kind: "ConfigMap", Name: "a", Namespace: "prod"}},
+				{Header: yaml.Header{Kind: "ConfigMap", Name: "b"}},
+				{Header: yaml.Header{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole", Name: "c"}},
+			}},
+			expected: []string{"prod", "default"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.options.affectedNamespaces("default"); !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("wrong namespaces.\nexpected: %#v\ngot: %#v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckPolicyObjectNamespace(t *testing.T) {
+	// The namespace of the context is default, but the manifest puts the object in prod
+	o := &confirmOptions{
+		policy:            &policy{Rules: []policyRule{{Namespaces: []string{"prod"}, Action: policyActionDeny}}},
+		resolvedContext:   "dev",
+		resolvedNamespace: "default",
+		manifests:         []manifestObject{{Header: yaml.Header{APIVersion: "v1", Kind: "ConfigMap", Name: "a", Namespace: "prod"}}},
+	}
+	expected := `denied by policy: apply is not allowed in context "dev", namespace "prod"`
+	if err := o.checkPolicy("apply"); err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestCheckPolicyDeleteGitOpsManaged(t *testing.T) {
+	managed := true
+	deleted := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "x", "namespace": "prod", "labels": map[string]interface{}{"kustomize.toolkit.fluxcd.io/name": "apps"}},
+	}
+	testCases := []struct {
+		action             string
+		expectedError      string
+		expectedChallenges []string
+	}{
+		{
+			action:        policyActionDeny,
+			expectedError: "denied by policy: the objects are managed by GitOps",
+		},
+		{
+			action:             policyActionChallenge,
+			expectedChallenges: []string{"the objects are managed by GitOps"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.action, func(t *testing.T) {
+			o := &confirmOptions{
+				policy:            &policy{Rules: []policyRule{{GitOpsManaged: &managed, Action: tc.action, Message: "the objects are managed by GitOps"}}},
+				resolvedContext:   "prod",
+				resolvedNamespace: "prod",
+				deletedObjects:    []map[string]interface{}{deleted},
+			}
+			err := o.checkPolicy("delete")
+			if len(tc.expectedError) > 0 {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(o.policyChallenges, tc.expectedChallenges) {
+				t.Fatalf("expected challenges %q, got %q, %v", tc.expectedChallenges, o.policyChallenges, err)
+			}
+		})
+	}
+}
+
+func TestPolicyChallenges(t *testing.T) {
+	managed := true
+	p := &policy{
+		Rules: []policyRule{
+			{Contexts: []string{"prod-*"}, GitOpsManaged: &managed, Action: policyActionChallenge, Message: "the objects are managed by GitOps"},
+			{Verbs: []string{"delete"}, Contexts: []string{"prod-*"}, Action: policyActionChallenge},
+		},
+	}
+	testCases := []struct {
+		name     string
+		input    policyInput
+		expected []string
+	}{
+		{
+			name:     "gitops managed",
+			input:    policyInput{verb: "apply", context: "prod-us", namespace: "foo", gitOpsManaged: true},
+			expected: []string{"the objects are managed by GitOps"},
+		},
+		{
+			name:  "not gitops managed",
+			input: policyInput{verb: "apply", context: "prod-us", namespace: "foo"},
+		},
+		{
+			name:     "default message",
+			input:    policyInput{verb: "delete", context: "prod-us", namespace: "foo"},
+			expected: []string{`delete requires additional confirmation in context "prod-us", namespace "foo"`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := p.check(tc.input); err != nil {
+				t.Fatalf("expected challenge rules not to deny, got %v", err)
+			}
+			actual := p.challenges(tc.input)
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Fatalf("wrong challenges.\nexpected: %q\ngot: %q", tc.expected, actual)
+			}
+		})
+	}
+}
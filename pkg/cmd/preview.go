@@ -0,0 +1,220 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+// What kubectl prints for each object affected by a command, for example "deployment.apps/foo scaled"
+var dryRunActions = map[string]string{
+	"annotate":  "annotated",
+	"apply":     "configured",
+	"autoscale": "autoscaled",
+	"create":    "created",
+	"expose":    "exposed",
+	"label":     "labeled",
+	"patch":     "patched",
+	"replace":   "replaced",
+	"run":       "created",
+	"scale":     "scaled",
+	"set":       "updated",
+	"taint":     "tainted",
+}
+
+// previewObject is an object affected by the command, as it is now and as it will be after the command is executed
+type previewObject struct {
+	// live is nil if the object does not exist yet
+	live   map[string]interface{}
+	merged map[string]interface{}
+}
+
+// previewChanges shows the Dry Run and Diff sections for the command, and the Images, Rollout Risk, and Field Managers
+// sections if the command changes any container images, pod templates, or managers of fields
+func (o *confirmOptions) previewChanges(cmd *cobra.Command) error {
+	verb := o.args.Verb()
+
+	// Server dry run, which is only sent once because the dry run and diff sections share its result
+	if diffCommands[verb] && !o.hasAnyNonRegularFiles {
+		if err := o.serverDryRun(cmd); err != nil {
+			return err
+		}
+	}
+
+	// The objects deleted by the command, which are saved before it is executed
+	if verb == "delete" && !o.hasAnyNonRegularFiles {
+		if err := o.getDeletedObjects(cmd); err != nil {
+			return err
+		}
+	}
+
+	// Dry Run
+	if dryRunCommands[verb] {
+		if err := o.dryRun(cmd); err != nil {
+			return err
+		}
+	}
+
+	// Diff
+	if diffCommands[verb] {
+		if err := o.diff(cmd); err != nil {
+			return err
+		}
+		o.printImages(cmd)
+		o.printRolloutRisk(cmd)
+		o.printFieldManagers(cmd)
+	}
+	return nil
+}
+
+// serverDryRun sends the command to the server once with --dry-run=server, and gets the live objects that it affects.
+// The result is used by both the dry run and diff sections, so they are consistent with each other. Managed fields are
+// included, so that changes of field managers can be shown.
+func (o *confirmOptions) serverDryRun(cmd *cobra.Command) error {
+	var result map[string]interface{}
+	warnings, err := util.ExecKubectlJSONWithWarnings(cmd.Context(), o.runner(), o.args.With("--dry-run=server", "--output=json", "--show-managed-fields"), o.manifestInput(cmd), &result)
+	if err != nil {
+		return err
+	}
+	o.addWarnings(warnings)
+	merged := util.ObjectItems(result)
+
+	live, err := o.getLiveObjects(cmd, merged)
+	if err != nil {
+		return err
+	}
+
+	o.preview = make([]previewObject, 0, len(merged))
+	for _, obj := range merged {
+		o.preview = append(o.preview, previewObject{live: live[objectKey(obj)], merged: obj})
+	}
+	return nil
+}
+
+// getLiveObjects gets the current state of objs, using one request per namespace, and returns them by objectKey
+func (o *confirmOptions) getLiveObjects(cmd *cobra.Command, objs []map[string]interface{}) (map[string]map[string]interface{}, error) {
+	resourcesByNamespace := map[string][]string{}
+	for _, obj := range objs {
+		namespace := util.NestedString(obj, "metadata", "namespace")
+		resourcesByNamespace[namespace] = append(resourcesByNamespace[namespace], qualifiedResourceName(obj))
+	}
+	namespaces := make([]string, 0, len(resourcesByNamespace))
+	for namespace := range resourcesByNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	live := map[string]map[string]interface{}{}
+	for _, namespace := range namespaces {
+		args := append([]string{"get"}, resourcesByNamespace[namespace]...)
+		args = append(args, "--ignore-not-found", "-o", "json", "--show-managed-fields")
+		if len(namespace) > 0 {
+			args = append(args, "--namespace="+namespace)
+		}
+		var result map[string]interface{}
+		if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), append(args, o.globalFlags()...), cmd.InOrStdin(), &result); err != nil {
+			return nil, err
+		}
+		for _, obj := range util.ObjectItems(result) {
+			live[objectKey(obj)] = obj
+		}
+	}
+	return live, nil
+}
+
+// summary returns the line kubectl would print for the object when the command is executed
+func (p previewObject) summary(verb string) string {
+	return util.ObjectName(p.merged) + " " + p.action(verb) + " (server dry run)"
+}
+
+// action returns what the command does to the object, like configured, or unchanged if apply does not change it
+func (p previewObject) action(verb string) string {
+	action := dryRunActions[verb]
+	if p.live == nil {
+		action = "created"
+	} else if !p.changed() {
+		if verb == "apply" {
+			action = "unchanged"
+		} else {
+			action += " (no change)"
+		}
+	}
+	return action
+}
+
+// changed returns true if the command changes the object
+func (p previewObject) changed() bool {
+	return !reflect.DeepEqual(withoutManagedFields(p.live), withoutManagedFields(p.merged))
+}
+
+// diff returns a unified diff of the live and merged objects, with their sensitive values masked by r
+func (p previewObject) diff(r *redactor) string {
+	live, merged := r.redactPair(withoutManagedFields(p.live), withoutManagedFields(p.merged))
+	liveYaml := ""
+	if live != nil {
+		liveYaml = yaml.Marshal(live)
+	}
+	name := diffObjectName(p.merged)
+	return util.UnifiedDiff("live/"+name, "merged/"+name, liveYaml, yaml.Marshal(merged))
+}
+
+// withoutManagedFields returns a copy of obj without its managed fields, which are not shown because they are noisy
+func withoutManagedFields(obj map[string]interface{}) map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+	obj = copyObject(obj)
+	delete(util.NestedMap(obj, "metadata"), "managedFields")
+	return obj
+}
+
+// objectKey identifies an object regardless of the API version it was returned in
+func objectKey(obj map[string]interface{}) string {
+	return strings.Join([]string{
+		util.ObjectGroup(obj),
+		util.NestedString(obj, "kind"),
+		util.NestedString(obj, "metadata", "namespace"),
+		util.NestedString(obj, "metadata", "name"),
+	}, "/")
+}
+
+// qualifiedResourceName returns the name of obj in a form that kubectl get resolves to the same API version, for
+// example deployment.v1.apps/foo
+func qualifiedResourceName(obj map[string]interface{}) string {
+	group := util.ObjectGroup(obj)
+	if len(group) == 0 {
+		return util.ObjectName(obj)
+	}
+	version := strings.TrimPrefix(util.NestedString(obj, "apiVersion"), group+"/")
+	return strings.ToLower(util.NestedString(obj, "kind")) + "." + version + "." + group + "/" + util.NestedString(obj, "metadata", "name")
+}
+
+// diffObjectName returns the name kubectl diff uses for obj, for example apps.v1.Deployment.default.foo
+func diffObjectName(obj map[string]interface{}) string {
+	parts := []string{strings.ReplaceAll(util.NestedString(obj, "apiVersion"), "/", "."), util.NestedString(obj, "kind")}
+	if namespace := util.NestedString(obj, "metadata", "namespace"); len(namespace) > 0 {
+		parts = append(parts, namespace)
+	}
+	return strings.Join(append(parts, util.NestedString(obj, "metadata", "name")), ".")
+}
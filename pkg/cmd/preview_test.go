@@ -0,0 +1,114 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestServerDryRun(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRun(`{"kind": "List", "items": [
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "foo", "namespace": "bar"}, "spec": {"replicas": 3}},
+		{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "foo", "namespace": "bar"}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "baz"}},
+		{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "baz"}}
+	]}`, "", nil)
+	fakeExecRunner.SetupRun("", "", nil)
+	fakeExecRunner.SetupRun(`{"kind": "List", "items": [
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "foo", "namespace": "bar"}, "spec": {"replicas": 1}},
+		{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "foo", "namespace": "bar"}}
+	]}`, "", nil)
+	fakeExecRunner.SetupRun(`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "baz"}}`, "", nil)
+
+	o := confirmOptions{}
+	o.parseArgs([]string{"--context=ctx", "apply", "-f", "foo.yaml"})
+	cmd, _, _, _ := util.NewTestCommand()
+	if err := o.serverDryRun(cmd); err != nil {
+		t.Fatalf("serverDryRun failed: %v", err)
+	}
+
+	expectedArgs := [][]string{
+		{"--context=ctx", "apply", "-f", "foo.yaml", "--dry-run=server", "--output=json", "--show-managed-fields"},
+		{"get", "namespace/baz", "--ignore-not-found", "-o", "json", "--show-managed-fields", "--context=ctx"},
+		{"get", "deployment.v1.apps/foo", "service/foo", "--ignore-not-found", "-o", "json", "--show-managed-fields", "--namespace=bar", "--context=ctx"},
+		{"get", "configmap/foo", "--ignore-not-found", "-o", "json", "--show-managed-fields", "--namespace=baz", "--context=ctx"},
+	}
+	if !reflect.DeepEqual(fakeExecRunner.RunArgs, expectedArgs) {
+		t.Fatalf("wrong kubectl args.\nexpected: %v\ngot: %v\n", expectedArgs, fakeExecRunner.RunArgs)
+	}
+
+	expectedSummaries := []string{
+		"deployment.apps/foo configured (server dry run)",
+		"service/foo unchanged (server dry run)",
+		"configmap/foo unchanged (server dry run)",
+		"namespace/baz created (server dry run)",
+	}
+	if len(o.preview) != len(expectedSummaries) {
+		t.Fatalf("expected %d objects, got %d", len(expectedSummaries), len(o.preview))
+	}
+	for i, p := range o.preview {
+		if actual := p.summary("apply"); actual != expectedSummaries[i] {
+			t.Fatalf("wrong summary. expected: %q, got: %q", expectedSummaries[i], actual)
+		}
+	}
+}
+
+func TestServerDryRunError(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRun("", "admission webhook denied the request\n", fmt.Errorf("exit status 1"))
+
+	o := confirmOptions{}
+	o.parseArgs([]string{"apply", "-f", "foo.yaml"})
+	cmd, _, _, _ := util.NewTestCommand()
+	err := o.serverDryRun(cmd)
+	if err == nil || err.Error() != "admission webhook denied the request" {
+		t.Fatalf("expected the dry run error, got %v", err)
+	}
+	if fakeExecRunner.RunCount() != 1 {
+		t.Fatalf("expected the live objects not to be fetched")
+	}
+}
+
+func TestPreviewSummary(t *testing.T) {
+	live := map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": "foo"}, "spec": map[string]interface{}{"replicas": 1.0}}
+	scaled := copyObject(live)
+	scaled["spec"] = map[string]interface{}{"replicas": 3.0}
+
+	testCases := []struct {
+		verb     string
+		object   previewObject
+		expected string
+	}{
+		{verb: "scale", object: previewObject{live: live, merged: scaled}, expected: "deployment.apps/foo scaled (server dry run)"},
+		{verb: "scale", object: previewObject{live: live, merged: live}, expected: "deployment.apps/foo scaled (no change) (server dry run)"},
+		{verb: "create", object: previewObject{merged: live}, expected: "deployment.apps/foo created (server dry run)"},
+		{verb: "apply", object: previewObject{live: live, merged: live}, expected: "deployment.apps/foo unchanged (server dry run)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if actual := tc.object.summary(tc.verb); actual != tc.expected {
+				t.Fatalf("wrong summary. expected: %q, got: %q", tc.expected, actual)
+			}
+		})
+	}
+}
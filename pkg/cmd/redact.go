@@ -0,0 +1,384 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// redactionRule masks values in objects of the listed kinds, or in objects of any kind if no kinds are listed. Kinds
+// are written as Kind for the core API group, or Kind.group for other groups, like SealedSecret.bitnami.com. Paths
+// are JSONPath expressions, like .data or .spec.containers[*].env[*].value. If a path selects a map or a list, each of
+// its values is masked. Keys is a regular expression that masks the values of fields with matching names anywhere in
+// the object, like (?i)password.
+type redactionRule struct {
+	Kinds []string `json:"kinds"`
+	Paths []string `json:"paths"`
+	Keys  string   `json:"keys"`
+
+	paths [][]string
+	keys  *regexp.Regexp
+}
+
+// The values of Secrets are always masked, like kubectl diff does
+var secretRedactionRule = redactionRule{Kinds: []string{"Secret"}, Paths: []string{".data", ".stringData"}}
+
+// Flags whose values are credentials, or the data of a Secret or ConfigMap created by kubectl create, which are masked
+// when the command is printed or recorded
+var sensitiveFlags = []string{"docker-password", "from-env-file", "from-literal", "password", "token"}
+
+// The wildcard path element, which matches every key of a map or element of a list
+const pathWildcard = "*"
+
+// compile parses the paths and keys of the rule
+func (r *redactionRule) compile() error {
+	r.paths = nil
+	for _, p := range r.Paths {
+		elements, err := parsePath(p)
+		if err != nil {
+			return err
+		}
+		r.paths = append(r.paths, elements)
+	}
+	r.keys = nil
+	if len(r.Keys) > 0 {
+		keys, err := regexp.Compile(r.Keys)
+		if err != nil {
+			return fmt.Errorf("invalid keys %q: %v", r.Keys, err)
+		}
+		r.keys = keys
+	}
+	return nil
+}
+
+// appliesTo returns true if the rule applies to obj
+func (r *redactionRule) appliesTo(obj map[string]interface{}) bool {
+	if len(r.Kinds) == 0 {
+		return true
+	}
+	for _, k := range r.Kinds {
+		kind, group, _ := strings.Cut(k, ".")
+		if strings.EqualFold(kind, util.NestedString(obj, "kind")) && group == util.ObjectGroup(obj) {
+			return true
+		}
+	}
+	return false
+}
+
+// locate returns the locations of the values in obj that the rule masks. A location is a list of map keys and list
+// indexes.
+func (r *redactionRule) locate(obj map[string]interface{}) [][]interface{} {
+	var locations [][]interface{}
+	for _, p := range r.paths {
+		locatePath(obj, p, nil, &locations)
+	}
+	if r.keys != nil {
+		locateKeys(obj, r.keys, nil, &locations)
+	}
+	return locations
+}
+
+// parsePath parses a JSONPath expression into a list of map keys, list indexes, and wildcards. Only child and
+// wildcard selectors are supported, with or without the surrounding braces.
+func parsePath(p string) ([]string, error) {
+	s := strings.TrimSuffix(strings.TrimPrefix(p, "{"), "}")
+	if !strings.HasPrefix(s, ".") && !strings.HasPrefix(s, "[") {
+		return nil, fmt.Errorf("invalid path %q: must start with . or [", p)
+	}
+	var elements []string
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			end := strings.IndexAny(s[1:], ".[") + 1
+			if end == 0 {
+				end = len(s)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("invalid path %q: empty field name", p)
+			}
+			elements = append(elements, s[1:end])
+			s = s[end:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", p)
+			}
+			element := s[1:end]
+			if unquoted, err := strconv.Unquote(strings.ReplaceAll(element, "'", "\"")); err == nil {
+				element = unquoted
+			} else if _, err := strconv.Atoi(element); err != nil && element != pathWildcard {
+				return nil, fmt.Errorf("invalid path %q: %s is not an index, a wildcard, or a quoted name", p, s[:end+1])
+			}
+			elements = append(elements, element)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q", p)
+		}
+	}
+	return elements, nil
+}
+
+func locatePath(v interface{}, path []string, location []interface{}, locations *[][]interface{}) {
+	if len(path) == 0 {
+		// Each value of a map or list is masked separately, so that it is clear which ones changed
+		switch value := v.(type) {
+		case map[string]interface{}:
+			for k := range value {
+				*locations = append(*locations, appendLocation(location, k))
+			}
+		case []interface{}:
+			for i := range value {
+				*locations = append(*locations, appendLocation(location, i))
+			}
+		default:
+			*locations = append(*locations, location)
+		}
+		return
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if path[0] == pathWildcard || path[0] == k {
+				locatePath(child, path[1:], appendLocation(location, k), locations)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			if path[0] == pathWildcard || path[0] == strconv.Itoa(i) {
+				locatePath(child, path[1:], appendLocation(location, i), locations)
+			}
+		}
+	}
+}
+
+func locateKeys(v interface{}, keys *regexp.Regexp, location []interface{}, locations *[][]interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if keys.MatchString(k) {
+				*locations = append(*locations, appendLocation(location, k))
+			} else {
+				locateKeys(child, keys, appendLocation(location, k), locations)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			locateKeys(child, keys, appendLocation(location, i), locations)
+		}
+	}
+}
+
+// appendLocation returns a new location, so that locations never share their backing arrays
+func appendLocation(location []interface{}, element interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(location)+1), location...), element)
+}
+
+// redactor masks sensitive values in objects before they are printed or recorded. A masked value is replaced by
+// whether it changed and a salted hash, which is the same for equal values, but cannot be used to guess the value.
+type redactor struct {
+	rules []redactionRule
+	salt  []byte
+}
+
+// The salt of the hashes of masked values, which is different every time kubectl confirm runs
+var redactionSalt = newRedactionSalt()
+
+func newRedactionSalt() []byte {
+	salt := make([]byte, 32)
+	_, _ = rand.Read(salt)
+	return salt
+}
+
+// newRedactor returns a redactor that masks Secret values, and the values selected by the rules
+func newRedactor(rules []redactionRule) *redactor {
+	secretRule := secretRedactionRule
+	_ = secretRule.compile()
+	return &redactor{rules: append([]redactionRule{secretRule}, rules...), salt: redactionSalt}
+}
+
+// redact returns a copy of obj with its sensitive values masked
+func (r *redactor) redact(obj map[string]interface{}) map[string]interface{} {
+	_, redacted := r.redactPair(nil, obj)
+	return redacted
+}
+
+// redactPair returns copies of an object before and after a change, with their sensitive values masked. Either one may
+// be nil, like when the object is created. If both are set, each masked value shows whether it changed.
+func (r *redactor) redactPair(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	before, after = copyObject(before), copyObject(after)
+	obj := after
+	if obj == nil {
+		obj = before
+	}
+	if obj == nil {
+		return before, after
+	}
+
+	redacted := false
+	seen := map[string]bool{}
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.appliesTo(obj) {
+			continue
+		}
+		redacted = true
+		for _, location := range append(rule.locate(before), rule.locate(after)...) {
+			key := fmt.Sprint(location)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			beforeValue, beforeFound := getLocation(before, location)
+			afterValue, afterFound := getLocation(after, location)
+			state := ""
+			if before != nil && after != nil {
+				state = "changed"
+				if beforeFound && afterFound && reflect.DeepEqual(beforeValue, afterValue) {
+					state = "unchanged"
+				}
+			}
+			if beforeFound {
+				setLocation(before, location, r.mask(beforeValue, state))
+			}
+			if afterFound {
+				setLocation(after, location, r.mask(afterValue, state))
+			}
+		}
+	}
+
+	// The last applied configuration contains the same values, so they are masked the same way
+	if redacted {
+		beforeApplied := lastAppliedConfig(before)
+		afterApplied := lastAppliedConfig(after)
+		if beforeApplied != nil || afterApplied != nil {
+			beforeApplied, afterApplied = r.redactPair(beforeApplied, afterApplied)
+			setLastAppliedConfig(before, beforeApplied)
+			setLastAppliedConfig(after, afterApplied)
+		}
+	}
+	return before, after
+}
+
+// mask returns the text shown in place of a sensitive value
+func (r *redactor) mask(v interface{}, state string) string {
+	data, _ := json.Marshal(v)
+	h := hmac.New(sha256.New, r.salt)
+	h.Write(data)
+	hash := hex.EncodeToString(h.Sum(nil))[:12]
+	if len(state) == 0 {
+		return fmt.Sprintf("*** (hash %s)", hash)
+	}
+	return fmt.Sprintf("*** (%s, hash %s)", state, hash)
+}
+
+// redactArgs returns a kubectl command line with the values of sensitive flags masked, so that it can be printed or
+// recorded. The key of --from-literal is kept, so that it is still clear which keys are set.
+func redactArgs(args []string) []string {
+	return kubeargs.Parse(args).ReplaceValues(func(f kubeargs.Flag) (string, bool) {
+		if !containsString(sensitiveFlags, f.Name) {
+			return "", false
+		}
+		if key, _, found := strings.Cut(f.Value, "="); found && f.Name == "from-literal" {
+			return key + "=***", true
+		}
+		return "***", true
+	})
+}
+
+// lastAppliedConfig returns the object in the last applied configuration annotation of obj, or nil if there is none.
+// If the annotation cannot be decoded, it is masked entirely.
+func lastAppliedConfig(obj map[string]interface{}) map[string]interface{} {
+	annotations := util.NestedMap(obj, "metadata", "annotations")
+	value, found := annotations[lastAppliedConfigAnnotation].(string)
+	if !found {
+		return nil
+	}
+	var applied map[string]interface{}
+	if err := util.UnmarshalJSON([]byte(value), &applied); err != nil || applied == nil {
+		annotations[lastAppliedConfigAnnotation] = "***"
+		return nil
+	}
+	return applied
+}
+
+func setLastAppliedConfig(obj, applied map[string]interface{}) {
+	if applied == nil {
+		return
+	}
+	data, err := json.Marshal(applied)
+	if err != nil {
+		return
+	}
+	util.NestedMap(obj, "metadata", "annotations")[lastAppliedConfigAnnotation] = string(data) + "\n"
+}
+
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+func getLocation(v interface{}, location []interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	for _, element := range location {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			k, ok := element.(string)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = value[k]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, ok := element.(int)
+			if !ok || i >= len(value) {
+				return nil, false
+			}
+			v = value[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func setLocation(obj map[string]interface{}, location []interface{}, newValue interface{}) {
+	if len(location) == 0 {
+		return
+	}
+	parent, found := getLocation(obj, location[:len(location)-1])
+	if !found {
+		return
+	}
+	switch value := parent.(type) {
+	case map[string]interface{}:
+		value[location[len(location)-1].(string)] = newValue
+	case []interface{}:
+		value[location[len(location)-1].(int)] = newValue
+	}
+}
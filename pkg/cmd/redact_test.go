@@ -0,0 +1,188 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	testCases := []struct {
+		path             string
+		expectedElements []string
+		expectedError    string
+	}{
+		{path: ".data", expectedElements: []string{"data"}},
+		{path: "{.data.password}", expectedElements: []string{"data", "password"}},
+		{path: ".spec.containers[*].env[0].value", expectedElements: []string{"spec", "containers", "*", "env", "0", "value"}},
+		{path: ".metadata.annotations['example.com/token']", expectedElements: []string{"metadata", "annotations", "example.com/token"}},
+		{path: `.data["a.b"]`, expectedElements: []string{"data", "a.b"}},
+		{path: "data", expectedError: `invalid path "data": must start with . or [`},
+		{path: ".data..password", expectedError: `invalid path ".data..password": empty field name`},
+		{path: ".data[x]", expectedError: `invalid path ".data[x]": [x] is not an index, a wildcard, or a quoted name`},
+		{path: ".data[0", expectedError: `invalid path ".data[0": missing ]`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			elements, err := parsePath(tc.path)
+			if len(tc.expectedError) > 0 {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePath failed: %v", err)
+			}
+			if !reflect.DeepEqual(elements, tc.expectedElements) {
+				t.Fatalf("wrong elements.\nexpected: %q\ngot: %q", tc.expectedElements, elements)
+			}
+		})
+	}
+}
+
+func TestRedactPair(t *testing.T) {
+	rules := []redactionRule{
+		{Kinds: []string{"Deployment.apps"}, Paths: []string{".spec.template.spec.containers[*].env[*].value"}},
+		{Kinds: []string{"ConfigMap"}, Keys: "(?i)token"},
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatalf("compile failed: %v", err)
+		}
+	}
+	r := newRedactor(rules)
+	r.salt = []byte("test")
+	mask := func(v interface{}, state string) string {
+		return r.mask(v, state)
+	}
+
+	testCases := []struct {
+		name           string
+		before         string
+		after          string
+		expectedBefore string
+		expectedAfter  string
+	}{
+		{
+			name:           "values selected by a path",
+			before:         `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"containers": [{"name": "a", "env": [{"name": "A", "value": "1"}, {"name": "B", "value": "2"}]}]}}}}`,
+			after:          `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"containers": [{"name": "a", "env": [{"name": "A", "value": "1"}, {"name": "B", "value": "3"}]}]}}}}`,
+			expectedBefore: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"containers": [{"name": "a", "env": [{"name": "A", "value": "` + mask("1", "unchanged") + `"}, {"name": "B", "value": "` + mask("2", "changed") + `"}]}]}}}}`,
+			expectedAfter:  `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"containers": [{"name": "a", "env": [{"name": "A", "value": "` + mask("1", "unchanged") + `"}, {"name": "B", "value": "` + mask("3", "changed") + `"}]}]}}}}`,
+		},
+		{
+			name:           "values selected by keys",
+			before:         `{"apiVersion": "v1", "kind": "ConfigMap", "data": {"API_TOKEN": "abc", "url": "x"}}`,
+			after:          `{"apiVersion": "v1", "kind": "ConfigMap", "data": {"API_TOKEN": "abc", "url": "y", "refreshToken": "def"}}`,
+			expectedBefore: `{"apiVersion": "v1", "kind": "ConfigMap", "data": {"API_TOKEN": "` + mask("abc", "unchanged") + `", "url": "x"}}`,
+			expectedAfter:  `{"apiVersion": "v1", "kind": "ConfigMap", "data": {"API_TOKEN": "` + mask("abc", "unchanged") + `", "url": "y", "refreshToken": "` + mask("def", "changed") + `"}}`,
+		},
+		{
+			name:          "created secret",
+			after:         `{"apiVersion": "v1", "kind": "Secret", "data": {"a": "YQ=="}}`,
+			expectedAfter: `{"apiVersion": "v1", "kind": "Secret", "data": {"a": "` + mask("YQ==", "") + `"}}`,
+		},
+		{
+			name:           "secret in another group is not redacted by default",
+			before:         `{"apiVersion": "example.com/v1", "kind": "Secret", "data": {"a": "1"}}`,
+			after:          `{"apiVersion": "example.com/v1", "kind": "Secret", "data": {"a": "2"}}`,
+			expectedBefore: `{"apiVersion": "example.com/v1", "kind": "Secret", "data": {"a": "1"}}`,
+			expectedAfter:  `{"apiVersion": "example.com/v1", "kind": "Secret", "data": {"a": "2"}}`,
+		},
+		{
+			name:           "last applied configuration",
+			before:         `{"apiVersion": "v1", "kind": "Secret", "metadata": {"annotations": {"kubectl.kubernetes.io/last-applied-configuration": "{\"apiVersion\":\"v1\",\"kind\":\"Secret\",\"data\":{\"a\":\"YQ==\"}}\n"}}, "data": {"a": "YQ=="}}`,
+			after:          `{"apiVersion": "v1", "kind": "Secret", "metadata": {"annotations": {"kubectl.kubernetes.io/last-applied-configuration": "not json"}}, "data": {"a": "YQ=="}}`,
+			expectedBefore: `{"apiVersion": "v1", "kind": "Secret", "metadata": {"annotations": {"kubectl.kubernetes.io/last-applied-configuration": "{\"apiVersion\":\"v1\",\"data\":{\"a\":\"` + mask("YQ==", "") + `\"},\"kind\":\"Secret\"}\n"}}, "data": {"a": "` + mask("YQ==", "unchanged") + `"}}`,
+			expectedAfter:  `{"apiVersion": "v1", "kind": "Secret", "metadata": {"annotations": {"kubectl.kubernetes.io/last-applied-configuration": "***"}}, "data": {"a": "` + mask("YQ==", "unchanged") + `"}}`,
+		},
+	}
+	decode := func(s string) map[string]interface{} {
+		var obj map[string]interface{}
+		if len(s) > 0 {
+			if err := json.Unmarshal([]byte(s), &obj); err != nil {
+				t.Fatalf("invalid JSON %s: %v", s, err)
+			}
+		}
+		return obj
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before, after := decode(tc.before), decode(tc.after)
+			actualBefore, actualAfter := r.redactPair(before, after)
+			if !reflect.DeepEqual(actualBefore, decode(tc.expectedBefore)) {
+				t.Fatalf("wrong before.\nexpected: %s\ngot: %v", tc.expectedBefore, actualBefore)
+			}
+			if !reflect.DeepEqual(actualAfter, decode(tc.expectedAfter)) {
+				t.Fatalf("wrong after.\nexpected: %s\ngot: %v", tc.expectedAfter, actualAfter)
+			}
+			if !reflect.DeepEqual(before, decode(tc.before)) || !reflect.DeepEqual(after, decode(tc.after)) {
+				t.Fatalf("expected the original objects to be unchanged")
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	r := &redactor{salt: []byte("test")}
+	if r.mask("hunter2", "changed") != "*** (changed, hash 5fb1e13daf51)" {
+		t.Fatalf("wrong mask: %s", r.mask("hunter2", "changed"))
+	}
+	if r.mask("hunter2", "") != "*** (hash 5fb1e13daf51)" {
+		t.Fatalf("wrong mask: %s", r.mask("hunter2", ""))
+	}
+	other := &redactor{salt: []byte("other")}
+	if strings.Contains(other.mask("hunter2", ""), "5fb1e13daf51") {
+		t.Fatalf("expected the hash to depend on the salt")
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			args:     []string{"apply", "-f", "x.yaml", "--token=abc", "--password", "hunter2"},
+			expected: []string{"apply", "-f", "x.yaml", "--token=***", "--password", "***"},
+		},
+		{
+			args:     []string{"create", "secret", "generic", "x", "--from-literal=user=admin", "--from-literal", "pass=hunter2", "--from-env-file=.env"},
+			expected: []string{"create", "secret", "generic", "x", "--from-literal=user=***", "--from-literal", "pass=***", "--from-env-file=***"},
+		},
+		{
+			args:     []string{"create", "secret", "docker-registry", "x", "--docker-password", "hunter2", "--docker-server=example.com"},
+			expected: []string{"create", "secret", "docker-registry", "x", "--docker-password", "***", "--docker-server=example.com"},
+		},
+		{
+			args:     []string{"delete", "pod", "foo"},
+			expected: []string{"delete", "pod", "foo"},
+		},
+	}
+	for _, tc := range testCases {
+		if actual := redactArgs(tc.args); !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("wrong args.\nexpected: %v\ngot: %v", tc.expected, actual)
+		}
+		if actual := redactArgs(tc.expected); !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("expected masked args to stay the same.\nexpected: %v\ngot: %v", tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+// openTerminal opens the terminal, which is used to prompt for confirmation when stdin is the manifest. It can be
+// replaced in tests.
+var openTerminal = func() (io.ReadCloser, error) {
+	return os.Open("/dev/tty")
+}
+
+// readStdinManifest reads the manifest when it is piped to stdin with -f -, like the output of helm template. It is
+// read once, because it is needed by the preview and by the command itself, and the prompt reads the response from
+// the terminal instead of stdin. The returned function closes the terminal.
+func (o *confirmOptions) readStdinManifest(cmd *cobra.Command) (func(), error) {
+	manifest, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return nil, err
+	}
+	terminal, err := openTerminal()
+	if err != nil {
+		return nil, fmt.Errorf("a terminal is required to confirm a manifest read from stdin: %v", err)
+	}
+	o.stdinManifest = manifest
+	cmd.SetIn(terminal)
+	return func() { _ = terminal.Close() }, nil
+}
+
+// manifestInput returns the stdin of the kubectl commands that read the manifest
+func (o *confirmOptions) manifestInput(cmd *cobra.Command) io.Reader {
+	if o.stdinManifest != nil {
+		return bytes.NewReader(o.stdinManifest)
+	}
+	return cmd.InOrStdin()
+}
+
+// hasRenderedManifest returns true if the objects of the command come from a kustomization or from stdin, so they
+// cannot be seen in the files themselves
+func (o *confirmOptions) hasRenderedManifest() bool {
+	return (len(o.kustomize) > 0 && !o.hasAnyNonRegularFiles) || o.stdinManifest != nil
+}
+
+// renderedObjects returns the objects in the manifest rendered from the kustomization, or read from stdin, along with
+// where they come from
+func (o *confirmOptions) renderedObjects(cmd *cobra.Command) ([]manifestObject, string, error) {
+	source := "stdin"
+	manifest := o.stdinManifest
+	if manifest == nil {
+		source = "kustomization " + o.kustomize
+		stdout := bytes.Buffer{}
+		stderr := bytes.Buffer{}
+		if err := o.runKubectl(cmd.Context(), []string{"kustomize", o.kustomize}, cmd.InOrStdin(), &stdout, &stderr); err != nil {
+			return nil, source, fmt.Errorf("%s", stderr.String())
+		}
+		manifest = stdout.Bytes()
+	}
+	var objects []manifestObject
+	for _, h := range yaml.ReadHeaders(manifest) {
+		objects = append(objects, manifestObject{Header: h, source: source})
+	}
+	return objects, source, nil
+}
+
+// printRendered prints the number of objects of each kind and namespace in the rendered manifest, and returns them.
+// Objects without a namespace are shown in the namespace resolved by printConfig.
+func (o *confirmOptions) printRendered(cmd *cobra.Command) ([]manifestObject, error) {
+	util.PrintSectionTitle(cmd, "Rendered")
+	defer cmd.Println()
+
+	m := o.readManifests(cmd)
+	objects, source := m.rendered, m.source
+	if m.renderedErr != nil {
+		return nil, m.renderedErr
+	}
+	cmd.Printf("%-11s %s\n", "Source:", source)
+	cmd.Printf("%-11s %d\n", "Objects:", len(objects))
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	// Count the objects of each kind and namespace
+	type group struct {
+		kind      string
+		namespace string
+	}
+	counts := map[group]int{}
+	for _, obj := range objects {
+		g := group{kind: obj.kind(), namespace: obj.Namespace}
+		if len(g.namespace) == 0 && obj.namespaced() {
+			g.namespace = o.resolvedNamespace + " (default)"
+			if len(o.namespace) > 0 {
+				g.namespace = o.namespace
+			}
+		}
+		counts[g]++
+	}
+	groups := make([]group, 0, len(counts))
+	kindWidth, namespaceWidth := len("KIND"), len("NAMESPACE")
+	for g := range counts {
+		groups = append(groups, g)
+		kindWidth = max(kindWidth, len(g.kind))
+		namespaceWidth = max(namespaceWidth, len(g.namespace))
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].kind != groups[j].kind {
+			return groups[i].kind < groups[j].kind
+		}
+		return groups[i].namespace < groups[j].namespace
+	})
+	cmd.Println()
+	cmd.Printf("%-*s  %-*s  %s\n", kindWidth, "KIND", namespaceWidth, "NAMESPACE", "COUNT")
+	for _, g := range groups {
+		cmd.Printf("%-*s  %-*s  %d\n", kindWidth, g.kind, namespaceWidth, g.namespace, counts[g])
+	}
+	return objects, nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
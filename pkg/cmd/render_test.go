@@ -0,0 +1,211 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+const testRenderedManifest = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: prod
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  namespace: prod
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`
+
+func TestPrintRendered(t *testing.T) {
+	testCases := []struct {
+		name           string
+		options        confirmOptions
+		expectedArgs   []string
+		expectedStdout string
+	}{
+		{
+			name:         "kustomization",
+			options:      confirmOptions{kustomize: "overlays/prod", resolvedContext: "prod-us", resolvedNamespace: "dev"},
+			expectedArgs: []string{"kustomize", "overlays/prod"},
+			expectedStdout: `========== Rendered =========
+Source:     kustomization overlays/prod
+Objects:    4
+
+KIND             NAMESPACE      COUNT
+ConfigMap        dev (default)  1
+Deployment.apps  prod           2
+Namespace                       1
+
+`,
+		},
+		{
+			name:    "stdin with namespace flag",
+			options: confirmOptions{stdinManifest: []byte(testRenderedManifest), namespace: "prod", resolvedContext: "prod-us", resolvedNamespace: "prod"},
+			expectedStdout: `========== Rendered =========
+Source:     stdin
+Objects:    4
+
+KIND             NAMESPACE  COUNT
+ConfigMap        prod       1
+Deployment.apps  prod       2
+Namespace                   1
+
+`,
+		},
+		{
+			name:    "empty",
+			options: confirmOptions{stdinManifest: []byte("---\n")},
+			expectedStdout: `========== Rendered =========
+Source:     stdin
+Objects:    0
+
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun(testRenderedManifest, "", nil)
+
+			cmd, _, stdout, _ := util.NewTestCommand()
+			if _, err := tc.options.printRendered(cmd); err != nil {
+				t.Fatalf("printRendered failed: %v", err)
+			}
+			if tc.expectedArgs != nil && !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), tc.expectedArgs) {
+				t.Fatalf("wrong args.\nexpected: %v\ngot: %v", tc.expectedArgs, fakeExecRunner.LastRunArgs())
+			}
+			if stdout.String() != tc.expectedStdout {
+				t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", tc.expectedStdout, stdout.String())
+			}
+		})
+	}
+}
+
+func TestPrintRenderedError(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRun("", "error: unable to find one of 'kustomization.yaml'", errors.New("exit status 1"))
+
+	cmd, _, _, _ := util.NewTestCommand()
+	o := confirmOptions{kustomize: "missing"}
+	if _, err := o.printRendered(cmd); err == nil || !strings.Contains(err.Error(), "unable to find") {
+		t.Fatalf("expected the kustomize error, got %v", err)
+	}
+}
+
+func TestRenderOnce(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("view"), `{"current-context": "prod", "contexts": [{"name": "prod", "context": {}}]}`, "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("kustomize"), testRenderedManifest, "", nil)
+	for i := 0; i < 4; i++ {
+		fakeExecRunner.SetupRunMatching(util.ArgsContain("can-i"), "yes\n", "", nil)
+	}
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), `{"kind": "List", "items": []}`, "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), "deployment.apps \"api\" deleted (server dry run)\n", "", nil)
+
+	// The config and permissions steps share one kubectl kustomize run
+	o := &confirmOptions{}
+	o.parseArgs([]string{"delete", "-k", "overlays/prod"})
+	cmd, _, stdout, _ := util.NewTestCommand()
+	if err := o.runSteps(cmd, o.previewSteps("delete")); err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	for _, args := range fakeExecRunner.RunArgs {
+		if reflect.DeepEqual(args, []string{"kustomize", "overlays/prod"}) {
+			runs++
+		}
+	}
+	if runs != 1 {
+		t.Fatalf("expected kubectl kustomize to run once, got %d runs", runs)
+	}
+	for _, expected := range []string{"Source:     kustomization overlays/prod\n", "========== Permissions ======\n"} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Fatalf("expected stdout to contain %q, got:\n%s", expected, stdout.String())
+		}
+	}
+}
+
+type fakeTerminal struct {
+	io.Reader
+	closed bool
+}
+
+func (f *fakeTerminal) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestReadStdinManifest(t *testing.T) {
+	terminal := &fakeTerminal{Reader: strings.NewReader("yes\n")}
+	openTerminal = func() (io.ReadCloser, error) {
+		return terminal, nil
+	}
+
+	cmd, stdin, _, _ := util.NewTestCommand()
+	stdin.WriteString(testRenderedManifest)
+	o := confirmOptions{}
+	closeTerminal, err := o.readStdinManifest(cmd)
+	if err != nil {
+		t.Fatalf("readStdinManifest failed: %v", err)
+	}
+	if !o.hasRenderedManifest() {
+		t.Fatalf("expected the manifest from stdin to be rendered")
+	}
+
+	// The manifest can be read more than once
+	for i := 0; i < 2; i++ {
+		manifest, _ := io.ReadAll(o.manifestInput(cmd))
+		if string(manifest) != testRenderedManifest {
+			t.Fatalf("wrong manifest: %s", manifest)
+		}
+	}
+
+	// The response is read from the terminal
+	if response, _ := readResponse(cmd, interruptSignals); response != "yes" {
+		t.Fatalf("wrong response: %q", response)
+	}
+	closeTerminal()
+	if !terminal.closed {
+		t.Fatalf("expected the terminal to be closed")
+	}
+
+	openTerminal = func() (io.ReadCloser, error) {
+		return nil, errors.New("no such device or address")
+	}
+	if _, err := (&confirmOptions{}).readStdinManifest(cmd); err == nil || err.Error() != "a terminal is required to confirm a manifest read from stdin: no such device or address" {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
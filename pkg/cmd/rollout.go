@@ -0,0 +1,340 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// Rollout subcommands that modify a workload, and therefore have a preview
+var rolloutPreviewCommands = map[string]bool{
+	"pause":   true,
+	"restart": true,
+	"resume":  true,
+	"undo":    true,
+}
+
+// Rollout subcommands that do not modify anything
+var rolloutReadOnlyCommands = map[string]bool{
+	"history": true,
+	"status":  true,
+}
+
+// Rollout flags that are not accepted by kubectl get
+var rolloutOnlyFlags = []string{"dry-run", "field-manager", "to-revision"}
+
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+func (o *confirmOptions) rollout(cmd *cobra.Command) error {
+	subcommand, getArgs, toRevision, err := parseRolloutArgs(o.args)
+	if err != nil {
+		return err
+	}
+	if !rolloutPreviewCommands[subcommand] {
+		return nil
+	}
+
+	util.PrintSectionTitle(cmd, "Rollout")
+	defer cmd.Println()
+
+	var result map[string]interface{}
+	if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), getArgs, cmd.InOrStdin(), &result); err != nil {
+		return err
+	}
+
+	o.rolloutObjects = util.ObjectItems(result)
+	for _, obj := range o.rolloutObjects {
+		switch subcommand {
+		case "undo":
+			if err := o.previewRolloutUndo(cmd, obj, toRevision); err != nil {
+				return err
+			}
+		case "restart":
+			o.previewRolloutRestart(cmd, obj)
+		case "pause", "resume":
+			previewRolloutPause(cmd, obj, subcommand)
+		}
+	}
+	return nil
+}
+
+// parseRolloutArgs returns the rollout subcommand, along with the args that can be used to get the affected objects
+// and the value of --to-revision (or 0 if it was not specified).
+func parseRolloutArgs(args *kubeargs.Args) (string, []string, int64, error) {
+	var toRevision int64
+	if value := args.Value("to-revision"); len(value) > 0 {
+		revision, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", nil, 0, fmt.Errorf("invalid --to-revision value %q", value)
+		}
+		toRevision = revision
+	}
+
+	operands := args.Operands()
+	if len(operands) == 0 {
+		return "", nil, 0, nil
+	}
+	getArgs := append([]string{"get"}, operands[1:]...)
+	getArgs = append(getArgs, args.FlagArgs(func(f kubeargs.Flag) bool {
+		return !containsString(rolloutOnlyFlags, f.Name)
+	})...)
+	return operands[0], append(getArgs, "-o", "json"), toRevision, nil
+}
+
+type podTemplateRevision struct {
+	revision int64
+	template map[string]interface{}
+}
+
+func (o *confirmOptions) previewRolloutUndo(cmd *cobra.Command, obj map[string]interface{}, toRevision int64) error {
+	name := util.ObjectName(obj)
+
+	revisions, err := o.getPodTemplateRevisions(cmd, obj)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		cmd.Printf("%s has no rollout history\n", name)
+		return nil
+	}
+
+	current := revisions[len(revisions)-1]
+	if r, err := strconv.ParseInt(util.NestedString(obj, "metadata", "annotations", deploymentRevisionAnnotation), 10, 64); err == nil {
+		current.revision = r
+	}
+
+	var target *podTemplateRevision
+	for i := len(revisions) - 1; i >= 0; i-- {
+		r := revisions[i]
+		if (toRevision == 0 && r.revision < current.revision) || (toRevision != 0 && r.revision == toRevision) {
+			target = &revisions[i]
+			break
+		}
+	}
+	if target == nil {
+		if toRevision != 0 {
+			cmd.Printf("%s has no revision %d\n", name, toRevision)
+		} else {
+			cmd.Printf("%s has no previous revision to roll back to\n", name)
+		}
+		return nil
+	}
+
+	cmd.Printf("%s will be rolled back from revision %d to revision %d\n", name, current.revision, target.revision)
+	// The pod templates are redacted as part of the workload, so that redaction rules for its kind apply to them
+	currentWorkload, targetWorkload := o.policy.redactor().redactPair(
+		withPodTemplate(obj, util.NestedMap(obj, "spec", "template")),
+		withPodTemplate(obj, target.template),
+	)
+	diff := util.UnifiedDiff(
+		fmt.Sprintf("revision %d (current)", current.revision),
+		fmt.Sprintf("revision %d", target.revision),
+		toIndentedJSON(util.NestedMap(currentWorkload, "spec", "template")),
+		toIndentedJSON(util.NestedMap(targetWorkload, "spec", "template")),
+	)
+	if diff == "" {
+		cmd.Println("no pod template changes")
+	} else {
+		cmd.Print(diff)
+	}
+	return nil
+}
+
+// getPodTemplateRevisions returns the pod templates from the rollout history of a workload, sorted by revision. The
+// history of a Deployment is kept in ReplicaSets, and the history of a DaemonSet or StatefulSet is kept in
+// ControllerRevisions.
+func (o *confirmOptions) getPodTemplateRevisions(cmd *cobra.Command, obj map[string]interface{}) ([]podTemplateRevision, error) {
+	var historyResource string
+	switch util.NestedString(obj, "kind") {
+	case "Deployment":
+		historyResource = "replicasets.apps"
+	case "DaemonSet", "StatefulSet":
+		historyResource = "controllerrevisions.apps"
+	default:
+		return nil, nil
+	}
+
+	args := append([]string{"get", historyResource, "--namespace", util.NestedString(obj, "metadata", "namespace"), "-o", "json"}, o.globalFlags()...)
+	var history map[string]interface{}
+	if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), args, cmd.InOrStdin(), &history); err != nil {
+		return nil, err
+	}
+
+	uid := util.NestedString(obj, "metadata", "uid")
+	var revisions []podTemplateRevision
+	for _, item := range util.ObjectItems(history) {
+		if !isOwnedBy(item, uid) {
+			continue
+		}
+		var r podTemplateRevision
+		if historyResource == "replicasets.apps" {
+			revision, err := strconv.ParseInt(util.NestedString(item, "metadata", "annotations", deploymentRevisionAnnotation), 10, 64)
+			if err != nil {
+				continue
+			}
+			r.revision = revision
+			r.template = copyObject(util.NestedMap(item, "spec", "template"))
+			// The pod-template-hash label is added by the deployment controller and is not part of the deployment
+			delete(util.NestedMap(r.template, "metadata", "labels"), "pod-template-hash")
+		} else {
+			r.revision, _ = util.NestedInt64(item, "revision")
+			r.template = copyObject(util.NestedMap(item, "data", "spec", "template"))
+			delete(r.template, "$patch")
+		}
+		revisions = append(revisions, r)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].revision < revisions[j].revision
+	})
+	return revisions, nil
+}
+
+func (o *confirmOptions) previewRolloutRestart(cmd *cobra.Command, obj map[string]interface{}) {
+	cmd.Printf("%s will be restarted\n", util.ObjectName(obj))
+	if pods, ok := podsToRestart(obj); ok {
+		cmd.Printf("  %-10s %d\n", "Pods:", pods)
+	}
+	cmd.Printf("  %-10s %s\n", "Strategy:", describeRolloutStrategy(obj))
+	lines, warnings := o.describeRolloutRisk(obj)
+	for _, line := range lines {
+		cmd.Println(line)
+	}
+	for _, w := range warnings {
+		cmd.Printf("WARNING: %s\n", w)
+	}
+}
+
+func previewRolloutPause(cmd *cobra.Command, obj map[string]interface{}, subcommand string) {
+	paused, _ := util.NestedField(obj, "spec", "paused").(bool)
+	state := "not paused"
+	if paused {
+		state = "paused"
+	}
+	cmd.Printf("%s will be %sd (currently %s)\n", util.ObjectName(obj), subcommand, state)
+}
+
+// podsToRestart returns the number of pods that will be replaced when the pod template of a workload changes
+func podsToRestart(obj map[string]interface{}) (int64, bool) {
+	switch util.NestedString(obj, "kind") {
+	case "Deployment":
+		return specReplicas(obj), true
+	case "StatefulSet":
+		partition, _ := util.NestedInt64(obj, "spec", "updateStrategy", "rollingUpdate", "partition")
+		pods := specReplicas(obj) - partition
+		if pods < 0 {
+			pods = 0
+		}
+		return pods, true
+	case "DaemonSet":
+		return util.NestedInt64(obj, "status", "desiredNumberScheduled")
+	}
+	return 0, false
+}
+
+func specReplicas(obj map[string]interface{}) int64 {
+	if replicas, ok := util.NestedInt64(obj, "spec", "replicas"); ok {
+		return replicas
+	}
+	return 1
+}
+
+// describeRolloutStrategy returns a description of the update strategy of a workload, including defaults
+func describeRolloutStrategy(obj map[string]interface{}) string {
+	switch util.NestedString(obj, "kind") {
+	case "Deployment":
+		strategy := util.NestedMap(obj, "spec", "strategy")
+		if util.NestedString(strategy, "type") == "Recreate" {
+			return "Recreate (all pods are terminated before new pods are created)"
+		}
+		return fmt.Sprintf("RollingUpdate (maxUnavailable: %s, maxSurge: %s)",
+			intOrStringWithDefault(strategy, "25%", "rollingUpdate", "maxUnavailable"),
+			intOrStringWithDefault(strategy, "25%", "rollingUpdate", "maxSurge"))
+	case "DaemonSet":
+		strategy := util.NestedMap(obj, "spec", "updateStrategy")
+		if util.NestedString(strategy, "type") == "OnDelete" {
+			return "OnDelete (pods are only replaced when they are deleted)"
+		}
+		return fmt.Sprintf("RollingUpdate (maxUnavailable: %s, maxSurge: %s)",
+			intOrStringWithDefault(strategy, "1", "rollingUpdate", "maxUnavailable"),
+			intOrStringWithDefault(strategy, "0", "rollingUpdate", "maxSurge"))
+	case "StatefulSet":
+		strategy := util.NestedMap(obj, "spec", "updateStrategy")
+		if util.NestedString(strategy, "type") == "OnDelete" {
+			return "OnDelete (pods are only replaced when they are deleted)"
+		}
+		return fmt.Sprintf("RollingUpdate (maxUnavailable: %s, partition: %s)",
+			intOrStringWithDefault(strategy, "1", "rollingUpdate", "maxUnavailable"),
+			intOrStringWithDefault(strategy, "0", "rollingUpdate", "partition"))
+	}
+	return "unknown"
+}
+
+func intOrStringWithDefault(obj map[string]interface{}, defaultValue string, fields ...string) string {
+	switch v := util.NestedField(obj, fields...).(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return defaultValue
+}
+
+func isOwnedBy(obj map[string]interface{}, uid string) bool {
+	for _, ref := range util.NestedSlice(obj, "metadata", "ownerReferences") {
+		if util.NestedString(ref, "uid") == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func copyObject(obj map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil
+	}
+	var result map[string]interface{}
+	_ = util.UnmarshalJSON(data, &result)
+	return result
+}
+
+// withPodTemplate returns a workload of the same kind as obj that only has the pod template
+func withPodTemplate(obj, template map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": obj["apiVersion"],
+		"kind":       obj["kind"],
+		"spec":       map[string]interface{}{"template": template},
+	}
+}
+
+func toIndentedJSON(obj interface{}) string {
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data) + "\n"
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+const fakeDeployment = `{
+	"apiVersion": "apps/v1",
+	"kind": "Deployment",
+	"metadata": {
+		"name": "foo",
+		"namespace": "bar",
+		"uid": "deploy-uid",
+		"annotations": {"deployment.kubernetes.io/revision": "3"}
+	},
+	"spec": {
+		"replicas": 3,
+		"strategy": {"type": "RollingUpdate", "rollingUpdate": {"maxUnavailable": 1, "maxSurge": "50%"}},
+		"template": {"metadata": {"labels": {"app": "foo"}}, "spec": {"containers": [{"name": "foo", "image": "foo:3"}]}}
+	},
+	"status": {"readyReplicas": 3}
+}`
+
+const fakeReplicaSets = `{
+	"kind": "List",
+	"items": [
+		{
+			"metadata": {
+				"annotations": {"deployment.kubernetes.io/revision": "1"},
+				"ownerReferences": [{"uid": "deploy-uid"}]
+			},
+			"spec": {"template": {"metadata": {"labels": {"app": "foo", "pod-template-hash": "abc"}}, "spec": {"containers": [{"name": "foo", "image": "foo:1"}]}}}
+		},
+		{
+			"metadata": {
+				"annotations": {"deployment.kubernetes.io/revision": "2"},
+				"ownerReferences": [{"uid": "deploy-uid"}]
+			},
+			"spec": {"template": {"metadata": {"labels": {"app": "foo", "pod-template-hash": "def"}}, "spec": {"containers": [{"name": "foo", "image": "foo:2"}]}}}
+		},
+		{
+			"metadata": {
+				"annotations": {"deployment.kubernetes.io/revision": "3"},
+				"ownerReferences": [{"uid": "deploy-uid"}]
+			},
+			"spec": {"template": {"metadata": {"labels": {"app": "foo", "pod-template-hash": "ghi"}}, "spec": {"containers": [{"name": "foo", "image": "foo:3"}]}}}
+		},
+		{
+			"metadata": {
+				"annotations": {"deployment.kubernetes.io/revision": "9"},
+				"ownerReferences": [{"uid": "other-uid"}]
+			},
+			"spec": {"template": {"spec": {"containers": [{"name": "other", "image": "other:9"}]}}}
+		}
+	]
+}`
+
+func TestParseRolloutArgs(t *testing.T) {
+	testCases := []struct {
+		name               string
+		args               []string
+		expectedSubcommand string
+		expectedGetArgs    []string
+		expectedRevision   int64
+	}{
+		{
+			name:               "undo",
+			args:               []string{"rollout", "undo", "deploy/foo"},
+			expectedSubcommand: "undo",
+			expectedGetArgs:    []string{"get", "deploy/foo", "-o", "json"},
+		},
+		{
+			name:               "undo to revision",
+			args:               []string{"rollout", "undo", "deploy/foo", "--to-revision=2", "-n", "bar"},
+			expectedSubcommand: "undo",
+			expectedGetArgs:    []string{"get", "deploy/foo", "--namespace=bar", "-o", "json"},
+			expectedRevision:   2,
+		},
+		{
+			name:               "undo to revision with separate value",
+			args:               []string{"--context", "baz", "rollout", "undo", "--to-revision", "4", "deployment", "foo"},
+			expectedSubcommand: "undo",
+			expectedGetArgs:    []string{"get", "deployment", "foo", "--context=baz", "-o", "json"},
+			expectedRevision:   4,
+		},
+		{
+			name:               "restart with field manager and dry run",
+			args:               []string{"rollout", "restart", "ds/foo", "--field-manager", "me", "--dry-run"},
+			expectedSubcommand: "restart",
+			expectedGetArgs:    []string{"get", "ds/foo", "-o", "json"},
+		},
+		{
+			name:               "status",
+			args:               []string{"rollout", "status", "deploy/foo"},
+			expectedSubcommand: "status",
+			expectedGetArgs:    []string{"get", "deploy/foo", "-o", "json"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			subcommand, getArgs, revision, err := parseRolloutArgs(kubeargs.Parse(tc.args))
+			if err != nil {
+				t.Fatalf("parseRolloutArgs failed: %v", err)
+			}
+			if subcommand != tc.expectedSubcommand {
+				t.Fatalf("wrong subcommand. expected: %q, got: %q", tc.expectedSubcommand, subcommand)
+			}
+			if !reflect.DeepEqual(getArgs, tc.expectedGetArgs) {
+				t.Fatalf("wrong get args.\nexpected: %v\ngot: %v\n", tc.expectedGetArgs, getArgs)
+			}
+			if revision != tc.expectedRevision {
+				t.Fatalf("wrong revision. expected: %d, got: %d", tc.expectedRevision, revision)
+			}
+		})
+	}
+
+	if _, _, _, err := parseRolloutArgs(kubeargs.Parse([]string{"rollout", "undo", "deploy/foo", "--to-revision=x"})); err == nil {
+		t.Fatalf("expected an error for an invalid revision")
+	}
+}
+
+func TestRollout(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		options                confirmOptions
+		fakeOsArgs             []string
+		fakeRuns               []string
+		expectedHistoryArgs    []string
+		expectedStdout         []string
+		expectedStdoutNotFound []string
+	}{
+		{
+			name:       "read-only subcommand has no preview",
+			fakeOsArgs: []string{"confirm", "rollout", "status", "deploy/foo"},
+		},
+		{
+			name:                "undo to previous revision",
+			fakeOsArgs:          []string{"confirm", "--context", "ctx", "rollout", "undo", "deploy/foo", "-n", "bar"},
+			fakeRuns:            []string{fakeDeployment, fakeReplicaSets},
+			expectedHistoryArgs: []string{"get", "replicasets.apps", "--namespace", "bar", "-o", "json", "--context=ctx"},
+			expectedStdout: []string{
+				"========== Rollout ==========\n",
+				"deployment.apps/foo will be rolled back from revision 3 to revision 2\n",
+				"--- revision 3 (current)\n+++ revision 2\n",
+				`-        "image": "foo:3",`,
+				`+        "image": "foo:2",`,
+			},
+			expectedStdoutNotFound: []string{"pod-template-hash", "other:9"},
+		},
+		{
+			name:       "undo to specific revision",
+			fakeOsArgs: []string{"confirm", "rollout", "undo", "deploy/foo", "--to-revision=1"},
+			fakeRuns:   []string{fakeDeployment, fakeReplicaSets},
+			expectedStdout: []string{
+				"deployment.apps/foo will be rolled back from revision 3 to revision 1\n",
+				`+        "image": "foo:1",`,
+			},
+		},
+		{
+			name:           "undo to missing revision",
+			fakeOsArgs:     []string{"confirm", "rollout", "undo", "deploy/foo", "--to-revision=7"},
+			fakeRuns:       []string{fakeDeployment, fakeReplicaSets},
+			expectedStdout: []string{"deployment.apps/foo has no revision 7\n"},
+		},
+		{
+			name:       "undo daemonset uses controller revisions",
+			fakeOsArgs: []string{"confirm", "rollout", "undo", "ds/foo"},
+			fakeRuns: []string{
+				`{"apiVersion": "apps/v1", "kind": "DaemonSet", "metadata": {"name": "foo", "namespace": "bar", "uid": "ds-uid"}, "spec": {"template": {"spec": {"containers": [{"image": "foo:2"}]}}}}`,
+				`{"kind": "List", "items": [
+					{"metadata": {"ownerReferences": [{"uid": "ds-uid"}]}, "revision": 1, "data": {"spec": {"template": {"$patch": "replace", "spec": {"containers": [{"image": "foo:1"}]}}}}},
+					{"metadata": {"ownerReferences": [{"uid": "ds-uid"}]}, "revision": 2, "data": {"spec": {"template": {"$patch": "replace", "spec": {"containers": [{"image": "foo:2"}]}}}}}
+				]}`,
+			},
+			expectedHistoryArgs: []string{"get", "controllerrevisions.apps", "--namespace", "bar", "-o", "json"},
+			expectedStdout: []string{
+				"daemonset.apps/foo will be rolled back from revision 2 to revision 1\n",
+				`+        "image": "foo:1"`,
+			},
+			expectedStdoutNotFound: []string{"$patch"},
+		},
+		{
+			name:       "restart deployment",
+			fakeOsArgs: []string{"confirm", "rollout", "restart", "deploy/foo"},
+			fakeRuns:   []string{fakeDeployment},
+			expectedStdout: []string{
+				"deployment.apps/foo will be restarted\n",
+				"  Pods:      3\n",
+				"  Strategy:  RollingUpdate (maxUnavailable: 1, maxSurge: 50%)\n",
+				"  Ready:     3/3\n  Available: at least 2 of 3 pods (66%) during the rollout\n",
+			},
+		},
+		{
+			name:       "restart multiple workloads",
+			fakeOsArgs: []string{"confirm", "rollout", "restart", "sts/foo", "ds/bar"},
+			fakeRuns: []string{
+				`{"kind": "List", "items": [
+					{"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"name": "foo"}, "spec": {"replicas": 5, "updateStrategy": {"type": "RollingUpdate", "rollingUpdate": {"partition": 2}}}},
+					{"apiVersion": "apps/v1", "kind": "DaemonSet", "metadata": {"name": "bar"}, "spec": {"updateStrategy": {"type": "OnDelete"}}, "status": {"desiredNumberScheduled": 4}}
+				]}`,
+			},
+			expectedStdout: []string{
+				"statefulset.apps/foo will be restarted\n  Pods:      3\n  Strategy:  RollingUpdate (maxUnavailable: 1, partition: 2)\n",
+				"daemonset.apps/bar will be restarted\n  Pods:      4\n  Strategy:  OnDelete (pods are only replaced when they are deleted)\n  Ready:     0/4\n",
+				"WARNING: daemonset.apps/bar uses the OnDelete update strategy, so its pods keep running the old pod template until they are deleted\n",
+			},
+		},
+		{
+			name:           "pause",
+			fakeOsArgs:     []string{"confirm", "rollout", "pause", "deploy/foo"},
+			fakeRuns:       []string{fakeDeployment},
+			expectedStdout: []string{"deployment.apps/foo will be paused (currently not paused)\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			for _, run := range tc.fakeRuns {
+				fakeExecRunner.SetupRun(run, "", nil)
+			}
+			tc.options.parseArgs(tc.fakeOsArgs[1:])
+
+			cmd, _, stdout, _ := util.NewTestCommand()
+			if err := tc.options.rollout(cmd); err != nil {
+				t.Fatalf("rollout failed: %v", err)
+			}
+
+			if fakeExecRunner.RunCount() != len(tc.fakeRuns) {
+				t.Fatalf("wrong number of kubectl runs. expected: %d, got: %d", len(tc.fakeRuns), fakeExecRunner.RunCount())
+			}
+			if tc.expectedHistoryArgs != nil && !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), tc.expectedHistoryArgs) {
+				t.Fatalf("wrong history args.\nexpected: %v\ngot: %v\n", tc.expectedHistoryArgs, fakeExecRunner.LastRunArgs())
+			}
+			if len(tc.fakeRuns) == 0 && stdout.Len() > 0 {
+				t.Fatalf("unexpected stdout:\n%s", stdout.String())
+			}
+			for _, s := range tc.expectedStdout {
+				if !strings.Contains(stdout.String(), s) {
+					t.Fatalf("expected stdout to contain %q, but it did not\n%s", s, stdout.String())
+				}
+			}
+			for _, s := range tc.expectedStdoutNotFound {
+				if strings.Contains(stdout.String(), s) {
+					t.Fatalf("expected stdout not to contain %q, but it did\n%s", s, stdout.String())
+				}
+			}
+		})
+	}
+}
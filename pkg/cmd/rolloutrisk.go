@@ -0,0 +1,186 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// Kinds of workloads that replace their pods when their pod template changes
+var rollingWorkloadKinds = map[string]bool{
+	"DaemonSet":   true,
+	"Deployment":  true,
+	"StatefulSet": true,
+}
+
+// rolloutCapacity is the number of pods of a workload that are ready now, and that are expected to stay available
+// while its pods are replaced
+type rolloutCapacity struct {
+	desired      int64
+	ready        int64
+	minAvailable int64
+}
+
+// onDeleteStrategy returns true if the pods of a workload are only replaced when they are deleted
+func onDeleteStrategy(obj map[string]interface{}) bool {
+	kind := util.NestedString(obj, "kind")
+	return (kind == "DaemonSet" || kind == "StatefulSet") && util.NestedString(obj, "spec", "updateStrategy", "type") == "OnDelete"
+}
+
+// scaledValue returns an int or percentage, like 1 or 25%, as a number of pods out of total. Percentages are rounded
+// up or down like the workload controllers do.
+func scaledValue(value string, total int64, roundUp bool) int64 {
+	isPercent := strings.HasSuffix(value, "%")
+	n, err := strconv.ParseInt(strings.TrimSuffix(value, "%"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	if !isPercent {
+		return n
+	}
+	if roundUp {
+		return (total*n + 99) / 100
+	}
+	return total * n / 100
+}
+
+// getRolloutCapacity returns the capacity of a workload during a rollout, using its rollout strategy and its current
+// readiness. A rollout does not make ready pods unavailable beyond maxUnavailable, but pods that are not ready now
+// count against it.
+func getRolloutCapacity(obj map[string]interface{}) (rolloutCapacity, bool) {
+	var c rolloutCapacity
+	var maxUnavailable int64
+	switch util.NestedString(obj, "kind") {
+	case "Deployment":
+		c.desired = specReplicas(obj)
+		c.ready, _ = util.NestedInt64(obj, "status", "readyReplicas")
+		strategy := util.NestedMap(obj, "spec", "strategy")
+		if util.NestedString(strategy, "type") == "Recreate" {
+			maxUnavailable = c.desired
+			break
+		}
+		maxUnavailable = scaledValue(intOrStringWithDefault(strategy, "25%", "rollingUpdate", "maxUnavailable"), c.desired, false)
+		maxSurge := scaledValue(intOrStringWithDefault(strategy, "25%", "rollingUpdate", "maxSurge"), c.desired, true)
+		if maxUnavailable == 0 && maxSurge == 0 {
+			maxUnavailable = 1
+		}
+	case "StatefulSet":
+		c.desired = specReplicas(obj)
+		c.ready, _ = util.NestedInt64(obj, "status", "readyReplicas")
+		maxUnavailable = scaledValue(intOrStringWithDefault(obj, "1", "spec", "updateStrategy", "rollingUpdate", "maxUnavailable"), c.desired, false)
+		if maxUnavailable < 1 {
+			maxUnavailable = 1
+		}
+		if pods, _ := podsToRestart(obj); pods < maxUnavailable {
+			maxUnavailable = pods
+		}
+	case "DaemonSet":
+		c.desired, _ = util.NestedInt64(obj, "status", "desiredNumberScheduled")
+		c.ready, _ = util.NestedInt64(obj, "status", "numberReady")
+		maxUnavailable = scaledValue(intOrStringWithDefault(obj, "1", "spec", "updateStrategy", "rollingUpdate", "maxUnavailable"), c.desired, true)
+	default:
+		return c, false
+	}
+	c.minAvailable = c.desired - maxUnavailable
+	if c.ready < c.minAvailable {
+		c.minAvailable = c.ready
+	}
+	if c.minAvailable < 0 {
+		c.minAvailable = 0
+	}
+	return c, true
+}
+
+// describeRolloutRisk returns the readiness of a workload and its capacity while its pods are replaced, as lines in
+// the format of previewRolloutRestart, along with warnings about an OnDelete strategy, which does not replace the
+// pods, and about a capacity below the minimum of the policy, or of no pods at all
+func (o *confirmOptions) describeRolloutRisk(obj map[string]interface{}) ([]string, []string) {
+	name := util.ObjectName(obj)
+	c, ok := getRolloutCapacity(obj)
+	if !ok {
+		return nil, nil
+	}
+	lines := []string{fmt.Sprintf("  %-10s %d/%d", "Ready:", c.ready, c.desired)}
+	if onDeleteStrategy(obj) {
+		return lines, []string{fmt.Sprintf("%s uses the OnDelete update strategy, so its pods keep running the old pod template until they are deleted", name)}
+	}
+	if c.desired == 0 {
+		return lines, nil
+	}
+	percent := c.minAvailable * 100 / c.desired
+	lines = append(lines, fmt.Sprintf("  %-10s at least %d of %d pods (%d%%) during the rollout", "Available:", c.minAvailable, c.desired, percent))
+	var minPercent int64
+	if o.policy != nil {
+		minPercent = int64(o.policy.RolloutMinAvailable)
+	}
+	switch {
+	case c.minAvailable == 0:
+		return lines, []string{fmt.Sprintf("%s may have no pods available during the rollout", name)}
+	case c.minAvailable*100 < minPercent*c.desired:
+		return lines, []string{fmt.Sprintf("%s may have only %d of %d pods (%d%%) available during the rollout, which is below the minimum of %d%%", name, c.minAvailable, c.desired, percent, minPercent)}
+	}
+	return lines, nil
+}
+
+// podTemplateChanged returns true if the command changes the pod template of a workload that exists, so its pods are
+// replaced
+func (p previewObject) podTemplateChanged() bool {
+	if p.live == nil || !rollingWorkloadKinds[util.NestedString(p.merged, "kind")] || util.ObjectGroup(p.merged) != "apps" {
+		return false
+	}
+	return !reflect.DeepEqual(util.NestedMap(p.live, "spec", "template"), util.NestedMap(p.merged, "spec", "template"))
+}
+
+// printRolloutRisk shows the pods that are replaced in the workloads whose pod template changes, the rollout strategy,
+// and the readiness and capacity of each workload during the rollout. Nothing is printed if no pod templates change.
+func (o *confirmOptions) printRolloutRisk(cmd *cobra.Command) {
+	var lines, warnings []string
+	for _, p := range o.preview {
+		if !p.podTemplateChanged() {
+			continue
+		}
+		name := util.ObjectName(p.merged)
+		if onDeleteStrategy(p.merged) {
+			lines = append(lines, fmt.Sprintf("%s will not restart any pods", name))
+		} else if pods, ok := podsToRestart(p.merged); ok {
+			lines = append(lines, fmt.Sprintf("%s will restart %d pod(s)", name, pods))
+		}
+		lines = append(lines, fmt.Sprintf("  %-10s %s", "Strategy:", describeRolloutStrategy(p.merged)))
+		riskLines, riskWarnings := o.describeRolloutRisk(p.merged)
+		lines = append(lines, riskLines...)
+		warnings = append(warnings, riskWarnings...)
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	util.PrintSectionTitle(cmd, "Rollout Risk")
+	defer cmd.Println()
+	for _, line := range lines {
+		cmd.Println(line)
+	}
+	for _, w := range warnings {
+		cmd.Printf("WARNING: %s\n", w)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestScaledValue(t *testing.T) {
+	testCases := []struct {
+		value    string
+		total    int64
+		roundUp  bool
+		expected int64
+	}{
+		{value: "2", total: 10, expected: 2},
+		{value: "25%", total: 10, expected: 2},
+		{value: "25%", total: 10, roundUp: true, expected: 3},
+		{value: "100%", total: 3, expected: 3},
+		{value: "invalid", total: 10, expected: 0},
+	}
+	for _, tc := range testCases {
+		if actual := scaledValue(tc.value, tc.total, tc.roundUp); actual != tc.expected {
+			t.Fatalf("scaledValue(%q, %d, %t): expected %d, got %d", tc.value, tc.total, tc.roundUp, tc.expected, actual)
+		}
+	}
+}
+
+func TestGetRolloutCapacity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		obj      string
+		expected rolloutCapacity
+	}{
+		{
+			name:     "deployment with default strategy",
+			obj:      `{"kind": "Deployment", "spec": {"replicas": 10}, "status": {"readyReplicas": 10}}`,
+			expected: rolloutCapacity{desired: 10, ready: 10, minAvailable: 8},
+		},
+		{
+			name:     "deployment with pods that are not ready",
+			obj:      `{"kind": "Deployment", "spec": {"replicas": 10}, "status": {"readyReplicas": 6}}`,
+			expected: rolloutCapacity{desired: 10, ready: 6, minAvailable: 6},
+		},
+		{
+			name:     "deployment without surge or unavailability",
+			obj:      `{"kind": "Deployment", "spec": {"replicas": 2, "strategy": {"rollingUpdate": {"maxUnavailable": 0, "maxSurge": 0}}}, "status": {"readyReplicas": 2}}`,
+			expected: rolloutCapacity{desired: 2, ready: 2, minAvailable: 1},
+		},
+		{
+			name:     "recreate deployment",
+			obj:      `{"kind": "Deployment", "spec": {"replicas": 3, "strategy": {"type": "Recreate"}}, "status": {"readyReplicas": 3}}`,
+			expected: rolloutCapacity{desired: 3, ready: 3, minAvailable: 0},
+		},
+		{
+			name:     "statefulset",
+			obj:      `{"kind": "StatefulSet", "spec": {"replicas": 3}, "status": {"readyReplicas": 3}}`,
+			expected: rolloutCapacity{desired: 3, ready: 3, minAvailable: 2},
+		},
+		{
+			name:     "daemonset",
+			obj:      `{"kind": "DaemonSet", "spec": {"updateStrategy": {"rollingUpdate": {"maxUnavailable": "10%"}}}, "status": {"desiredNumberScheduled": 15, "numberReady": 15}}`,
+			expected: rolloutCapacity{desired: 15, ready: 15, minAvailable: 13},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, ok := getRolloutCapacity(decodeTestObject(t, tc.obj))
+			if !ok || actual != tc.expected {
+				t.Fatalf("expected %+v, got %+v", tc.expected, actual)
+			}
+		})
+	}
+	if _, ok := getRolloutCapacity(decodeTestObject(t, `{"kind": "Job"}`)); ok {
+		t.Fatalf("expected no capacity for a job")
+	}
+}
+
+func TestPrintRolloutRisk(t *testing.T) {
+	const live = `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api"}, "spec": {"replicas": 4, "template": {"spec": {"containers": [{"name": "app", "image": "app:1"}]}}}, "status": {"readyReplicas": 4}}`
+	const merged = `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api"}, "spec": {"replicas": 4, "strategy": {"rollingUpdate": {"maxUnavailable": "50%"}}, "template": {"spec": {"containers": [{"name": "app", "image": "app:2"}]}}}, "status": {"readyReplicas": 4}}`
+	const liveSts = `{"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"name": "db"}, "spec": {"replicas": 3, "updateStrategy": {"type": "OnDelete"}, "template": {"spec": {"containers": [{"name": "db", "image": "db:1"}]}}}, "status": {"readyReplicas": 2}}`
+	const mergedSts = `{"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"name": "db"}, "spec": {"replicas": 3, "updateStrategy": {"type": "OnDelete"}, "template": {"spec": {"containers": [{"name": "db", "image": "db:2"}]}}}, "status": {"readyReplicas": 2}}`
+
+	o := confirmOptions{
+		policy: &policy{RolloutMinAvailable: 75},
+		preview: []previewObject{
+			{live: decodeTestObject(t, live), merged: decodeTestObject(t, merged)},
+			{live: decodeTestObject(t, liveSts), merged: decodeTestObject(t, mergedSts)},
+			{live: decodeTestObject(t, live), merged: decodeTestObject(t, live)},
+			{merged: decodeTestObject(t, merged)},
+		},
+	}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	o.printRolloutRisk(cmd)
+	expected := `========== Rollout Risk =====
+deployment.apps/api will restart 4 pod(s)
+  Strategy:  RollingUpdate (maxUnavailable: 50%, maxSurge: 25%)
+  Ready:     4/4
+  Available: at least 2 of 4 pods (50%) during the rollout
+statefulset.apps/db will not restart any pods
+  Strategy:  OnDelete (pods are only replaced when they are deleted)
+  Ready:     2/3
+WARNING: deployment.apps/api may have only 2 of 4 pods (50%) available during the rollout, which is below the minimum of 75%
+WARNING: statefulset.apps/db uses the OnDelete update strategy, so its pods keep running the old pod template until they are deleted
+
+`
+	if stdout.String() != expected {
+		t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+
+	o = confirmOptions{preview: o.preview[2:]}
+	cmd, _, stdout, _ = util.NewTestCommand()
+	o.printRolloutRisk(cmd)
+	if stdout.Len() > 0 {
+		t.Fatalf("expected nothing to be printed, got:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+// The file in the directory of a change that has the objects as they were before the change
+const changeSnapshotFile = "snapshot.yaml"
+
+// Delete flags that are not accepted by kubectl get, or that would change the output format
+var deleteOnlyFlags = []string{"all", "cascade", "dry-run", "force", "grace-period", "interactive", "now", "output", "raw", "timeout", "wait"}
+
+// Metadata fields that are set by the server, which are removed from the snapshot so that it can be applied
+var serverMetadataFields = []string{
+	"creationTimestamp", "deletionGracePeriodSeconds", "deletionTimestamp", "generation", "managedFields", "resourceVersion", "selfLink", "uid",
+}
+
+// getDeletedObjects gets the objects that the delete command deletes, so that they can be re-created by a rollback
+func (o *confirmOptions) getDeletedObjects(cmd *cobra.Command) error {
+	args := append([]string{"get"}, o.args.Operands()...)
+	args = append(args, o.args.FlagArgs(func(f kubeargs.Flag) bool {
+		return !containsString(deleteOnlyFlags, f.Name) && f.Name != "ignore-not-found"
+	})...)
+	args = append(args, "--ignore-not-found", "-o", "json")
+	var result map[string]interface{}
+	if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), args, o.manifestInput(cmd), &result); err != nil {
+		return err
+	}
+	o.deletedObjects = util.ObjectItems(result)
+	return nil
+}
+
+// snapshotObjects returns the objects affected by the command that exist now, as the preview got them, without the
+// fields set by the server. Objects that the command creates are not included.
+func (o *confirmOptions) snapshotObjects() []map[string]interface{} {
+	var live []map[string]interface{}
+	for _, p := range o.preview {
+		if p.live != nil {
+			live = append(live, p.live)
+		}
+	}
+	live = append(live, o.rolloutObjects...)
+	live = append(live, o.deletedObjects...)
+
+	seen := map[string]bool{}
+	objs := make([]map[string]interface{}, 0, len(live))
+	for _, obj := range live {
+		if key := objectKey(obj); !seen[key] {
+			seen[key] = true
+			obj = copyObject(obj)
+			metadata := util.NestedMap(obj, "metadata")
+			for _, field := range serverMetadataFields {
+				delete(metadata, field)
+			}
+			delete(obj, "status")
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+// saveSnapshot saves the objects affected by the command, as they are before it is executed, in the directory of the
+// change in the history. It returns true if a snapshot was saved, along with the Secrets that were left out of it,
+// because snapshotSecrets is not enabled in the policy. A failure to save it is only a warning, because the command has
+// already been confirmed.
+func (o *confirmOptions) saveSnapshot(cmd *cobra.Command) (bool, []objectRef) {
+	historyDir := getHistoryDir()
+	if len(historyDir) == 0 {
+		return false, nil
+	}
+	var docs []string
+	var unsaved []objectRef
+	for _, obj := range o.snapshotObjects() {
+		if secretRedactionRule.appliesTo(obj) && !o.policy.snapshotSecrets() {
+			unsaved = append(unsaved, objectRef{
+				Resource:  qualifiedResourceName(obj),
+				Namespace: util.NestedString(obj, "metadata", "namespace"),
+			})
+			continue
+		}
+		docs = append(docs, yaml.Marshal(obj))
+	}
+	if len(docs) == 0 {
+		return false, unsaved
+	}
+	dir := filepath.Join(historyDir, o.changeID())
+	err := os.MkdirAll(dir, 0700)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, changeSnapshotFile), []byte(strings.Join(docs, "---\n")), 0600)
+	}
+	if err != nil {
+		cmd.PrintErrf("Warning: the objects could not be saved for a rollback: %v\n", err)
+		return false, unsaved
+	}
+	return true, unsaved
+}
+
+// rollbackArgs returns the kubectl command that restores the objects of a change from its snapshot, given the args of
+// kubectl confirm rollback, along with the record of the change. The snapshot is applied, which re-creates the objects
+// that were deleted and re-applies the old spec of the objects that were changed, but does not delete the objects that
+// were created. A change that affected Secrets which were left out of its snapshot cannot be rolled back. It targets the cluster the change was made in, with its context and connection flags, unless the
+// context or any connection flag is specified for the rollback.
+func rollbackArgs(args []string) ([]string, *changeRecord, error) {
+	parsed := kubeargs.Parse(args)
+	operands := parsed.Operands()
+	if len(operands) != 1 {
+		return nil, nil, fmt.Errorf("expected the ID of a change, like: kubectl confirm rollback 20240102-150405-1a2b3c")
+	}
+	id := operands[0]
+	if parsed.Has("contexts") || parsed.Has("confirm-namespaces") || parsed.Has("confirm-namespace-selector") {
+		return nil, nil, fmt.Errorf("rollback cannot be used with --contexts, --confirm-namespaces, or --confirm-namespace-selector")
+	}
+
+	historyDir := getHistoryDir()
+	record, err := loadChangeRecord(historyDir, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(record.UnsavedSecrets) > 0 {
+		return nil, nil, fmt.Errorf("change %s cannot be rolled back, because it affected Secrets, which were not saved in its snapshot "+
+			"because snapshotSecrets is not enabled in the policy:\n  %s", id, strings.Join(record.unsavedSecrets(), "\n  "))
+	}
+	snapshot := filepath.Join(historyDir, id, changeSnapshotFile)
+	if _, err := os.Stat(snapshot); err != nil {
+		if len(record.Created) > 0 {
+			return nil, nil, fmt.Errorf("change %s has no snapshot, so it cannot be rolled back, but the objects it created can be deleted with:\n  %s",
+				id, strings.Join(record.deleteCreatedCommands(), "\n  "))
+		}
+		return nil, nil, fmt.Errorf("change %s has no snapshot, so it cannot be rolled back", id)
+	}
+
+	rollback := append([]string{"apply", "--filename", snapshot}, parsed.FlagArgs(func(f kubeargs.Flag) bool {
+		return true
+	})...)
+	overridden := parsed.Has("context")
+	for _, name := range connectionFlags {
+		overridden = overridden || parsed.Has(name)
+	}
+	if !overridden {
+		if len(record.Context) > 0 {
+			rollback = append(rollback, "--context="+record.Context)
+		}
+		rollback = append(rollback, record.ConnectionFlags...)
+	}
+	return rollback, record, nil
+}
+
+// printCreatedObjects warns that the rollback of a change does not delete the objects that the change created, and
+// shows how to delete them
+func printCreatedObjects(cmd *cobra.Command, record *changeRecord) {
+	if len(record.Created) == 0 {
+		return
+	}
+	cmd.PrintErrf("Warning: the rollback does not delete the objects that change %s created, which can be deleted with:\n", record.ID)
+	for _, command := range record.deleteCreatedCommands() {
+		cmd.PrintErrf("  %s\n", command)
+	}
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestGetDeletedObjects(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRun(`{"kind": "List", "items": [{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "foo", "namespace": "x"}}]}`, "", nil)
+
+	o := &confirmOptions{}
+	o.parseArgs([]string{"delete", "pod", "foo", "-n", "x", "--grace-period=0", "--wait=false", "--ignore-not-found", "--context=ctx"})
+	cmd, _, _, _ := util.NewTestCommand()
+	if err := o.getDeletedObjects(cmd); err != nil {
+		t.Fatal(err)
+	}
+	expectedArgs := []string{"get", "pod", "foo", "--namespace=x", "--context=ctx", "--ignore-not-found", "-o", "json"}
+	if !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), expectedArgs) {
+		t.Fatalf("wrong args.\nexpected: %v\ngot: %v", expectedArgs, fakeExecRunner.LastRunArgs())
+	}
+	if len(o.deletedObjects) != 1 || util.ObjectName(o.deletedObjects[0]) != "pod/foo" {
+		t.Fatalf("wrong deleted objects: %v", o.deletedObjects)
+	}
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	const live = `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a", "namespace": "x", "uid": "123", "resourceVersion": "5", "creationTimestamp": "2024-01-02T15:04:05Z", "managedFields": [{"manager": "kubectl"}]}, "data": {"k": "old"}}`
+	const merged = `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a", "namespace": "x", "uid": "123"}, "data": {"k": "new"}}`
+	const created = `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "b", "namespace": "x"}, "data": {"k": "v"}}`
+	const deleted = `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "c", "namespace": "x"}, "spec": {"nodeName": "node-1"}, "status": {"phase": "Running"}}`
+	const secret = `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "d", "namespace": "x"}, "data": {"password": "aHVudGVyMg=="}}`
+
+	testCases := []struct {
+		name            string
+		options         *confirmOptions
+		expected        string
+		expectedUnsaved []objectRef
+	}{
+		{
+			name: "changed objects",
+			options: &confirmOptions{preview: []previewObject{
+				{live: decodeTestObject(t, live), merged: decodeTestObject(t, merged)},
+				{merged: decodeTestObject(t, created)},
+			}},
+			expected: "apiVersion: v1\ndata:\n  k: old\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: x\n",
+		},
+		{
+			name:     "deleted objects",
+			options:  &confirmOptions{deletedObjects: []map[string]interface{}{decodeTestObject(t, deleted), decodeTestObject(t, deleted)}},
+			expected: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: c\n  namespace: x\nspec:\n  nodeName: node-1\n",
+		},
+		{
+			name: "changed and deleted objects",
+			options: &confirmOptions{
+				preview:        []previewObject{{live: decodeTestObject(t, live), merged: decodeTestObject(t, merged)}},
+				deletedObjects: []map[string]interface{}{decodeTestObject(t, deleted)},
+			},
+			expected: "apiVersion: v1\ndata:\n  k: old\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: x\n---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: c\n  namespace: x\nspec:\n  nodeName: node-1\n",
+		},
+		{
+			name:    "only created objects",
+			options: &confirmOptions{preview: []previewObject{{merged: decodeTestObject(t, created)}}},
+		},
+		{
+			name: "secrets are left out",
+			options: &confirmOptions{
+				preview:        []previewObject{{live: decodeTestObject(t, live), merged: decodeTestObject(t, merged)}},
+				deletedObjects: []map[string]interface{}{decodeTestObject(t, secret)},
+			},
+			expected:        "apiVersion: v1\ndata:\n  k: old\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: x\n",
+			expectedUnsaved: []objectRef{{Resource: "secret/d", Namespace: "x"}},
+		},
+		{
+			name:            "only secrets",
+			options:         &confirmOptions{deletedObjects: []map[string]interface{}{decodeTestObject(t, secret)}},
+			expectedUnsaved: []objectRef{{Resource: "secret/d", Namespace: "x"}},
+		},
+		{
+			name: "secrets are saved if the policy allows it",
+			options: &confirmOptions{
+				policy:         &policy{SnapshotSecrets: true},
+				deletedObjects: []map[string]interface{}{decodeTestObject(t, secret)},
+			},
+			expected: "apiVersion: v1\ndata:\n  password: aHVudGVyMg==\nkind: Secret\nmetadata:\n  name: d\n  namespace: x\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := useTestHistoryDir(t)
+			cmd, _, _, stderr := util.NewTestCommand()
+			saved, unsaved := tc.options.saveSnapshot(cmd)
+			if stderr.Len() > 0 {
+				t.Fatalf("unexpected stderr: %s", stderr.String())
+			}
+			if !reflect.DeepEqual(unsaved, tc.expectedUnsaved) {
+				t.Fatalf("wrong unsaved secrets.\nexpected: %v\ngot: %v", tc.expectedUnsaved, unsaved)
+			}
+			if saved != (len(tc.expected) > 0) {
+				t.Fatalf("expected a snapshot to be saved: %t, got %t", len(tc.expected) > 0, saved)
+			}
+			if !saved {
+				return
+			}
+			file := filepath.Join(dir, tc.options.changeID(), changeSnapshotFile)
+			actual, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != tc.expected {
+				t.Fatalf("wrong snapshot.\nexpected:\n%s\ngot:\n%s", tc.expected, string(actual))
+			}
+			if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+				t.Fatalf("expected the snapshot to be private, got %v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestRollbackArgs(t *testing.T) {
+	dir := useTestHistoryDir(t)
+	const id = "20240102-150405-1a2b3c"
+	const noSnapshotID = "20240102-150405-000000"
+	const createdID = "20240102-150405-000001"
+	const secretsID = "20240102-150405-000002"
+	records := []*changeRecord{
+		{ID: id, Verb: "apply", Context: "prod", Snapshot: true, ConnectionFlags: []string{"--kubeconfig=/home/foo/.kube/prod", "--user=admin"}},
+		{ID: noSnapshotID, Verb: "create", Context: "prod"},
+		{ID: createdID, Verb: "create", Context: "prod", ConnectionFlags: []string{"--kubeconfig=/home/foo/.kube/prod"}, Created: []objectRef{
+			{Resource: "deployment.v1.apps/foo", Namespace: "bar"},
+			{Resource: "namespace/bar"},
+		}},
+		{ID: secretsID, Verb: "delete", Context: "prod", Snapshot: true, UnsavedSecrets: []objectRef{
+			{Resource: "secret/foo", Namespace: "bar"},
+			{Resource: "secret/baz", Namespace: "bar"},
+		}},
+	}
+	for _, r := range records {
+		if err := saveChangeRecord(dir, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot := filepath.Join(dir, id, changeSnapshotFile)
+	for _, file := range []string{snapshot, filepath.Join(dir, secretsID, changeSnapshotFile)} {
+		if err := os.WriteFile(file, []byte("kind: ConfigMap\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		args          []string
+		expected      []string
+		expectedError string
+	}{
+		{
+			args:     []string{"rollback", id},
+			expected: []string{"apply", "--filename", snapshot, "--context=prod", "--kubeconfig=/home/foo/.kube/prod", "--user=admin"},
+		},
+		{
+			args:     []string{"rollback", id, "--context=staging", "--confirm-verify"},
+			expected: []string{"apply", "--filename", snapshot, "--context=staging", "--confirm-verify"},
+		},
+		{
+			args:     []string{"rollback", id, "--kubeconfig", "/tmp/config"},
+			expected: []string{"apply", "--filename", snapshot, "--kubeconfig=/tmp/config"},
+		},
+		{
+			args:          []string{"rollback"},
+			expectedError: "expected the ID of a change, like: kubectl confirm rollback 20240102-150405-1a2b3c",
+		},
+		{
+			args:          []string{"rollback", id, "--contexts=a,b"},
+			expectedError: "rollback cannot be used with --contexts, --confirm-namespaces, or --confirm-namespace-selector",
+		},
+		{
+			args:          []string{"rollback", noSnapshotID},
+			expectedError: "change 20240102-150405-000000 has no snapshot, so it cannot be rolled back",
+		},
+		{
+			args: []string{"rollback", createdID},
+			expectedError: "change 20240102-150405-000001 has no snapshot, so it cannot be rolled back, but the objects it created can be deleted with:\n" +
+				"  kubectl delete deployment.v1.apps/foo --namespace=bar --context=prod --kubeconfig=/home/foo/.kube/prod\n" +
+				"  kubectl delete namespace/bar --context=prod --kubeconfig=/home/foo/.kube/prod",
+		},
+		{
+			args: []string{"rollback", secretsID},
+			expectedError: "change 20240102-150405-000002 cannot be rolled back, because it affected Secrets, which were not saved in its snapshot " +
+				"because snapshotSecrets is not enabled in the policy:\n" +
+				"  secret/foo (namespace bar)\n" +
+				"  secret/baz (namespace bar)",
+		},
+	}
+	for _, tc := range testCases {
+		actual, record, err := rollbackArgs(tc.args)
+		if len(tc.expectedError) > 0 {
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+			}
+			continue
+		}
+		if err != nil || record.ID != id || !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("wrong rollback args.\nexpected: %v\ngot: %v, %v, %v", tc.expected, actual, record, err)
+		}
+	}
+}
+
+func TestRunRollback(t *testing.T) {
+	dir := useTestHistoryDir(t)
+	const id = "20240102-150405-1a2b3c"
+	if err := saveChangeRecord(dir, &changeRecord{ID: id, Verb: "delete", Context: "prod", Snapshot: true, Created: []objectRef{{Resource: "configmap/baz", Namespace: "bar"}}}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(dir, id, changeSnapshotFile)
+	if err := os.WriteFile(snapshot, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n  namespace: bar\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("config"), `{"current-context": "prod", "contexts": [{"name": "prod", "context": {}}]}`, "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("--dry-run=server"), `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "bar"}}`, "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), "", "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("--ignore-not-found"), "", "", nil)
+	fakeExecRunner.SetupRunMatching(util.ArgsContain("can-i"), "yes\n", "", nil)
+	fakeExecRunner.SetupRun("configmap/foo created\n", "", nil)
+
+	o := &confirmOptions{}
+	cmd, stdin, stdout, stderr := util.NewTestCommand()
+	stdin.WriteString("yes\n")
+	if err := o.run(cmd, []string{"rollback", id}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "the objects that change " + id + " created, which can be deleted with:\n  kubectl delete configmap/baz --namespace=bar --context=prod\n"; !strings.Contains(stderr.String(), expected) {
+		t.Fatalf("expected stderr to contain %q, got:\n%s", expected, stderr.String())
+	}
+
+	expectedArgs := []string{"apply", "--filename", snapshot, "--context=prod"}
+	if !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), expectedArgs) {
+		t.Fatalf("wrong kubectl args.\nexpected: %v\ngot: %v", expectedArgs, fakeExecRunner.LastRunArgs())
+	}
+	if !strings.Contains(stdout.String(), "configmap/foo created (server dry run)") {
+		t.Fatalf("expected the rollback to be previewed, got:\n%s", stdout.String())
+	}
+	record, err := loadChangeRecord(dir, o.changeID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Verb != "rollback" || record.RollbackOf != id || record.Result != changeResultSucceeded {
+		t.Fatalf("wrong record of the rollback: %+v", record)
+	}
+}
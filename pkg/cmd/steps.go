@@ -0,0 +1,157 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// The time a preview step is allowed to take before it is cancelled, unless the policy sets a different timeout
+const defaultStepTimeout = 60 * time.Second
+
+// How often the progress line is updated
+var progressInterval = 100 * time.Millisecond
+
+var progressFrames = []string{"|", "/", "-", "\\"}
+
+// previewStep is a part of the preview, which prints one or more sections
+type previewStep struct {
+	name    string
+	timeout time.Duration
+	run     func(cmd *cobra.Command) error
+}
+
+// stepFailure is a preview step that failed, when the policy allows confirming the command anyway
+type stepFailure struct {
+	name string
+	err  error
+}
+
+type stepResult struct {
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	err    error
+}
+
+// runSteps runs the steps concurrently, each with its own timeout. Their output is buffered and printed in the order
+// of the steps once all of them are done, so the sections are always shown in the same order. If a step fails, the
+// output of the steps before it and the failed step itself is printed, and its error is returned, unless the policy
+// allows previews to fail and the step did not find that the command is not permitted. In that case, the failure is
+// shown in place of the rest of the step's output, recorded in failedSteps, and the remaining steps are printed. While
+// steps are running, a progress line is shown on stderr if it is a terminal. All steps are cancelled on the signals of
+// the command, which are SIGINT and SIGTERM unless it is embedded, and errInterrupted is returned.
+func (o *confirmOptions) runSteps(cmd *cobra.Command, steps []previewStep) error {
+	results := make([]*stepResult, len(steps))
+	err := runInterruptible(cmd, o.signals(), func(ctx context.Context) error {
+		done := make(chan int)
+		for i, step := range steps {
+			results[i] = &stepResult{}
+			if step.timeout == 0 {
+				step.timeout = o.policy.stepTimeout(step.name)
+			}
+			go func(i int, step previewStep) {
+				results[i].err = runStep(ctx, cmd, step, results[i])
+				done <- i
+			}(i, step)
+		}
+
+		showProgress := util.IsTerminal(cmd.ErrOrStderr())
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		pending := make([]bool, len(steps))
+		for i := range pending {
+			pending[i] = true
+		}
+		for frame, remaining := 0, len(steps); remaining > 0; {
+			select {
+			case i := <-done:
+				pending[i] = false
+				remaining--
+			case <-ticker.C:
+				if showProgress {
+					var names []string
+					for i, step := range steps {
+						if pending[i] {
+							names = append(names, step.name)
+						}
+					}
+					cmd.PrintErrf("\r\033[K%s Waiting for %s", progressFrames[frame%len(progressFrames)], strings.Join(names, ", "))
+					frame++
+				}
+			}
+		}
+		if showProgress {
+			cmd.PrintErr("\r\033[K")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		cmd.Print(result.stdout.String())
+		cmd.PrintErr(result.stderr.String())
+		if result.err == nil {
+			continue
+		}
+		var permissionDenied *permissionDeniedError
+		if !o.policy.warnOnPreviewFailure() || errors.As(result.err, &permissionDenied) {
+			return result.err
+		}
+		cmd.Printf("*** Preview unavailable: %s ***\n\n", strings.TrimSpace(result.err.Error()))
+		o.failedSteps = append(o.failedSteps, stepFailure{name: steps[i].name, err: result.err})
+	}
+	return nil
+}
+
+// hasFailedStep returns true if the named step failed
+func (o *confirmOptions) hasFailedStep(name string) bool {
+	for _, f := range o.failedSteps {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runStep runs a step with its own context and output, so that it can run concurrently with the other steps
+func runStep(ctx context.Context, cmd *cobra.Command, step previewStep, result *stepResult) error {
+	timeout := step.timeout
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stepCmd := &cobra.Command{}
+	stepCmd.SetContext(stepCtx)
+	stepCmd.SetIn(cmd.InOrStdin())
+	stepCmd.SetOut(&result.stdout)
+	stepCmd.SetErr(&result.stderr)
+	err := step.run(stepCmd)
+	if err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s did not finish within %s", step.name, timeout)
+	}
+	return err
+}
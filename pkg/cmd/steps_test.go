@@ -0,0 +1,187 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestRunSteps(t *testing.T) {
+	// Each step waits for the next one to finish, so they finish in reverse order
+	second, third := make(chan struct{}), make(chan struct{})
+	printAfter := func(wait, finish chan struct{}, output string) func(cmd *cobra.Command) error {
+		return func(cmd *cobra.Command) error {
+			if wait != nil {
+				<-wait
+			}
+			cmd.Print(output)
+			if finish != nil {
+				close(finish)
+			}
+			return nil
+		}
+	}
+
+	steps := []previewStep{
+		{name: "first", run: printAfter(second, nil, "first\n")},
+		{name: "second", run: printAfter(third, second, "second\n")},
+		{name: "third", run: printAfter(nil, third, "third\n")},
+	}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	if err := (&confirmOptions{}).runSteps(cmd, steps); err != nil {
+		t.Fatalf("runSteps failed: %v", err)
+	}
+	if stdout.String() != "first\nsecond\nthird\n" {
+		t.Fatalf("expected the output in the order of the steps, got:\n%s", stdout.String())
+	}
+}
+
+func TestRunStepsError(t *testing.T) {
+	steps := []previewStep{
+		{name: "first", run: func(cmd *cobra.Command) error {
+			cmd.Print("first\n")
+			return nil
+		}},
+		{name: "second", run: func(cmd *cobra.Command) error {
+			cmd.Print("second\n")
+			return fmt.Errorf("second failed")
+		}},
+		{name: "third", run: func(cmd *cobra.Command) error {
+			cmd.Print("third\n")
+			return nil
+		}},
+	}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	err := (&confirmOptions{}).runSteps(cmd, steps)
+	if err == nil || err.Error() != "second failed" {
+		t.Fatalf("expected the error of the failed step, got: %v", err)
+	}
+	if stdout.String() != "first\nsecond\n" {
+		t.Fatalf("expected the output up to the failed step, got:\n%s", stdout.String())
+	}
+}
+
+func TestRunStepsPreviewFailureWarn(t *testing.T) {
+	steps := []previewStep{
+		{name: "config", run: func(cmd *cobra.Command) error {
+			cmd.Print("config\n")
+			return nil
+		}},
+		{name: "dry run", run: func(cmd *cobra.Command) error {
+			cmd.Print("dry run\n")
+			return fmt.Errorf("Error from server: failed calling webhook\n")
+		}},
+		{name: "target", run: func(cmd *cobra.Command) error {
+			cmd.Print("target\n")
+			return nil
+		}},
+	}
+	o := &confirmOptions{policy: &policy{PreviewFailure: previewFailureWarn}}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	if err := o.runSteps(cmd, steps); err != nil {
+		t.Fatalf("runSteps failed: %v", err)
+	}
+	expectedOutput := "config\ndry run\n*** Preview unavailable: Error from server: failed calling webhook ***\n\ntarget\n"
+	if stdout.String() != expectedOutput {
+		t.Fatalf("expected the failure in place of the failed step, got:\n%s", stdout.String())
+	}
+	if len(o.failedSteps) != 1 || !o.hasFailedStep("dry run") {
+		t.Fatalf("expected the dry run to be recorded as failed, got %v", o.failedSteps)
+	}
+}
+
+func TestRunStepsPermissionDenied(t *testing.T) {
+	steps := []previewStep{
+		{name: "permissions", run: func(cmd *cobra.Command) error {
+			return &permissionDeniedError{denied: []string{"delete pod/foo"}}
+		}},
+	}
+	o := &confirmOptions{policy: &policy{PreviewFailure: previewFailureWarn}}
+	cmd, _, _, _ := util.NewTestCommand()
+	err := o.runSteps(cmd, steps)
+	if err == nil || err.Error() != "not allowed to delete pod/foo" {
+		t.Fatalf("expected the command to be aborted even though previews may fail, got: %v", err)
+	}
+}
+
+func TestRunStepsPolicyTimeout(t *testing.T) {
+	steps := []previewStep{
+		{name: "slow", run: func(cmd *cobra.Command) error {
+			<-cmd.Context().Done()
+			return cmd.Context().Err()
+		}},
+	}
+	o := &confirmOptions{policy: &policy{timeouts: map[string]time.Duration{"slow": 10 * time.Millisecond}}}
+	cmd, _, _, _ := util.NewTestCommand()
+	err := o.runSteps(cmd, steps)
+	if err == nil || err.Error() != "slow did not finish within 10ms" {
+		t.Fatalf("expected a timeout error, got: %v", err)
+	}
+}
+
+func TestRunStepsTimeout(t *testing.T) {
+	steps := []previewStep{
+		{name: "slow", timeout: 10 * time.Millisecond, run: func(cmd *cobra.Command) error {
+			<-cmd.Context().Done()
+			return cmd.Context().Err()
+		}},
+	}
+	cmd, _, _, _ := util.NewTestCommand()
+	err := (&confirmOptions{}).runSteps(cmd, steps)
+	if err == nil || err.Error() != "slow did not finish within 10ms" {
+		t.Fatalf("expected a timeout error, got: %v", err)
+	}
+}
+
+func TestRunStepsProgress(t *testing.T) {
+	isTerminal, interval := util.IsTerminal, progressInterval
+	defer func() {
+		util.IsTerminal, progressInterval = isTerminal, interval
+	}()
+	util.IsTerminal = func(w io.Writer) bool {
+		return true
+	}
+	progressInterval = time.Millisecond
+
+	steps := []previewStep{
+		{name: "config", run: func(cmd *cobra.Command) error {
+			return nil
+		}},
+		{name: "dry run", run: func(cmd *cobra.Command) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}},
+	}
+	cmd, _, _, stderr := util.NewTestCommand()
+	if err := (&confirmOptions{}).runSteps(cmd, steps); err != nil {
+		t.Fatalf("runSteps failed: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "Waiting for dry run") {
+		t.Fatalf("expected a progress line, got %q", stderr.String())
+	}
+	if !strings.HasSuffix(stderr.String(), "\r\033[K") {
+		t.Fatalf("expected the progress line to be erased, got %q", stderr.String())
+	}
+}
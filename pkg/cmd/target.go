@@ -0,0 +1,307 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// Commands that run against a pod or node, and therefore have a target summary
+var targetCommands = map[string]bool{
+	"cp":           true,
+	"debug":        true,
+	"exec":         true,
+	"port-forward": true,
+}
+
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+func (o *confirmOptions) target(cmd *cobra.Command, commandName string) error {
+	util.PrintSectionTitle(cmd, "Target")
+	defer cmd.Println()
+
+	positional := o.args.Operands()
+	if len(positional) == 0 {
+		return fmt.Errorf("expected a target for %s", commandName)
+	}
+
+	switch commandName {
+	case "exec":
+		if err := o.printPodTarget(cmd, positional[0], o.namespace, o.args.Value("container")); err != nil {
+			return err
+		}
+		if command := o.args.AfterDash(); len(command) > 0 {
+			cmd.Printf("%-11s %s\n", "Command:", strings.Join(command, " "))
+		}
+	case "port-forward":
+		if err := o.printPodTarget(cmd, positional[0], o.namespace, ""); err != nil {
+			return err
+		}
+		address := o.args.Value("address")
+		if len(address) == 0 {
+			address = "localhost"
+		}
+		cmd.Printf("%-11s %s\n", "Address:", address)
+		cmd.Printf("%-11s %s\n", "Ports:", describePortForwards(positional[1:]))
+	case "cp":
+		return o.printCopyTarget(cmd, positional, o.args.Value("container"))
+	case "debug":
+		return o.printDebugTarget(cmd, positional[0])
+	}
+	return nil
+}
+
+func (o *confirmOptions) printCopyTarget(cmd *cobra.Command, positional []string, container string) error {
+	if len(positional) < 2 {
+		return fmt.Errorf("expected a source and destination for cp")
+	}
+	src, dst := positional[0], positional[1]
+
+	var remote, local, direction string
+	switch {
+	case isRemoteCopySpec(src):
+		remote, local, direction = src, dst, "download (from pod to local)"
+	case isRemoteCopySpec(dst):
+		remote, local, direction = dst, src, "upload (from local to pod)"
+	default:
+		return fmt.Errorf("expected either the source or destination of cp to be a pod")
+	}
+
+	podRef, remotePath, _ := strings.Cut(remote, ":")
+	namespace := o.namespace
+	if ns, name, found := strings.Cut(podRef, "/"); found {
+		namespace, podRef = ns, name
+	}
+
+	if err := o.printPodTarget(cmd, podRef, namespace, container); err != nil {
+		return err
+	}
+	cmd.Printf("%-11s %s\n", "Direction:", direction)
+	cmd.Printf("%-11s %s\n", "Local:", local)
+	cmd.Printf("%-11s %s\n", "Remote:", remotePath)
+	return nil
+}
+
+func (o *confirmOptions) printDebugTarget(cmd *cobra.Command, ref string) error {
+	image := o.args.Value("image")
+	if len(image) == 0 {
+		image = "(none, --image is required unless --copy-to is used with --set-image)"
+	}
+
+	if resource, name, found := strings.Cut(ref, "/"); found && (resource == "node" || resource == "nodes" || resource == "no") {
+		cmd.Printf("%-11s %s\n", "Node:", name)
+		cmd.Printf("%-11s %s\n", "Image:", image)
+		cmd.Printf("%-11s %s\n", "Mode:", "a new pod will be created on the node, with the node's filesystem mounted at /host")
+		return nil
+	}
+
+	if err := o.printPodTarget(cmd, ref, o.namespace, o.args.Value("target")); err != nil {
+		return err
+	}
+	cmd.Printf("%-11s %s\n", "Image:", image)
+	if copyTo := o.args.Value("copy-to"); len(copyTo) > 0 {
+		cmd.Printf("%-11s %s\n", "Mode:", fmt.Sprintf("a copy of the pod named %s will be created", copyTo))
+	} else {
+		cmd.Printf("%-11s %s\n", "Mode:", "an ephemeral container will be added to the pod")
+	}
+	return nil
+}
+
+// printPodTarget resolves the pod that ref refers to, in the same way kubectl does, and prints a summary of it
+func (o *confirmOptions) printPodTarget(cmd *cobra.Command, ref, namespace, container string) error {
+	pod, err := o.resolvePod(cmd, ref, namespace)
+	if err != nil {
+		return err
+	}
+	o.targetPod = pod
+
+	var containers []string
+	for _, c := range util.NestedSlice(pod, "spec", "containers") {
+		containers = append(containers, util.NestedString(c, "name"))
+	}
+	if len(container) == 0 {
+		container = util.NestedString(pod, "metadata", "annotations", defaultContainerAnnotation)
+	}
+	if len(container) == 0 && len(containers) > 0 {
+		container = containers[0]
+	}
+
+	cmd.Printf("%-11s %s\n", "Pod:", util.NestedString(pod, "metadata", "name"))
+	cmd.Printf("%-11s %s\n", "Namespace:", util.NestedString(pod, "metadata", "namespace"))
+	cmd.Printf("%-11s %s\n", "Node:", valueOrDefault(util.NestedString(pod, "spec", "nodeName"), "(not scheduled)"))
+	cmd.Printf("%-11s %s\n", "Containers:", strings.Join(containers, ", "))
+	cmd.Printf("%-11s %s\n", "Container:", container)
+	owner, err := o.getTopLevelOwner(cmd, pod)
+	if err != nil {
+		return err
+	}
+	cmd.Printf("%-11s %s\n", "Owner:", owner)
+	cmd.Printf("%-11s %s\n", "Labels:", valueOrDefault(formatLabels(util.NestedMap(pod, "metadata", "labels")), "(none)"))
+	return nil
+}
+
+func (o *confirmOptions) resolvePod(cmd *cobra.Command, ref, namespace string) (map[string]interface{}, error) {
+	lookupFlags := o.globalFlags()
+	if len(namespace) > 0 {
+		lookupFlags = append(lookupFlags, "--namespace="+namespace)
+	}
+
+	resource, name, found := strings.Cut(ref, "/")
+	if !found || resource == "pod" || resource == "pods" || resource == "po" {
+		if !found {
+			name = ref
+		}
+		var pod map[string]interface{}
+		err := util.ExecKubectlJSON(cmd.Context(), o.runner(), append([]string{"get", "pod", name, "-o", "json"}, lookupFlags...), cmd.InOrStdin(), &pod)
+		return pod, err
+	}
+
+	// Like kubectl, use the selector of the referenced object to find its pods
+	var obj map[string]interface{}
+	if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), append([]string{"get", ref, "-o", "json"}, lookupFlags...), cmd.InOrStdin(), &obj); err != nil {
+		return nil, err
+	}
+	selector := util.NestedMap(obj, "spec", "selector", "matchLabels")
+	if util.NestedString(obj, "kind") == "Service" {
+		selector = util.NestedMap(obj, "spec", "selector")
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("cannot find pods for %s because it has no selector", ref)
+	}
+	var pods map[string]interface{}
+	args := append([]string{"get", "pods", "--selector=" + formatLabels(selector), "-o", "json"}, lookupFlags...)
+	if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), args, cmd.InOrStdin(), &pods); err != nil {
+		return nil, err
+	}
+	items := util.ObjectItems(pods)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no pods found for %s", ref)
+	}
+	sortPods(items)
+	return items[0], nil
+}
+
+// sortPods sorts pods in the order that kubectl picks one of them for a workload: ready pods first, then running pods,
+// and then the newest pods
+func sortPods(pods []map[string]interface{}) {
+	rank := func(pod map[string]interface{}) int {
+		switch {
+		case podReady(pod):
+			return 0
+		case util.NestedString(pod, "status", "phase") == "Running":
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		if ri, rj := rank(pods[i]), rank(pods[j]); ri != rj {
+			return ri < rj
+		}
+		return util.NestedString(pods[i], "metadata", "creationTimestamp") > util.NestedString(pods[j], "metadata", "creationTimestamp")
+	})
+}
+
+// podReady returns true if the Ready condition of pod is true
+func podReady(pod map[string]interface{}) bool {
+	for _, c := range util.NestedSlice(pod, "status", "conditions") {
+		if condition, ok := c.(map[string]interface{}); ok && condition["type"] == "Ready" {
+			return condition["status"] == "True"
+		}
+	}
+	return false
+}
+
+// getTopLevelOwner returns the name of the workload that controls pod, following a ReplicaSet to its Deployment
+func (o *confirmOptions) getTopLevelOwner(cmd *cobra.Command, pod map[string]interface{}) (string, error) {
+	ref := controllerRef(pod)
+	if ref == nil {
+		return "(none)", nil
+	}
+	if util.NestedString(ref, "kind") == "ReplicaSet" {
+		var rs map[string]interface{}
+		args := append([]string{"get", "replicasets.apps", util.NestedString(ref, "name"), "--namespace=" + util.NestedString(pod, "metadata", "namespace"), "-o", "json"}, o.globalFlags()...)
+		if err := util.ExecKubectlJSON(cmd.Context(), o.runner(), args, cmd.InOrStdin(), &rs); err != nil {
+			return "", err
+		}
+		if rsRef := controllerRef(rs); rsRef != nil {
+			ref = rsRef
+		}
+	}
+	return util.ObjectName(map[string]interface{}{
+		"apiVersion": ref["apiVersion"],
+		"kind":       ref["kind"],
+		"metadata":   map[string]interface{}{"name": ref["name"]},
+	}), nil
+}
+
+func controllerRef(obj map[string]interface{}) map[string]interface{} {
+	for _, ref := range util.NestedSlice(obj, "metadata", "ownerReferences") {
+		if controller, _ := util.NestedField(ref, "controller").(bool); controller {
+			return ref.(map[string]interface{})
+		}
+	}
+	return nil
+}
+
+// isRemoteCopySpec returns true if a kubectl cp source or destination refers to a pod, like [namespace/]pod:path
+func isRemoteCopySpec(spec string) bool {
+	i := strings.Index(spec, ":")
+	// A single letter before the colon is a Windows drive letter, not a pod
+	return i > 1 || (i == 1 && !isLetter(spec[0]))
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func describePortForwards(ports []string) string {
+	var descriptions []string
+	for _, p := range ports {
+		local, remote, found := strings.Cut(p, ":")
+		switch {
+		case !found:
+			remote = local
+		case len(local) == 0:
+			local = "(random)"
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s -> %s", local, remote))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func formatLabels(labels map[string]interface{}) string {
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+const fakePod = `{
+	"apiVersion": "v1",
+	"kind": "Pod",
+	"metadata": {
+		"name": "foo-abc-123",
+		"namespace": "bar",
+		"labels": {"app": "foo", "env": "production"},
+		"ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "foo-abc", "controller": true}]
+	},
+	"spec": {
+		"nodeName": "node-1",
+		"containers": [{"name": "foo"}, {"name": "sidecar"}]
+	},
+	"status": {"phase": "Running"}
+}`
+
+const fakePodReplicaSet = `{
+	"apiVersion": "apps/v1",
+	"kind": "ReplicaSet",
+	"metadata": {
+		"name": "foo-abc",
+		"ownerReferences": [{"apiVersion": "apps/v1", "kind": "Deployment", "name": "foo", "controller": true}]
+	}
+}`
+
+const fakePodSummary = `Pod:        foo-abc-123
+Namespace:  bar
+Node:       node-1
+Containers: foo, sidecar
+`
+
+func TestTarget(t *testing.T) {
+	testCases := []struct {
+		name           string
+		options        confirmOptions
+		commandName    string
+		fakeOsArgs     []string
+		fakeRuns       []string
+		expectedArgs   [][]string
+		expectedStdout string
+	}{
+		{
+			name:        "exec into pod",
+			commandName: "exec",
+			fakeOsArgs:  []string{"confirm", "exec", "-it", "-n", "bar", "foo-abc-123", "--", "sh", "-c", "ls"},
+			fakeRuns:    []string{fakePod, fakePodReplicaSet},
+			expectedArgs: [][]string{
+				{"get", "pod", "foo-abc-123", "-o", "json", "--namespace=bar"},
+				{"get", "replicasets.apps", "foo-abc", "--namespace=bar", "-o", "json"},
+			},
+			expectedStdout: "========== Target ===========\n" + fakePodSummary + `Container:  foo
+Owner:      deployment.apps/foo
+Labels:     app=foo,env=production
+Command:    sh -c ls
+
+`,
+		},
+		{
+			name:        "exec into deployment uses its selector",
+			commandName: "exec",
+			fakeOsArgs:  []string{"confirm", "--context=ctx", "exec", "deploy/foo", "-c", "sidecar", "--", "date"},
+			fakeRuns: []string{
+				`{"kind": "Deployment", "spec": {"selector": {"matchLabels": {"app": "foo"}}}}`,
+				`{"kind": "List", "items": [{"metadata": {"name": "pending"}, "status": {"phase": "Pending"}}, ` + fakePod + `]}`,
+				fakePodReplicaSet,
+			},
+			expectedArgs: [][]string{
+				{"get", "deploy/foo", "-o", "json", "--context=ctx"},
+				{"get", "pods", "--selector=app=foo", "-o", "json", "--context=ctx"},
+				{"get", "replicasets.apps", "foo-abc", "--namespace=bar", "-o", "json", "--context=ctx"},
+			},
+			expectedStdout: "========== Target ===========\n" + fakePodSummary + `Container:  sidecar
+Owner:      deployment.apps/foo
+Labels:     app=foo,env=production
+Command:    date
+
+`,
+		},
+		{
+			name:        "exec into deployment picks the newest ready pod",
+			commandName: "exec",
+			fakeOsArgs:  []string{"confirm", "exec", "deploy/foo", "--", "date"},
+			fakeRuns: []string{
+				`{"kind": "Deployment", "spec": {"selector": {"matchLabels": {"app": "foo"}}}}`,
+				`{"kind": "List", "items": [` +
+					`{"metadata": {"name": "old", "creationTimestamp": "2024-01-01T00:00:00Z"}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "True"}]}}, ` +
+					`{"metadata": {"name": "new", "namespace": "bar", "creationTimestamp": "2024-01-02T00:00:00Z"}, "spec": {"containers": [{"name": "foo"}]}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "True"}]}}, ` +
+					`{"metadata": {"name": "newest", "creationTimestamp": "2024-01-03T00:00:00Z"}, "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "False"}]}}]}`,
+			},
+			expectedStdout: `========== Target ===========
+Pod:        new
+Namespace:  bar
+Node:       (not scheduled)
+Containers: foo
+Container:  foo
+Owner:      (none)
+Labels:     (none)
+Command:    date
+
+`,
+		},
+		{
+			name:        "port-forward",
+			commandName: "port-forward",
+			fakeOsArgs:  []string{"confirm", "port-forward", "pod/foo-abc-123", "8080:80", ":9090", "443", "--address", "0.0.0.0"},
+			fakeRuns:    []string{`{"metadata": {"name": "foo-abc-123", "namespace": "bar"}, "spec": {"containers": [{"name": "foo"}]}}`},
+			expectedArgs: [][]string{
+				{"get", "pod", "foo-abc-123", "-o", "json"},
+			},
+			expectedStdout: `========== Target ===========
+Pod:        foo-abc-123
+Namespace:  bar
+Node:       (not scheduled)
+Containers: foo
+Container:  foo
+Owner:      (none)
+Labels:     (none)
+Address:    0.0.0.0
+Ports:      8080 -> 80, (random) -> 9090, 443 -> 443
+
+`,
+		},
+		{
+			name:        "cp upload",
+			commandName: "cp",
+			fakeOsArgs:  []string{"confirm", "cp", "./local.txt", "bar/foo-abc-123:/tmp/remote.txt"},
+			fakeRuns:    []string{fakePod, fakePodReplicaSet},
+			expectedArgs: [][]string{
+				{"get", "pod", "foo-abc-123", "-o", "json", "--namespace=bar"},
+				{"get", "replicasets.apps", "foo-abc", "--namespace=bar", "-o", "json"},
+			},
+			expectedStdout: "========== Target ===========\n" + fakePodSummary + `Container:  foo
+Owner:      deployment.apps/foo
+Labels:     app=foo,env=production
+Direction:  upload (from local to pod)
+Local:      ./local.txt
+Remote:     /tmp/remote.txt
+
+`,
+		},
+		{
+			name:        "cp download to windows path",
+			commandName: "cp",
+			fakeOsArgs:  []string{"confirm", "cp", "foo-abc-123:/tmp/remote.txt", `C:\local.txt`},
+			fakeRuns:    []string{fakePod, fakePodReplicaSet},
+			expectedStdout: "========== Target ===========\n" + fakePodSummary + `Container:  foo
+Owner:      deployment.apps/foo
+Labels:     app=foo,env=production
+Direction:  download (from pod to local)
+Local:      C:\local.txt
+Remote:     /tmp/remote.txt
+
+`,
+		},
+		{
+			name:        "debug node",
+			commandName: "debug",
+			fakeOsArgs:  []string{"confirm", "debug", "node/node-1", "-it", "--image=busybox"},
+			expectedStdout: `========== Target ===========
+Node:       node-1
+Image:      busybox
+Mode:       a new pod will be created on the node, with the node's filesystem mounted at /host
+
+`,
+		},
+		{
+			name:        "debug pod with ephemeral container",
+			commandName: "debug",
+			fakeOsArgs:  []string{"confirm", "debug", "foo-abc-123", "--image", "busybox", "--target", "sidecar"},
+			fakeRuns:    []string{fakePod, fakePodReplicaSet},
+			expectedStdout: "========== Target ===========\n" + fakePodSummary + `Container:  sidecar
+Owner:      deployment.apps/foo
+Labels:     app=foo,env=production
+Image:      busybox
+Mode:       an ephemeral container will be added to the pod
+
+`,
+		},
+		{
+			name:        "debug pod with copy",
+			commandName: "debug",
+			fakeOsArgs:  []string{"confirm", "debug", "foo-abc-123", "--image=busybox", "--copy-to=foo-debug"},
+			fakeRuns:    []string{fakePod, fakePodReplicaSet},
+			expectedStdout: "========== Target ===========\n" + fakePodSummary + `Container:  foo
+Owner:      deployment.apps/foo
+Labels:     app=foo,env=production
+Image:      busybox
+Mode:       a copy of the pod named foo-debug will be created
+
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			for _, run := range tc.fakeRuns {
+				fakeExecRunner.SetupRun(run, "", nil)
+			}
+			tc.options.parseArgs(tc.fakeOsArgs[1:])
+
+			cmd, _, stdout, _ := util.NewTestCommand()
+			if err := tc.options.target(cmd, tc.commandName); err != nil {
+				t.Fatalf("target failed: %v", err)
+			}
+
+			if fakeExecRunner.RunCount() != len(tc.fakeRuns) {
+				t.Fatalf("wrong number of kubectl runs. expected: %d, got: %d", len(tc.fakeRuns), fakeExecRunner.RunCount())
+			}
+			if tc.expectedArgs != nil && !reflect.DeepEqual(fakeExecRunner.RunArgs, tc.expectedArgs) {
+				t.Fatalf("wrong kubectl args.\nexpected: %v\ngot: %v\n", tc.expectedArgs, fakeExecRunner.RunArgs)
+			}
+			if stdout.String() != tc.expectedStdout {
+				t.Fatalf("wrong stdout\nexpected:\n%s\ngot:\n%s\n", tc.expectedStdout, stdout.String())
+			}
+		})
+	}
+}
+
+func TestTargetPolicy(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRun(fakePod, "", nil)
+	fakeExecRunner.SetupRun(fakePodReplicaSet, "", nil)
+	o := confirmOptions{
+		resolvedContext:   "prod-us",
+		resolvedNamespace: "default",
+		policy: &policy{Rules: []policyRule{{
+			Verbs:     []string{"exec"},
+			PodLabels: map[string]string{"env": "production"},
+			Action:    policyActionDeny,
+		}}},
+	}
+	o.parseArgs([]string{"exec", "foo-abc-123", "--", "sh"})
+	cmd, _, _, _ := util.NewTestCommand()
+	if err := o.target(cmd, "exec"); err != nil {
+		t.Fatalf("target failed: %v", err)
+	}
+
+	input := o.newPolicyInput("exec")
+	if input.namespace != "bar" || input.podLabels["env"] != "production" {
+		t.Fatalf("expected the policy input to use the target pod, got %+v", input)
+	}
+	if err := o.policy.check(input); err == nil {
+		t.Fatalf("expected exec into a production pod to be denied")
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+	"github.com/brianpursley/kubectl-confirm/internal/yaml"
+)
+
+// The time to wait for each workload to roll out after the command is executed, unless --confirm-verify-timeout is
+// specified
+const defaultVerifyTimeout = 5 * time.Minute
+
+// verificationResult is what the verification after executing the command found
+type verificationResult struct {
+	Succeeded bool `json:"succeeded"`
+	// Changed are the objects that changed, as names like deployment.apps/api
+	Changed  []string        `json:"changed,omitempty"`
+	Rollouts []rolloutResult `json:"rollouts,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// rolloutResult is whether a workload rolled out after the command was executed
+type rolloutResult struct {
+	Object    string `json:"object"`
+	Succeeded bool   `json:"succeeded"`
+	Message   string `json:"message"`
+}
+
+// parseVerifyTimeout sets the timeout of the verification from --confirm-verify-timeout
+func (o *confirmOptions) parseVerifyTimeout() error {
+	o.verifyTimeout = defaultVerifyTimeout
+	if len(o.verifyTimeoutFlag) == 0 {
+		return nil
+	}
+	timeout, err := time.ParseDuration(o.verifyTimeoutFlag)
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("invalid --confirm-verify-timeout %q", o.verifyTimeoutFlag)
+	}
+	o.verifyTimeout = timeout
+	return nil
+}
+
+// verifiedObject is an object affected by the command, as it was before the command was executed
+type verifiedObject struct {
+	obj map[string]interface{}
+	// before is nil if the object did not exist
+	before map[string]interface{}
+}
+
+// verifiedObjects returns the objects affected by the command that the preview knows, as they were before the command
+// was executed
+func (o *confirmOptions) verifiedObjects() []verifiedObject {
+	objs := make([]verifiedObject, 0, len(o.preview)+len(o.rolloutObjects)+len(o.deletedObjects))
+	for _, p := range o.preview {
+		objs = append(objs, verifiedObject{obj: p.merged, before: p.live})
+	}
+	for _, obj := range o.rolloutObjects {
+		objs = append(objs, verifiedObject{obj: obj, before: obj})
+	}
+	for _, obj := range o.deletedObjects {
+		objs = append(objs, verifiedObject{obj: obj, before: obj})
+	}
+	return objs
+}
+
+// withoutVolatileFields returns a copy of obj without the fields that change without the command changing them, like
+// its resource version and status, so that only the changes made by the command are shown
+func withoutVolatileFields(obj map[string]interface{}) map[string]interface{} {
+	obj = withoutManagedFields(obj)
+	if obj == nil {
+		return nil
+	}
+	metadata := util.NestedMap(obj, "metadata")
+	delete(metadata, "resourceVersion")
+	delete(metadata, "generation")
+	delete(obj, "status")
+	return obj
+}
+
+// verifyChanges gets the objects affected by the command again after it was executed, and shows what actually
+// changed, compared to the objects before the command was executed. Then it waits for the workloads whose pod
+// template changed to roll out.
+func (o *confirmOptions) verifyChanges(cmd *cobra.Command) *verificationResult {
+	cmd.Println()
+	util.PrintSectionTitle(cmd, "Verification")
+	defer cmd.Println()
+
+	result := &verificationResult{Succeeded: true}
+	objs := o.verifiedObjects()
+	if len(objs) == 0 {
+		cmd.Println("The objects affected by the command are not known, so there is nothing to verify")
+		return result
+	}
+
+	lookup := make([]map[string]interface{}, 0, len(objs))
+	for _, v := range objs {
+		lookup = append(lookup, v.obj)
+	}
+	live, err := o.getLiveObjects(cmd, lookup)
+	if err != nil {
+		cmd.Printf("FAILED: the objects could not be read again: %s\n", strings.TrimSpace(err.Error()))
+		result.Succeeded = false
+		result.Error = err.Error()
+		return result
+	}
+
+	// What actually changed
+	r := o.policy.redactor()
+	var workloads []map[string]interface{}
+	for _, v := range objs {
+		after := live[objectKey(v.obj)]
+		name := util.ObjectName(v.obj)
+		before, afterStripped := withoutVolatileFields(v.before), withoutVolatileFields(after)
+		if reflect.DeepEqual(before, afterStripped) {
+			cmd.Printf("%s unchanged\n", name)
+			continue
+		}
+		result.Changed = append(result.Changed, name)
+		redactedBefore, redactedAfter := r.redactPair(before, afterStripped)
+		beforeYaml, afterYaml := "", ""
+		if redactedBefore != nil {
+			beforeYaml = yaml.Marshal(redactedBefore)
+		}
+		if redactedAfter != nil {
+			afterYaml = yaml.Marshal(redactedAfter)
+		}
+		diffName := diffObjectName(v.obj)
+		cmd.Print(util.UnifiedDiff("before/"+diffName, "after/"+diffName, beforeYaml, afterYaml))
+		if after != nil && v.before != nil && rollingWorkloadKinds[util.NestedString(after, "kind")] && !onDeleteStrategy(after) &&
+			!reflect.DeepEqual(util.NestedMap(v.before, "spec", "template"), util.NestedMap(after, "spec", "template")) {
+			workloads = append(workloads, after)
+		}
+	}
+
+	// Rollouts
+	for _, obj := range workloads {
+		rollout := o.waitForRollout(cmd, obj)
+		if rollout.Succeeded {
+			cmd.Printf("%s: %s\n", rollout.Object, rollout.Message)
+		} else {
+			cmd.Printf("FAILED: %s: %s\n", rollout.Object, rollout.Message)
+			result.Succeeded = false
+		}
+		result.Rollouts = append(result.Rollouts, rollout)
+	}
+
+	if result.Succeeded {
+		cmd.Println("Verification succeeded")
+	} else {
+		cmd.Println("Verification failed")
+	}
+	return result
+}
+
+// waitForRollout waits for a workload to roll out using kubectl rollout status, until the verification timeout
+func (o *confirmOptions) waitForRollout(cmd *cobra.Command, obj map[string]interface{}) rolloutResult {
+	name := util.ObjectName(obj)
+	args := []string{"rollout", "status", name, "--namespace=" + util.NestedString(obj, "metadata", "namespace"), "--timeout=" + o.verifyTimeout.String()}
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	err := o.runKubectl(cmd.Context(), append(args, o.globalFlags()...), nil, &stdout, &stderr)
+	if err != nil {
+		return rolloutResult{Object: name, Message: lastLine(stderr.String(), err.Error())}
+	}
+	return rolloutResult{Object: name, Succeeded: true, Message: lastLine(stdout.String(), "rolled out")}
+}
+
+// lastLine returns the last line of s that is not empty, or defaultValue if there is none
+func lastLine(s, defaultValue string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); len(last) > 0 {
+		return last
+	}
+	return defaultValue
+}
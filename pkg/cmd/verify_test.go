@@ -0,0 +1,145 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestParseVerifyTimeout(t *testing.T) {
+	testCases := []struct {
+		args          []string
+		expected      time.Duration
+		expectedError string
+	}{
+		{args: []string{"apply", "-f", "x.yaml", "--confirm-verify"}, expected: defaultVerifyTimeout},
+		{args: []string{"apply", "-f", "x.yaml", "--confirm-verify", "--confirm-verify-timeout=90s"}, expected: 90 * time.Second},
+		{args: []string{"apply", "-f", "x.yaml", "--confirm-verify-timeout", "soon"}, expectedError: `invalid --confirm-verify-timeout "soon"`},
+	}
+	for _, tc := range testCases {
+		o := &confirmOptions{}
+		o.parseArgs(tc.args)
+		err := o.parseVerifyTimeout()
+		if len(tc.expectedError) > 0 {
+			if err == nil || err.Error() != tc.expectedError {
+				t.Fatalf("expected error %q, got %v", tc.expectedError, err)
+			}
+			continue
+		}
+		if err != nil || o.verifyTimeout != tc.expected {
+			t.Fatalf("expected %s, got %s, %v", tc.expected, o.verifyTimeout, err)
+		}
+		if containsString(o.args.Raw(), "--confirm-verify") {
+			t.Fatalf("expected --confirm-verify not to be passed to kubectl: %v", o.args.Raw())
+		}
+	}
+}
+
+func TestVerifyChanges(t *testing.T) {
+	const before = `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api", "namespace": "x", "resourceVersion": "1"}, "spec": {"replicas": 2, "template": {"spec": {"containers": [{"name": "app", "image": "app:1"}]}}}, "status": {"readyReplicas": 2}}`
+	const merged = `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api", "namespace": "x", "resourceVersion": "1"}, "spec": {"replicas": 2, "template": {"spec": {"containers": [{"name": "app", "image": "app:2"}]}}}}`
+	const after = `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api", "namespace": "x", "resourceVersion": "2"}, "spec": {"replicas": 2, "template": {"spec": {"containers": [{"name": "app", "image": "app:2"}]}}}, "status": {"readyReplicas": 1}}`
+	const configMap = `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "settings", "namespace": "x", "resourceVersion": "5"}, "data": {"a": "1"}}`
+
+	testCases := []struct {
+		name             string
+		rolloutStdout    string
+		rolloutStderr    string
+		rolloutErr       error
+		expectedStdout   []string
+		expectedResult   verificationResult
+		expectedRollouts int
+	}{
+		{
+			name:          "rolled out",
+			rolloutStdout: "Waiting for deployment \"api\" rollout to finish: 1 of 2 updated replicas are available...\ndeployment \"api\" successfully rolled out\n",
+			expectedStdout: []string{
+				"-      - image: app:1\n+      - image: app:2\n",
+				"configmap/settings unchanged\n",
+				"deployment.apps/api: deployment \"api\" successfully rolled out\n",
+				"Verification succeeded\n",
+			},
+			expectedResult: verificationResult{
+				Succeeded: true,
+				Changed:   []string{"deployment.apps/api"},
+				Rollouts:  []rolloutResult{{Object: "deployment.apps/api", Succeeded: true, Message: "deployment \"api\" successfully rolled out"}},
+			},
+		},
+		{
+			name:          "timed out",
+			rolloutStderr: "error: timed out waiting for the condition\n",
+			rolloutErr:    errors.New("exit status 1"),
+			expectedStdout: []string{
+				"FAILED: deployment.apps/api: error: timed out waiting for the condition\n",
+				"Verification failed\n",
+			},
+			expectedResult: verificationResult{
+				Changed:  []string{"deployment.apps/api"},
+				Rollouts: []rolloutResult{{Object: "deployment.apps/api", Message: "error: timed out waiting for the condition"}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeExecRunner := util.NewFakeExecRunner()
+			fakeExecRunner.SetupRun(`{"kind": "List", "items": [`+after+`, `+configMap+`]}`, "", nil)
+			fakeExecRunner.SetupRun(tc.rolloutStdout, tc.rolloutStderr, tc.rolloutErr)
+
+			o := &confirmOptions{verifyTimeout: time.Minute, preview: []previewObject{
+				{live: decodeTestObject(t, before), merged: decodeTestObject(t, merged)},
+				{live: decodeTestObject(t, configMap), merged: decodeTestObject(t, configMap)},
+			}}
+			o.parseArgs([]string{"apply", "-f", "x.yaml", "--context=ctx"})
+			cmd, _, stdout, _ := util.NewTestCommand()
+			result := o.verifyChanges(cmd)
+
+			for _, expected := range tc.expectedStdout {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Fatalf("expected stdout to contain:\n%s\ngot:\n%s", expected, stdout.String())
+				}
+			}
+			if strings.Contains(stdout.String(), "resourceVersion") || strings.Contains(stdout.String(), "readyReplicas") {
+				t.Fatalf("expected volatile fields not to be shown, got:\n%s", stdout.String())
+			}
+			if !reflect.DeepEqual(*result, tc.expectedResult) {
+				t.Fatalf("wrong result.\nexpected: %+v\ngot: %+v", tc.expectedResult, *result)
+			}
+			expectedArgs := []string{"rollout", "status", "deployment.apps/api", "--namespace=x", "--timeout=1m0s", "--context=ctx"}
+			if !reflect.DeepEqual(fakeExecRunner.LastRunArgs(), expectedArgs) {
+				t.Fatalf("wrong rollout status args.\nexpected: %v\ngot: %v", expectedArgs, fakeExecRunner.LastRunArgs())
+			}
+		})
+	}
+}
+
+func TestVerifyChangesWithoutObjects(t *testing.T) {
+	util.NewFakeExecRunner()
+	o := &confirmOptions{}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	if result := o.verifyChanges(cmd); !result.Succeeded {
+		t.Fatalf("expected nothing to fail, got %+v", result)
+	}
+	if !strings.Contains(stdout.String(), "there is nothing to verify") {
+		t.Fatalf("wrong stdout:\n%s", stdout.String())
+	}
+}
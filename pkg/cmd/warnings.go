@@ -0,0 +1,43 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+// addWarnings records warnings returned by the server dry run, like API deprecation warnings and admission webhook
+// warnings. Warnings that were already recorded are skipped, because kubectl prints them once per object.
+func (o *confirmOptions) addWarnings(warnings []string) {
+	for _, w := range warnings {
+		o.warnings = appendUnique(o.warnings, w)
+	}
+}
+
+// printWarnings shows the warnings returned by the server dry run. Nothing is printed if there are none.
+func (o *confirmOptions) printWarnings(cmd *cobra.Command) {
+	if len(o.warnings) == 0 {
+		return
+	}
+	util.PrintSectionTitle(cmd, "Warnings")
+	defer cmd.Println()
+	for _, w := range o.warnings {
+		cmd.Printf("WARNING: %s\n", w)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/internal/util"
+)
+
+func TestPrintWarnings(t *testing.T) {
+	fakeExecRunner := util.NewFakeExecRunner()
+	fakeExecRunner.SetupRun("deployment.apps/foo created (server dry run)\n", "Warning: apps/v1beta1 Deployment is deprecated\n", nil)
+	fakeExecRunner.SetupRun(`{"kind": "List", "items": []}`, "Warning: policy-webhook: image tag latest is discouraged\nWarning: apps/v1beta1 Deployment is deprecated\n", nil)
+
+	o := confirmOptions{args: kubeargs.Parse([]string{"foo", "-f", "foo.yaml"})}
+	cmd, _, stdout, _ := util.NewTestCommand()
+	if err := o.printDryRun(cmd, o.args.With("--dry-run=server")); err != nil {
+		t.Fatalf("printDryRun failed: %v", err)
+	}
+	if err := o.printRedactedDryRun(cmd, "json"); err != nil {
+		t.Fatalf("printRedactedDryRun failed: %v", err)
+	}
+	expectedWarnings := []string{"apps/v1beta1 Deployment is deprecated", "policy-webhook: image tag latest is discouraged"}
+	if !reflect.DeepEqual(o.warnings, expectedWarnings) {
+		t.Fatalf("wrong warnings.\nexpected: %q\ngot: %q", expectedWarnings, o.warnings)
+	}
+
+	stdout.Reset()
+	o.printWarnings(cmd)
+	expected := `========== Warnings =========
+WARNING: apps/v1beta1 Deployment is deprecated
+WARNING: policy-webhook: image tag latest is discouraged
+
+`
+	if stdout.String() != expected {
+		t.Fatalf("wrong stdout.\nexpected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	(&confirmOptions{}).printWarnings(cmd)
+	if stdout.Len() > 0 {
+		t.Fatalf("expected nothing to be printed without warnings, got:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package confirm lets other tools and kubectl plugins confirm kubectl commands the same way as kubectl confirm. A
+// Planner previews a command and returns a Plan, a Renderer shows the plan, a Prompter asks the user to confirm it,
+// and the Planner executes it once it is confirmed:
+//
+//	planner := &confirm.Planner{Signals: []os.Signal{os.Interrupt}}
+//	args := []string{"apply", "-f", "x.yaml"}
+//	err := confirm.Confirm(ctx, planner, confirm.TextRenderer{}, &confirm.TerminalPrompter{}, args, os.Stdout, os.Stderr)
+//
+// Plans are recorded in the history of kubectl confirm and follow its policy, the same as commands confirmed by
+// kubectl confirm itself.
+package confirm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/brianpursley/kubectl-confirm/internal/kubeargs"
+	"github.com/brianpursley/kubectl-confirm/pkg/cmd"
+)
+
+// ErrAborted is returned by Confirm when the command was not confirmed
+var ErrAborted = errors.New("the command was not confirmed")
+
+// Executor runs kubectl for the planner, both to preview the command and to execute it. It can be used to run a
+// different kubectl binary, to run it remotely, or to fake it in tests. Run is called concurrently by the steps of the
+// preview.
+type Executor interface {
+	Run(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// ExecutorFunc is a function that implements Executor
+type ExecutorFunc func(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+// Run calls f
+func (f ExecutorFunc) Run(ctx context.Context, name string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return f(ctx, name, args, stdin, stdout, stderr)
+}
+
+// Planner previews kubectl commands and executes them once they are confirmed. The zero value runs kubectl as a
+// process, using the kubeconfig of the environment.
+type Planner struct {
+	// Executor runs kubectl. If it is nil, kubectl is run as a process.
+	Executor Executor
+	// Kubeconfig is the kubeconfig file used by commands that do not specify --kubeconfig themselves
+	Kubeconfig string
+	// Stdin is the manifest of commands that use -f -
+	Stdin io.Reader
+	// Stderr is where warnings of the preview are printed. If it is nil, they are discarded.
+	Stderr io.Writer
+	// Signals interrupt the preview, the prompt, and the command, like os.Interrupt. If there are none, the planner
+	// does not install any signal handlers, and they are only interrupted when the context is cancelled.
+	Signals []os.Signal
+}
+
+// Object is an object that the command of a plan affects
+type Object struct {
+	// Name is the kind and name of the object, like deployment.apps/foo
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Action is what the command does to the object, as kubectl prints it, like created, configured, or deleted
+	Action string `json:"action"`
+	// Diff is the unified diff of the object as it is now and as it will be, with sensitive values masked. It is
+	// empty if the object does not change, or if it is deleted.
+	Diff string `json:"diff,omitempty"`
+}
+
+// Plan is a kubectl command that was previewed, which is ready to be confirmed. Every plan must be executed or aborted
+// by the planner that created it, which removes its temp files.
+type Plan struct {
+	// Args are the args of the kubectl command that is executed when the plan is confirmed, without kubectl itself
+	Args      []string `json:"args"`
+	Context   string   `json:"context"`
+	Cluster   string   `json:"cluster"`
+	User      string   `json:"user"`
+	Namespace string   `json:"namespace"`
+	// Objects are the objects that the command affects. They are known for commands that have a diff, like apply, and
+	// for delete.
+	Objects []Object `json:"objects,omitempty"`
+	// Warnings are the warnings returned by the server dry run
+	Warnings []string `json:"warnings,omitempty"`
+	// FailedSteps are the preview steps that failed, when the policy allows confirming the command anyway
+	FailedSteps []string `json:"failedSteps,omitempty"`
+	// PolicyChallenges are the messages of the policy rules that require a stronger confirmation of the command
+	PolicyChallenges []string `json:"policyChallenges,omitempty"`
+	// ExpectedResponse is the response that confirms the command, which is yes, or the name of the context if any
+	// preview steps failed or a policy rule requires it
+	ExpectedResponse string `json:"expectedResponse"`
+	// Report is the preview as kubectl confirm shows it before the prompt, with sensitive values masked
+	Report string `json:"report"`
+
+	preview *cmd.Preview
+}
+
+// Plan previews a kubectl command, given its args without kubectl itself, like []string{"apply", "-f", "x.yaml"}.
+// Commands that need kubectl confirm itself, like edit and rollback, and commands that run in several contexts or
+// namespaces, are not supported.
+func (p *Planner) Plan(ctx context.Context, args []string) (*Plan, error) {
+	if parsed := kubeargs.Parse(args); len(p.Kubeconfig) > 0 && !parsed.Has("kubeconfig") {
+		args = parsed.With("--kubeconfig=" + p.Kubeconfig)
+	}
+	opts := cmd.PreviewOptions{Stdin: p.Stdin, ErrOut: p.Stderr, Signals: p.Signals}
+	if p.Executor != nil {
+		opts.Runner = p.Executor.Run
+	}
+	preview, err := cmd.NewPreview(ctx, args, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{
+		Args:             preview.Args(),
+		Warnings:         preview.Warnings(),
+		FailedSteps:      preview.FailedSteps(),
+		PolicyChallenges: preview.PolicyChallenges(),
+		ExpectedResponse: preview.ExpectedResponse(),
+		Report:           preview.Report(),
+		preview:          preview,
+	}
+	plan.Context, plan.Cluster, plan.User, plan.Namespace = preview.Context()
+	for _, obj := range preview.Objects() {
+		plan.Objects = append(plan.Objects, Object{Name: obj.Name, Namespace: obj.Namespace, Action: obj.Action, Diff: obj.Diff})
+	}
+	return plan, nil
+}
+
+// Execute executes the command of a confirmed plan, with the output of kubectl written to stdout and stderr, and
+// records it in the history. The command is run by the executor of the planner that created the plan.
+func (p *Planner) Execute(ctx context.Context, plan *Plan, stdout, stderr io.Writer) error {
+	if plan.preview == nil {
+		return errors.New("the plan was not created by a planner")
+	}
+	return plan.preview.Execute(ctx, stdout, stderr)
+}
+
+// Abort records the command of a plan that was not confirmed in the history as aborted, without executing it
+func (p *Planner) Abort(ctx context.Context, plan *Plan) {
+	if plan.preview != nil {
+		plan.preview.Abort(ctx)
+	}
+}
+
+// Confirm previews a kubectl command, renders the plan to stdout, and executes the command if the prompter confirms
+// it, which is the same flow as kubectl confirm. ErrAborted is returned if the command is not confirmed.
+func Confirm(ctx context.Context, planner *Planner, renderer Renderer, prompter Prompter, args []string, stdout, stderr io.Writer) error {
+	plan, err := planner.Plan(ctx, args)
+	if err != nil {
+		return err
+	}
+	if err := renderer.Render(stdout, plan); err != nil {
+		planner.Abort(ctx, plan)
+		return err
+	}
+	confirmed, err := prompter.Prompt(ctx, plan)
+	if err != nil || !confirmed {
+		planner.Abort(ctx, plan)
+		if err != nil {
+			return err
+		}
+		return ErrAborted
+	}
+	return planner.Execute(ctx, plan, stdout, stderr)
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package confirm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The note that kubectl confirm shows above the dry run summary that it derives from the server dry run
+const derivedDryRunNote = "*** Derived from the objects returned by the server dry run, so kubectl may word it differently ***"
+
+// testExecutor is a fake kubectl, which answers the preview of applying a ConfigMap and records the commands it runs
+type testExecutor struct {
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func (e *testExecutor) Run(_ context.Context, _ string, args []string, _ io.Reader, stdout, _ io.Writer) error {
+	e.mu.Lock()
+	e.commands = append(e.commands, args)
+	e.mu.Unlock()
+	joined := strings.Join(args, " ")
+	var err error
+	switch {
+	case strings.HasPrefix(joined, "config view"):
+		_, err = io.WriteString(stdout, `{"current-context": "prod", "contexts": [{"name": "prod", "context": {"cluster": "c1", "user": "admin", "namespace": "x"}}]}`)
+	case strings.Contains(joined, "--dry-run=server"):
+		_, err = io.WriteString(stdout, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo", "namespace": "x"}}`)
+	case strings.Contains(joined, "can-i"):
+		_, err = io.WriteString(stdout, "yes\n")
+	case strings.HasPrefix(joined, "apply"):
+		_, err = io.WriteString(stdout, "configmap/foo created\n")
+	}
+	return err
+}
+
+// executed returns true if the command itself was executed, and not only previewed
+func (e *testExecutor) executed(args []string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, c := range e.commands {
+		if reflect.DeepEqual(c, args) {
+			return true
+		}
+	}
+	return false
+}
+
+// useTestEnvironment records the changes made by a test in a temp dir, without a policy, and returns the dir
+func useTestEnvironment(t *testing.T) string {
+	historyDir := t.TempDir()
+	t.Setenv("KUBECTL_CONFIRM_HISTORY", historyDir)
+	t.Setenv("KUBECTL_CONFIRM_POLICY", filepath.Join(t.TempDir(), "missing.json"))
+	return historyDir
+}
+
+// readTestRecords returns the results of the changes recorded in the history dir
+func readTestRecords(t *testing.T, historyDir string) []string {
+	entries, err := os.ReadDir(historyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(historyDir, entry.Name(), "record.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var record struct {
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal(data, &record); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, record.Result)
+	}
+	return results
+}
+
+func TestPlan(t *testing.T) {
+	testCases := []struct {
+		name         string
+		kubeconfig   string
+		args         []string
+		expectedArgs []string
+	}{
+		{
+			name:         "command",
+			args:         []string{"apply", "-f", "foo.yaml"},
+			expectedArgs: []string{"apply", "-f", "foo.yaml"},
+		},
+		{
+			name:         "kubeconfig of the planner",
+			kubeconfig:   "/tmp/config",
+			args:         []string{"apply", "-f", "foo.yaml"},
+			expectedArgs: []string{"apply", "-f", "foo.yaml", "--kubeconfig=/tmp/config"},
+		},
+		{
+			name:         "kubeconfig of the command",
+			kubeconfig:   "/tmp/config",
+			args:         []string{"apply", "-f", "foo.yaml", "--kubeconfig", "/tmp/other"},
+			expectedArgs: []string{"apply", "-f", "foo.yaml", "--kubeconfig", "/tmp/other"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useTestEnvironment(t)
+			executor := &testExecutor{}
+			planner := &Planner{Executor: executor, Kubeconfig: tc.kubeconfig}
+			plan, err := planner.Plan(context.Background(), tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer planner.Abort(context.Background(), plan)
+
+			if !reflect.DeepEqual(plan.Args, tc.expectedArgs) {
+				t.Fatalf("wrong args.\nexpected: %v\ngot: %v", tc.expectedArgs, plan.Args)
+			}
+			if plan.Context != "prod" || plan.Cluster != "c1" || plan.User != "admin" || plan.Namespace != "x" {
+				t.Fatalf("wrong target: %s, %s, %s, %s", plan.Context, plan.Cluster, plan.User, plan.Namespace)
+			}
+			if plan.ExpectedResponse != "yes" {
+				t.Fatalf("expected the response yes, got %q", plan.ExpectedResponse)
+			}
+			expectedObjects := []Object{{
+				Name:      "configmap/foo",
+				Namespace: "x",
+				Action:    "created",
+				Diff:      "--- live/v1.ConfigMap.x.foo\n+++ merged/v1.ConfigMap.x.foo\n@@ -0,0 +1,5 @@\n+apiVersion: v1\n+kind: ConfigMap\n+metadata:\n+  name: foo\n+  namespace: x\n",
+			}}
+			if !reflect.DeepEqual(plan.Objects, expectedObjects) {
+				t.Fatalf("wrong objects.\nexpected: %+v\ngot: %+v", expectedObjects, plan.Objects)
+			}
+			if expected := "========== Dry Run ==========\n" + derivedDryRunNote + "\nconfigmap/foo created (server dry run)\n"; !strings.Contains(plan.Report, expected) {
+				t.Fatalf("expected the report to contain:\n%s\ngot:\n%s", expected, plan.Report)
+			}
+			if executor.executed(tc.expectedArgs) {
+				t.Fatal("expected the command not to be executed by the preview")
+			}
+		})
+	}
+}
+
+func TestPlanExec(t *testing.T) {
+	useTestEnvironment(t)
+	executor := &testExecutor{}
+	planner := &Planner{Executor: executor, Kubeconfig: "/tmp/config"}
+	plan, err := planner.Plan(context.Background(), []string{"exec", "foo", "--", "ls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer planner.Abort(context.Background(), plan)
+
+	// The kubeconfig is not passed to the command that runs in the container
+	if expected := []string{"exec", "foo", "--kubeconfig=/tmp/config", "--", "ls"}; !reflect.DeepEqual(plan.Args, expected) {
+		t.Fatalf("wrong args.\nexpected: %v\ngot: %v", expected, plan.Args)
+	}
+}
+
+func TestPlanUnsupported(t *testing.T) {
+	testCases := []struct {
+		args          []string
+		expectedError string
+	}{
+		{
+			args:          nil,
+			expectedError: "expected at least one argument",
+		},
+		{
+			args:          []string{"edit", "deployment/foo"},
+			expectedError: "edit is only supported by kubectl confirm",
+		},
+		{
+			args:          []string{"rollback", "20240102-150405-1a2b3c"},
+			expectedError: "rollback is only supported by kubectl confirm",
+		},
+		{
+			args:          []string{"apply", "-f", "foo.yaml", "--contexts=a,b"},
+			expectedError: "--contexts, --confirm-namespaces, and --confirm-namespace-selector are only supported by kubectl confirm",
+		},
+	}
+	for _, tc := range testCases {
+		useTestEnvironment(t)
+		executor := &testExecutor{}
+		planner := &Planner{Executor: executor}
+		if _, err := planner.Plan(context.Background(), tc.args); err == nil || err.Error() != tc.expectedError {
+			t.Fatalf("expected error %q for %v, got %v", tc.expectedError, tc.args, err)
+		}
+		if len(executor.commands) > 0 {
+			t.Fatalf("expected kubectl not to be run for %v, got %v", tc.args, executor.commands)
+		}
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	args := []string{"apply", "-f", "foo.yaml"}
+	testCases := []struct {
+		name           string
+		confirmed      bool
+		promptErr      error
+		expectedErr    error
+		expectedResult string
+	}{
+		{
+			name:           "confirmed",
+			confirmed:      true,
+			expectedResult: "succeeded",
+		},
+		{
+			name:           "not confirmed",
+			expectedErr:    ErrAborted,
+			expectedResult: "aborted",
+		},
+		{
+			name:           "prompt failed",
+			promptErr:      errors.New("no terminal"),
+			expectedErr:    errors.New("no terminal"),
+			expectedResult: "aborted",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			historyDir := useTestEnvironment(t)
+			executor := &testExecutor{}
+			planner := &Planner{Executor: executor}
+			prompter := PrompterFunc(func(ctx context.Context, plan *Plan) (bool, error) {
+				return tc.confirmed, tc.promptErr
+			})
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+			err := Confirm(context.Background(), planner, TextRenderer{}, prompter, args, stdout, stderr)
+			if !reflect.DeepEqual(err, tc.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+			}
+			if !strings.Contains(stdout.String(), "========== Dry Run ==========\n"+derivedDryRunNote+"\nconfigmap/foo created (server dry run)\n") {
+				t.Fatalf("expected the plan to be rendered, got:\n%s", stdout.String())
+			}
+			if executor.executed(args) != tc.confirmed {
+				t.Fatalf("expected the command to be executed: %t, got %v", tc.confirmed, executor.commands)
+			}
+			if tc.confirmed && !strings.HasSuffix(stdout.String(), "configmap/foo created\n") {
+				t.Fatalf("expected the output of kubectl, got:\n%s", stdout.String())
+			}
+			if results := readTestRecords(t, historyDir); !reflect.DeepEqual(results, []string{tc.expectedResult}) {
+				t.Fatalf("expected the change to be recorded as %s, got %v", tc.expectedResult, results)
+			}
+		})
+	}
+}
+
+func TestExecuteWithoutPlanner(t *testing.T) {
+	planner := &Planner{Executor: &testExecutor{}}
+	if err := planner.Execute(context.Background(), &Plan{Args: []string{"apply", "-f", "foo.yaml"}}, io.Discard, io.Discard); err == nil {
+		t.Fatal("expected an error for a plan that was not created by a planner")
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package confirm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// Prompter asks the user to confirm a plan, after it was rendered
+type Prompter interface {
+	Prompt(ctx context.Context, plan *Plan) (bool, error)
+}
+
+// PrompterFunc is a function that implements Prompter, like a button in a UI or an approval in a chat
+type PrompterFunc func(ctx context.Context, plan *Plan) (bool, error)
+
+// Prompt calls f
+func (f PrompterFunc) Prompt(ctx context.Context, plan *Plan) (bool, error) {
+	return f(ctx, plan)
+}
+
+// TerminalPrompter asks the user to confirm a plan the same way as kubectl confirm, by entering yes or the name of the
+// context
+type TerminalPrompter struct {
+	// In is where the response is read from. If it is nil, it is read from os.Stdin.
+	In io.Reader
+	// Out is where the prompt is printed. If it is nil, it is printed to os.Stderr.
+	Out io.Writer
+}
+
+// Prompt prints the command of the plan and returns true if the user entered the expected response
+func (p *TerminalPrompter) Prompt(ctx context.Context, plan *Plan) (bool, error) {
+	if plan.preview == nil {
+		return false, errors.New("the plan was not created by a planner")
+	}
+	in, out := p.In, p.Out
+	if in == nil {
+		in = os.Stdin
+	}
+	if out == nil {
+		out = os.Stderr
+	}
+	return plan.preview.Prompt(ctx, in, out)
+}
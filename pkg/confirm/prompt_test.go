@@ -0,0 +1,60 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package confirm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTerminalPrompter(t *testing.T) {
+	testCases := []struct {
+		response  string
+		confirmed bool
+	}{
+		{response: "yes\n", confirmed: true},
+		{response: "no\n", confirmed: false},
+		{response: "", confirmed: false},
+	}
+	for _, tc := range testCases {
+		useTestEnvironment(t)
+		planner := &Planner{Executor: &testExecutor{}}
+		plan, err := planner.Plan(context.Background(), []string{"apply", "-f", "foo.yaml"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &strings.Builder{}
+		prompter := &TerminalPrompter{In: strings.NewReader(tc.response), Out: out}
+		confirmed, err := prompter.Prompt(context.Background(), plan)
+		planner.Abort(context.Background(), plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if confirmed != tc.confirmed {
+			t.Fatalf("expected %q to confirm the plan: %t, got %t", tc.response, tc.confirmed, confirmed)
+		}
+		expected := "========== Confirm ==========\nThe following command will be executed:\nkubectl apply -f foo.yaml\n\nEnter 'yes' to continue: \n"
+		if out.String() != expected {
+			t.Fatalf("wrong prompt.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+		}
+	}
+
+	if _, err := (&TerminalPrompter{}).Prompt(context.Background(), &Plan{}); err == nil {
+		t.Fatal("expected an error for a plan that was not created by a planner")
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package confirm
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Renderer shows a plan to the user before it is confirmed
+type Renderer interface {
+	Render(w io.Writer, plan *Plan) error
+}
+
+// TextRenderer renders a plan as text, the same way as kubectl confirm shows it
+type TextRenderer struct{}
+
+// Render writes the report of the plan
+func (TextRenderer) Render(w io.Writer, plan *Plan) error {
+	_, err := io.WriteString(w, plan.Report)
+	return err
+}
+
+// JSONRenderer renders a plan as JSON, for tools that show it in their own way, like a web UI or a chat message. The
+// objects, their diffs, the warnings, and the policy challenges are separate fields, so they do not need to be parsed
+// from the report.
+type JSONRenderer struct {
+	// Indent is the indent of the JSON, or an empty string to write it on one line
+	Indent string
+}
+
+// Render writes the plan as a JSON object, followed by a newline
+func (r JSONRenderer) Render(w io.Writer, plan *Plan) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", r.Indent)
+	return encoder.Encode(plan)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 Brian Pursley.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package confirm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	plan := &Plan{
+		Args:             []string{"delete", "pod", "foo"},
+		Context:          "prod",
+		Objects:          []Object{{Name: "pod/foo", Namespace: "x", Action: "deleted"}},
+		PolicyChallenges: []string{"prod is protected"},
+		ExpectedResponse: "prod",
+		Report:           "========== Config ===========\nContext:    prod\n\n========== Dry Run ==========\npod \"foo\" deleted (server dry run)\n\n",
+	}
+	testCases := []struct {
+		name     string
+		renderer Renderer
+		expected string
+	}{
+		{
+			name:     "text",
+			renderer: TextRenderer{},
+			expected: "========== Config ===========\nContext:    prod\n\n========== Dry Run ==========\npod \"foo\" deleted (server dry run)\n\n",
+		},
+		{
+			name:     "json",
+			renderer: JSONRenderer{},
+			expected: `{"args":["delete","pod","foo"],"context":"prod","cluster":"","user":"","namespace":"","objects":[{"name":"pod/foo","namespace":"x","action":"deleted"}],"policyChallenges":["prod is protected"],"expectedResponse":"prod",` +
+				`"report":"========== Config ===========\nContext:    prod\n\n========== Dry Run ==========\npod \"foo\" deleted (server dry run)\n\n"}` + "\n",
+		},
+		{
+			name:     "indented json",
+			renderer: JSONRenderer{Indent: "  "},
+			expected: "{\n  \"args\": [\n    \"delete\",\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			if err := tc.renderer.Render(out, plan); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(out.String(), tc.expected) {
+				t.Fatalf("wrong output.\nexpected:\n%s\ngot:\n%s", tc.expected, out.String())
+			}
+		})
+	}
+}